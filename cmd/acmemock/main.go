@@ -1,29 +1,23 @@
 package main
 
 import (
-    "crypto/rand"
-    "encoding/base64"
-    "encoding/json"
     "log"
     "net/http"
-)
+    "os"
 
-type CertReq struct {
-    Host string `json:"host"`
-}
+    "github.com/vaheed/kubeop/internal/acmeserver"
+)
 
+// acme-mock is an ACME CA that accepts every challenge. ACME_MOCK_BASE_URL
+// must be the URL clients reach it on, as directory entries are built from it.
 func main() {
+    base := os.Getenv("ACME_MOCK_BASE_URL")
+    if base == "" { base = "http://acme-mock.kubeop-system.svc.cluster.local:8080" }
+    ca := &acmeserver.Server{BaseURL: base}
     mux := http.NewServeMux()
     mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) })
-    mux.HandleFunc("/v1/certificates", func(w http.ResponseWriter, r *http.Request) {
-        if r.Method != http.MethodPost { http.Error(w, "method", http.StatusMethodNotAllowed); return }
-        var req CertReq
-        _ = json.NewDecoder(r.Body).Decode(&req)
-        der := make([]byte, 256)
-        rand.Read(der)
-        pem := base64.StdEncoding.EncodeToString(der)
-        json.NewEncoder(w).Encode(map[string]any{"status": "ok", "host": req.Host, "certificate": pem, "private_key": pem})
-    })
-    log.Println("acme-mock listening on :8080")
+    mux.HandleFunc("/ca.pem", func(w http.ResponseWriter, r *http.Request) { w.Write(ca.CACertificate()) })
+    mux.Handle("/", ca)
+    log.Printf("acme-mock listening on :8080, directory %s/directory", base)
     log.Fatal(http.ListenAndServe(":8080", mux))
 }
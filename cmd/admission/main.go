@@ -10,13 +10,16 @@ import (
     "encoding/pem"
     "log"
     "math/big"
+    "net"
     "net/http"
     "time"
 
     // admissionv1 "k8s.io/api/admission/v1"
     corev1 "k8s.io/api/core/v1"
     arv1 "k8s.io/api/admissionregistration/v1"
+    apiextclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/dynamic"
     "k8s.io/client-go/kubernetes"
     "k8s.io/client-go/rest"
 
@@ -37,6 +40,10 @@ func main() {
     if err != nil { log.Fatalf("in cluster config: %v", err) }
     kc, err := kubernetes.NewForConfig(cfg)
     if err != nil { log.Fatalf("k8s client: %v", err) }
+    ax, err := apiextclient.NewForConfig(cfg)
+    if err != nil { log.Fatalf("apiextensions client: %v", err) }
+    dc, err := dynamic.NewForConfig(cfg)
+    if err != nil { log.Fatalf("dynamic client: %v", err) }
 
     caPEM, certPEM, keyPEM, err := ensureTLSSecret(kc)
     if err != nil { log.Fatalf("ensure tls: %v", err) }
@@ -45,6 +52,7 @@ func main() {
             log.Printf("webhook ca patch retries exhausted: %v", err)
         }
     }()
+    go keepConversion(ax, caPEM, time.Minute)
 
     cert, err := tls.X509KeyPair(certPEM, keyPEM)
     if err != nil { log.Fatalf("pair: %v", err) }
@@ -56,10 +64,23 @@ func main() {
     mux.Handle("/metrics", api.PromHandler())
     mux.HandleFunc("/mutate", admission.ServeMutate)
     mux.HandleFunc("/validate", admission.ServeValidate)
+    mux.Handle("/convert", admission.ConvertHandler())
 
     srv := &http.Server{ Addr: ":8443", Handler: mux, TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}} }
+    ln, err := net.Listen("tcp", srv.Addr)
+    if err != nil { log.Fatalf("listen: %v", err) }
+    // the caches list v1beta1 objects through /convert, so they are filled
+    // once the server is up; until then checks needing them deny requests
+    // and /readyz stays ready so the Service keeps routing conversions here
+    go func() {
+        if err := admission.StartInformers(context.Background(), dc, admission.GatewayAPIServed(kc.Discovery())); err != nil {
+            log.Printf("informers: %v", err)
+            return
+        }
+        log.Println("admission caches synced")
+    }()
     log.Println("admission webhook listening on :8443")
-    log.Fatal(srv.ListenAndServeTLS("", ""))
+    log.Fatal(srv.ServeTLS(ln, "", ""))
 }
 
 func ensureTLSSecret(kc *kubernetes.Clientset) ([]byte, []byte, []byte, error) {
@@ -126,6 +147,17 @@ func patchWebhooksCABundle(kc *kubernetes.Clientset, ca []byte) error {
     return err
 }
 
+// keepConversion routes the conversion of the paas.kubeop.io CRDs through
+// /convert, checking again every interval in case they were re-applied.
+func keepConversion(ax apiextclient.Interface, ca []byte, interval time.Duration) {
+    for {
+        if err := admission.EnsureConversion(context.Background(), ax, ns, svcName, ca); err != nil {
+            log.Printf("crd conversion: %v", err)
+        }
+        time.Sleep(interval)
+    }
+}
+
 func setCABundle(cc *arv1.WebhookClientConfig, ca []byte) {
     // caBundle expects PEM bytes; API server stores []byte (base64 in JSON)
     cc.CABundle = append([]byte(nil), ca...)
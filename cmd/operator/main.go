@@ -3,19 +3,30 @@ package main
 import (
     "encoding/json"
     "flag"
+    "fmt"
+    "net"
     "net/http"
     "os"
+    "strconv"
+    "strings"
 
     corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/fields"
+    "k8s.io/apimachinery/pkg/labels"
+    "k8s.io/apimachinery/pkg/types"
     clientgoscheme "k8s.io/client-go/kubernetes/scheme"
     ctrl "sigs.k8s.io/controller-runtime"
+    "sigs.k8s.io/controller-runtime/pkg/cache"
+    "sigs.k8s.io/controller-runtime/pkg/client"
     mserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
     "sigs.k8s.io/controller-runtime/pkg/healthz"
     "sigs.k8s.io/controller-runtime/pkg/log/zap"
 
-    v1alpha1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1alpha1"
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
     "github.com/vaheed/kubeop/internal/operator/controllers"
-    api "github.com/vaheed/kubeop/internal/api"
+    "github.com/vaheed/kubeop/internal/operator/dnsprovider"
+    "github.com/vaheed/kubeop/internal/operator/issuer"
+    "github.com/vaheed/kubeop/internal/operator/source"
     "github.com/vaheed/kubeop/internal/version"
 )
 
@@ -23,23 +34,50 @@ func main() {
     var metricsAddr string
     var healthAddr string
     var leaderElect bool
+    var fileRepos bool
     flag.StringVar(&metricsAddr, "metrics-bind-address", ":8081", "metrics address")
     flag.StringVar(&healthAddr, "health-probe-bind-address", ":8082", "health address")
     flag.BoolVar(&leaderElect, "leader-elect", false, "enable leader election")
+    flag.BoolVar(&fileRepos, "allow-file-git-repos", false, "accept file:// Git repositories in Apps (testing only)")
     flag.Parse()
+    if fileRepos { source.AllowFileRepos() }
 
     ctrl.SetLogger(zap.New())
 
     scheme := clientgoscheme.Scheme
     _ = corev1.AddToScheme(scheme)
-    _ = v1alpha1.AddToScheme(scheme)
+    _ = v1beta1.AddToScheme(scheme)
 
+    appPods, err := labels.Parse("app.kubeop.io/app")
+    if err != nil { panic(err) }
+    managedSecrets, err := labels.Parse(controllers.ManagedSecretLabel)
+    if err != nil { panic(err) }
+    projectDefaults := os.Getenv("KUBEOP_PROJECT_DEFAULTS_CONFIGMAP")
+    if projectDefaults == "" { projectDefaults = "kubeop-project-defaults" }
     mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
         Scheme: scheme,
-        Metrics: mserver.Options{BindAddress: metricsAddr},
+        // /version is served next to /metrics
+        Metrics: mserver.Options{BindAddress: metricsAddr, ExtraHandlers: map[string]http.Handler{"/version": http.HandlerFunc(serveVersion)}},
         HealthProbeBindAddress: healthAddr,
         LeaderElection: leaderElect,
         LeaderElectionID: "kubeop-operator-leader",
+        // Apps watch their pods for rollout failures; other pods are not cached.
+        // Secrets are cached in the operator namespace, where Registry
+        // passwords live, and elsewhere only when the operator wrote them;
+        // the only ConfigMap read is the project defaults.
+        Cache: cache.Options{ByObject: map[client.Object]cache.ByObject{
+            &corev1.Pod{}: {Label: appPods},
+            &corev1.Secret{}: {Namespaces: map[string]cache.Config{
+                "kubeop-system":     {},
+                cache.AllNamespaces: {LabelSelector: managedSecrets},
+            }},
+            &corev1.ConfigMap{}: {Namespaces: map[string]cache.Config{
+                "kubeop-system": {FieldSelector: fields.OneTermEqualSelector("metadata.name", projectDefaults)},
+            }},
+        }},
+        // other Secrets, such as passwords in other namespaces, are read
+        // from the API server
+        Client: client.Options{Cache: &client.CacheOptions{DisableFor: []client.Object{&corev1.Secret{}}}},
     })
     if err != nil {
         panic(err)
@@ -49,31 +87,84 @@ func main() {
     _ = mgr.AddHealthzCheck("ping", healthz.Ping)
     _ = mgr.AddReadyzCheck("ready", healthz.Ping)
 
-    if err := (&controllers.TenantReconciler{Client: mgr.GetClient()}).SetupWithManager(mgr); err != nil { panic(err) }
-    if err := (&controllers.ProjectReconciler{Client: mgr.GetClient()}).SetupWithManager(mgr); err != nil { panic(err) }
-    if err := (&controllers.AppReconciler{Client: mgr.GetClient()}).SetupWithManager(mgr); err != nil { panic(err) }
-    dnsURL := os.Getenv("DNS_MOCK_URL")
-    acmeURL := os.Getenv("ACME_MOCK_URL")
-    if err := (&controllers.DNSRecordReconciler{Client: mgr.GetClient(), Endpoint: dnsURL}).SetupWithManager(mgr); err != nil { panic(err) }
-    if err := (&controllers.CertificateReconciler{Client: mgr.GetClient(), Endpoint: acmeURL}).SetupWithManager(mgr); err != nil { panic(err) }
-
-    // Sidecar HTTP server exposing version and metrics for convenience
-    go func() {
-        mux := http.NewServeMux()
-        mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
-            w.Header().Set("Content-Type", "application/json")
-            _ = json.NewEncoder(w).Encode(map[string]string{
-                "service":   "operator",
-                "version":   version.Version,
-                "gitCommit": version.Build,
-                "buildDate": version.BuildDate,
-            })
-        })
-        mux.Handle("/metrics", api.PromHandler())
-        _ = http.ListenAndServe(":8083", mux)
-    }()
+    // Events show reconcile outcomes in kubectl describe of kubeOP objects
+    recorder := mgr.GetEventRecorderFor("kubeop-operator")
+    if err := (&controllers.TenantReconciler{Client: mgr.GetClient(), Recorder: recorder}).SetupWithManager(mgr); err != nil { panic(err) }
+    // traffic to exposed Apps comes from the ingress controllers and from
+    // the namespace of a shared Gateway
+    var ingressNamespaces []string
+    for _, n := range strings.Split(os.Getenv("KUBEOP_INGRESS_NAMESPACES"), ",") {
+        if n = strings.TrimSpace(n); n != "" { ingressNamespaces = append(ingressNamespaces, n) }
+    }
+    if gns, _, ok := strings.Cut(os.Getenv("KUBEOP_GATEWAY"), "/"); ok { ingressNamespaces = append(ingressNamespaces, gns) }
+    if err := (&controllers.ProjectReconciler{
+        Client:            mgr.GetClient(),
+        Defaults:          types.NamespacedName{Namespace: "kubeop-system", Name: projectDefaults},
+        IngressNamespaces: ingressNamespaces,
+        Recorder:          recorder,
+    }).SetupWithManager(mgr); err != nil { panic(err) }
+    if err := (&controllers.PolicyReconciler{Client: mgr.GetClient(), Recorder: recorder}).SetupWithManager(mgr); err != nil { panic(err) }
+    if err := (&controllers.RegistryReconciler{Client: mgr.GetClient(), Recorder: recorder}).SetupWithManager(mgr); err != nil { panic(err) }
+    chartsDir := os.Getenv("KUBEOP_HELM_CHARTS_DIR")
+    if chartsDir == "" { chartsDir = "/charts" }
+    if err := (&controllers.AppReconciler{
+        Client:    mgr.GetClient(),
+        ChartsDir: chartsDir,
+        Expose: controllers.ExposeConfig{
+            Mode:         os.Getenv("KUBEOP_APP_ROUTING"),
+            IngressClass: os.Getenv("KUBEOP_INGRESS_CLASS"),
+            Gateway:      os.Getenv("KUBEOP_GATEWAY"),
+            Address:      os.Getenv("KUBEOP_INGRESS_ADDRESS"),
+        },
+        PrometheusURL: os.Getenv("KUBEOP_PROMETHEUS_URL"),
+        Recorder:      recorder,
+    }).SetupWithManager(mgr); err != nil { panic(err) }
+    dnsProvider, err := dnsprovider.FromEnv()
+    if err != nil { panic(err) }
+    if err := (&controllers.DNSRecordReconciler{Client: mgr.GetClient(), Provider: dnsProvider, Recorder: recorder}).SetupWithManager(mgr); err != nil { panic(err) }
+    // http-01 responses are served by every operator replica from a shared
+    // Secret; dns-01 needs a DNS provider that can publish TXT records
+    http01 := &issuer.HTTP01{Store: controllers.ChallengeSecret(mgr.GetClient(), mgr.GetAPIReader(), "kubeop-system")}
+    var dns01 issuer.Solver
+    if txt, ok := dnsProvider.(dnsprovider.TXTProvider); ok { dns01 = &issuer.DNS01{Provider: txt} }
+    certIssuer, err := issuer.FromEnv(controllers.AccountKeySecret(mgr.GetClient(), "kubeop-system"), http01, dns01)
+    if err != nil { panic(err) }
+    http01Addr := os.Getenv("KUBEOP_ACME_HTTP01_ADDR")
+    if http01Addr == "" { http01Addr = ":8089" }
+    _, http01Port, err := net.SplitHostPort(http01Addr)
+    if err != nil { panic(err) }
+    solverPort, err := strconv.ParseInt(http01Port, 10, 32)
+    if err != nil { panic(err) }
+    renewFraction := 0.0
+    if v := os.Getenv("KUBEOP_CERT_RENEW_FRACTION"); v != "" {
+        if renewFraction, err = strconv.ParseFloat(v, 64); err != nil || renewFraction <= 0 || renewFraction >= 1 {
+            panic(fmt.Sprintf("KUBEOP_CERT_RENEW_FRACTION must be between 0 and 1, got %q", v))
+        }
+    }
+    if err := (&controllers.CertificateReconciler{
+        Client:        mgr.GetClient(),
+        Issuer:        certIssuer,
+        RenewFraction: renewFraction,
+        Recorder:      recorder,
+        Solver:        controllers.SolverRoute{
+            Service:      os.Getenv("KUBEOP_ACME_SOLVER_SERVICE"),
+            Port:         int32(solverPort),
+            IngressClass: os.Getenv("KUBEOP_INGRESS_CLASS"),
+        },
+    }).SetupWithManager(mgr); err != nil { panic(err) }
+    go func() { _ = http.ListenAndServe(http01Addr, http01) }()
 
     if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
         os.Exit(1)
     }
 }
+
+func serveVersion(w http.ResponseWriter, _ *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(map[string]string{
+        "service":   "operator",
+        "version":   version.Version,
+        "gitCommit": version.Build,
+        "buildDate": version.BuildDate,
+    })
+}
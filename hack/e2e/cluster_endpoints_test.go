@@ -13,7 +13,7 @@ import (
 )
 
 // Test_ClusterEndpoints validates operator in-cluster endpoints via port-forward
-// It hits: /healthz (8082), /readyz (8082), /version (8083), /metrics (8081)
+// It hits: /healthz (8082), /readyz (8082), /version (8081), /metrics (8081)
 func Test_ClusterEndpoints(t *testing.T) {
     if os.Getenv("KUBEOP_E2E") == "" {
         t.Skip("KUBEOP_E2E not set")
@@ -36,10 +36,10 @@ func Test_ClusterEndpoints(t *testing.T) {
         time.Sleep(3 * time.Second)
     }
 
-    // Start port-forward for metrics:8081, health:8082, version:8083
+    // Start port-forward for metrics and version:8081, health:8082
     ctx, cancel := context.WithCancel(context.Background())
     defer cancel()
-    pf := exec.CommandContext(ctx, "bash", "-lc", "kubectl -n kubeop-system port-forward deploy/kubeop-operator 18081:8081 18082:8082 18083:8083")
+    pf := exec.CommandContext(ctx, "bash", "-lc", "kubectl -n kubeop-system port-forward deploy/kubeop-operator 18081:8081 18082:8082")
     pf.Stdout = io.Discard
     pf.Stderr = io.Discard
     if err := pf.Start(); err != nil {
@@ -70,7 +70,7 @@ func Test_ClusterEndpoints(t *testing.T) {
     }
 
     // version
-    if resp, err := httpc.Get("http://127.0.0.1:18083/version"); err == nil {
+    if resp, err := httpc.Get("http://127.0.0.1:18081/version"); err == nil {
         b, _ := io.ReadAll(resp.Body); resp.Body.Close()
         os.WriteFile(filepath.Join(outDir, "version.json"), b, 0o644)
         var v map[string]any
@@ -104,6 +104,7 @@ metadata:
   name: acme
 spec:
   name: acme
+  domains: ["web.local"]
 ---
 apiVersion: paas.kubeop.io/v1alpha1
 kind: Project
@@ -127,16 +128,18 @@ apiVersion: paas.kubeop.io/v1alpha1
 kind: DNSRecord
 metadata:
   name: web-local
+  namespace: kubeop-acme-web
 spec:
-  host: web.local
+  host: www.web.local
   target: web.kubeop-acme-web.svc.cluster.local
 ---
 apiVersion: paas.kubeop.io/v1alpha1
 kind: Certificate
 metadata:
   name: web-local
+  namespace: kubeop-acme-web
 spec:
-  host: web.local
+  host: www.web.local
   dnsRecordRef: web-local
 `
     cmd := exec.Command("bash", "-lc", "cat <<'YAML' | kubectl apply -f -\n"+yaml+"\nYAML")
@@ -157,14 +160,14 @@ spec:
     // check DNSRecord and Certificate Ready condition (poll up to 60s)
     ready := false
     for i := 0; i < 20; i++ {
-        out, err = exec.Command("bash", "-lc", "kubectl get dnsrecords.paas.kubeop.io web-local -o jsonpath='{.status.ready}'").CombinedOutput()
+        out, err = exec.Command("bash", "-lc", "kubectl -n kubeop-acme-web get dnsrecords.paas.kubeop.io web-local -o jsonpath='{.status.ready}'").CombinedOutput()
         if err == nil && bytes.Contains(out, []byte("true")) { ready = true; break }
         time.Sleep(3 * time.Second)
     }
     if !ready { t.Fatalf("dnsrecord not ready: %s", string(out)) }
     ready = false
     for i := 0; i < 20; i++ {
-        out, err = exec.Command("bash", "-lc", "kubectl get certificates.paas.kubeop.io web-local -o jsonpath='{.status.ready}'").CombinedOutput()
+        out, err = exec.Command("bash", "-lc", "kubectl -n kubeop-acme-web get certificates.paas.kubeop.io web-local -o jsonpath='{.status.ready}'").CombinedOutput()
         if err == nil && bytes.Contains(out, []byte("true")) { ready = true; break }
         time.Sleep(3 * time.Second)
     }
@@ -199,11 +202,11 @@ spec:
     exec.Command("bash", "-lc", "docker compose start db").Run()
     time.Sleep(10 * time.Second)
     // Verify no drift by re-checking Ready conditions
-    out, err = exec.Command("bash", "-lc", "kubectl get dnsrecords.paas.kubeop.io web-local -o jsonpath='{.status.ready}'").CombinedOutput()
+    out, err = exec.Command("bash", "-lc", "kubectl -n kubeop-acme-web get dnsrecords.paas.kubeop.io web-local -o jsonpath='{.status.ready}'").CombinedOutput()
     if err != nil || !bytes.Contains(out, []byte("true")) {
         t.Fatalf("dnsrecord not ready after recovery: %v %s", err, string(out))
     }
-    out, err = exec.Command("bash", "-lc", "kubectl get certificates.paas.kubeop.io web-local -o jsonpath='{.status.ready}'").CombinedOutput()
+    out, err = exec.Command("bash", "-lc", "kubectl -n kubeop-acme-web get certificates.paas.kubeop.io web-local -o jsonpath='{.status.ready}'").CombinedOutput()
     if err != nil || !bytes.Contains(out, []byte("true")) {
         t.Fatalf("certificate not ready after recovery: %v %s", err, string(out))
     }
@@ -0,0 +1,87 @@
+#!/usr/bin/env bash
+# Moves the DNSRecords and Certificates of an existing install from cluster
+# scope to namespace scope without losing them.
+#
+# The API server refuses to change the scope of an existing CRD, so
+# `kubectl apply -f deploy/k8s/crds/` fails on clusters that still have the
+# cluster-scoped versions. The CRDs have to be recreated, which deletes their
+# objects, so this script:
+#
+#   1. exports every DNSRecord and Certificate to $BACKUP,
+#   2. checks that each of them has a target namespace that exists: the
+#      namespace in its app.kubeop.io/namespace annotation, else $NAMESPACE,
+#   3. drops the DNSRecord finalizers, so the published DNS records stay in
+#      place, then deletes the two CRDs and applies the namespaced ones from
+#      $CRDS_DIR,
+#   4. creates the exported objects again in their target namespaces.
+#
+# Nothing is deleted unless every object has a target namespace. The status
+# is not restored; the operator fills it in again and the DNSRecords take
+# over their published records. If the import fails, e.g. because admission
+# rejects a host outside the tenant domains, fix the cause and run the script
+# again: with the CRDs already namespaced it only imports $BACKUP, which is
+# renamed to $BACKUP.imported once that succeeds.
+#
+# Run it with the operator scaled down, before upgrading it:
+#   kubectl -n kubeop-system scale deploy/kubeop-operator --replicas=0
+#   kubectl annotate dnsrecord web app.kubeop.io/namespace=kubeop-acme-web
+#   NAMESPACE=kubeop-acme-web hack/migrate-namespaced-crds.sh
+#   helm upgrade kubeop-operator charts/kubeop-operator -n kubeop-system
+set -euo pipefail
+
+KUBECTL=${KUBECTL:-kubectl}
+CRDS_DIR=${CRDS_DIR:-deploy/k8s/crds}
+BACKUP=${BACKUP:-kubeop-dns-crds-backup.json}
+NAMESPACE=${NAMESPACE:-}
+
+command -v jq >/dev/null || { echo "jq is required" >&2; exit 1; }
+
+migrate=()
+for plural in dnsrecords certificates; do
+  crd="${plural}.paas.kubeop.io"
+  scope=$($KUBECTL get crd "$crd" -o jsonpath='{.spec.scope}' 2>/dev/null || true)
+  if [ "$scope" = "Cluster" ]; then
+    migrate+=("$plural")
+  else
+    echo "$crd: ${scope:-not installed}, nothing to recreate"
+  fi
+done
+
+if [ ${#migrate[@]} -gt 0 ]; then
+  # export every object with the namespace it moves to
+  for plural in "${migrate[@]}"; do
+    $KUBECTL get "$plural.paas.kubeop.io" -o json
+  done | jq -s --arg ns "$NAMESPACE" '{apiVersion: "v1", kind: "List", items: [.[].items[]
+    | .metadata.namespace = (.metadata.annotations["app.kubeop.io/namespace"] // $ns)]}' > "$BACKUP"
+  echo "saved ${migrate[*]} to $BACKUP"
+
+  missing=$(jq -r '.items[] | select(.metadata.namespace == "") | "\(.kind)/\(.metadata.name)"' "$BACKUP")
+  if [ -n "$missing" ]; then
+    echo "no target namespace for:" >&2
+    echo "$missing" >&2
+    echo "annotate them with app.kubeop.io/namespace or set NAMESPACE; nothing was deleted" >&2
+    exit 1
+  fi
+  for ns in $(jq -r '[.items[].metadata.namespace] | unique | .[]' "$BACKUP"); do
+    $KUBECTL get namespace "$ns" >/dev/null || { echo "namespace $ns does not exist; nothing was deleted" >&2; exit 1; }
+  done
+
+  for plural in "${migrate[@]}"; do
+    for obj in $($KUBECTL get "$plural.paas.kubeop.io" -o name); do
+      $KUBECTL patch "$obj" --type=merge -p '{"metadata":{"finalizers":null}}' >/dev/null
+    done
+    $KUBECTL delete crd "$plural.paas.kubeop.io" --wait=true
+    $KUBECTL apply -f "$CRDS_DIR/paas.kubeop.io_$plural.yaml"
+  done
+  $KUBECTL wait --for condition=Established --timeout=60s $(printf 'crd/%s.paas.kubeop.io ' "${migrate[@]}")
+fi
+
+[ -f "$BACKUP" ] || exit 0
+# recreate the objects as v1beta1, which has the same fields, so no conversion
+# webhook is needed, without their server-set metadata, finalizers and status
+jq '.items |= map(.apiVersion = "paas.kubeop.io/v1beta1" | del(.status, .metadata.uid, .metadata.resourceVersion, .metadata.creationTimestamp,
+    .metadata.generation, .metadata.managedFields, .metadata.finalizers, .metadata.ownerReferences,
+    .metadata.annotations["app.kubeop.io/namespace"], .metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]))' "$BACKUP" \
+  | $KUBECTL apply -f -
+mv "$BACKUP" "$BACKUP.imported"
+echo "restored the objects from $BACKUP, kept as $BACKUP.imported"
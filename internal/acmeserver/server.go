@@ -0,0 +1,472 @@
+// Package acmeserver is a small in-memory ACME (RFC 8555) certificate
+// authority for tests and local clusters. It implements the subset of the
+// protocol kubeOP uses: accounts, orders, http-01 and dns-01 challenges,
+// finalization and certificate download. Request signatures are not
+// verified, so it must never be exposed as a real CA.
+package acmeserver
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "fmt"
+    "math/big"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Challenge types offered for every identifier.
+const (
+    HTTP01 = "http-01"
+    DNS01  = "dns-01"
+)
+
+// Validator checks a challenge. keyAuth is the key authorization the client
+// must serve over HTTP for http-01; for dns-01 the TXT record must hold
+// DNS01Value(keyAuth). A nil Validator accepts every challenge.
+type Validator func(typ, domain, token, keyAuth string) error
+
+// Server is an http.Handler serving the ACME API below its BaseURL.
+type Server struct {
+    // BaseURL is the externally visible URL of the handler, e.g.
+    // http://acme-mock:8080. Directory URLs are built from it.
+    BaseURL string
+    // Validate is called when a challenge is accepted.
+    Validate Validator
+    // Lifetime of issued certificates, 90 days when zero.
+    Lifetime time.Duration
+
+    once   sync.Once
+    mu     sync.Mutex
+    seq    int
+    caKey  *ecdsa.PrivateKey
+    caCert *x509.Certificate
+    // accounts maps account URLs to JWK thumbprints, byKey the reverse.
+    accounts map[string]string
+    byKey    map[string]string
+    orders   map[string]*order
+    authzs   map[string]*authz
+    certs    map[string][]byte
+}
+
+type order struct {
+    url     string
+    account string
+    status  string
+    ids     []identifier
+    authzs  []string
+    cert    string
+    problem *problem
+}
+
+type authz struct {
+    id         identifier
+    account    string
+    status     string
+    challenges []*challenge
+}
+
+type challenge struct {
+    Type   string   `json:"type"`
+    URL    string   `json:"url"`
+    Token  string   `json:"token"`
+    Status string   `json:"status"`
+    Error  *problem `json:"error,omitempty"`
+}
+
+type identifier struct {
+    Type  string `json:"type"`
+    Value string `json:"value"`
+}
+
+type problem struct {
+    Type   string `json:"type"`
+    Detail string `json:"detail"`
+    Status int    `json:"status,omitempty"`
+}
+
+// DNS01Value returns the TXT record value expected for keyAuth.
+func DNS01Value(keyAuth string) string {
+    sum := sha256.Sum256([]byte(keyAuth))
+    return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// CACertificate returns the PEM encoded root that signs issued certificates.
+func (s *Server) CACertificate() []byte {
+    s.init()
+    return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.caCert.Raw})
+}
+
+func (s *Server) init() {
+    s.once.Do(func() {
+        key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+        if err != nil { panic(err) }
+        tmpl := &x509.Certificate{
+            SerialNumber:          big.NewInt(1),
+            Subject:               pkix.Name{CommonName: "kubeOP test ACME root"},
+            NotBefore:             time.Now().Add(-time.Hour),
+            NotAfter:              time.Now().AddDate(10, 0, 0),
+            KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+            BasicConstraintsValid: true,
+            IsCA:                  true,
+        }
+        der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+        if err != nil { panic(err) }
+        s.caCert, _ = x509.ParseCertificate(der)
+        s.caKey = key
+        s.accounts = map[string]string{}
+        s.byKey = map[string]string{}
+        s.orders = map[string]*order{}
+        s.authzs = map[string]*authz{}
+        s.certs = map[string][]byte{}
+    })
+}
+
+func (s *Server) url(path string) string { return strings.TrimRight(s.BaseURL, "/") + path }
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    s.init()
+    w.Header().Set("Replay-Nonce", s.nonce())
+    switch path := r.URL.Path; {
+    case path == "/directory":
+        writeJSON(w, http.StatusOK, map[string]string{
+            "newNonce":   s.url("/new-nonce"),
+            "newAccount": s.url("/new-account"),
+            "newOrder":   s.url("/new-order"),
+            "revokeCert": s.url("/revoke-cert"),
+            "keyChange":  s.url("/key-change"),
+        })
+    case path == "/new-nonce":
+        w.WriteHeader(http.StatusOK)
+    case r.Method != http.MethodPost:
+        writeProblem(w, http.StatusMethodNotAllowed, "malformed", "POST required")
+    default:
+        req, err := parseJWS(r)
+        if err != nil {
+            writeProblem(w, http.StatusBadRequest, "malformed", err.Error())
+            return
+        }
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        if path == "/new-account" {
+            s.newAccount(w, req)
+            return
+        }
+        if _, ok := s.accounts[req.kid]; !ok {
+            writeProblem(w, http.StatusBadRequest, "accountDoesNotExist", "unknown account "+req.kid)
+            return
+        }
+        switch {
+        case path == "/new-order":
+            s.newOrder(w, req)
+        case strings.HasPrefix(path, "/authz/"):
+            s.getAuthz(w, req, s.url(path))
+        case strings.HasPrefix(path, "/chall/"):
+            s.acceptChallenge(w, req, s.url(path))
+        case strings.HasPrefix(path, "/finalize/"):
+            s.finalize(w, req, s.url("/order/"+strings.TrimPrefix(path, "/finalize/")))
+        case strings.HasPrefix(path, "/order/"):
+            s.getOrder(w, req, s.url(path))
+        case strings.HasPrefix(path, "/cert/"):
+            s.getCert(w, req, s.url(path))
+        default:
+            writeProblem(w, http.StatusNotFound, "malformed", "unknown resource "+path)
+        }
+    }
+}
+
+func (s *Server) newAccount(w http.ResponseWriter, req *jwsRequest) {
+    var body struct {
+        Contact            []string `json:"contact"`
+        OnlyReturnExisting bool     `json:"onlyReturnExisting"`
+    }
+    _ = json.Unmarshal(req.payload, &body)
+    if req.thumbprint == "" {
+        writeProblem(w, http.StatusBadRequest, "malformed", "newAccount requires a jwk")
+        return
+    }
+    resp := map[string]any{"status": "valid", "contact": body.Contact}
+    if acct, ok := s.byKey[req.thumbprint]; ok {
+        w.Header().Set("Location", acct)
+        writeJSON(w, http.StatusOK, resp)
+        return
+    }
+    if body.OnlyReturnExisting {
+        writeProblem(w, http.StatusBadRequest, "accountDoesNotExist", "no account for this key")
+        return
+    }
+    acct := s.url(fmt.Sprintf("/account/%d", s.next()))
+    s.accounts[acct] = req.thumbprint
+    s.byKey[req.thumbprint] = acct
+    w.Header().Set("Location", acct)
+    writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) newOrder(w http.ResponseWriter, req *jwsRequest) {
+    var body struct {
+        Identifiers []identifier `json:"identifiers"`
+    }
+    if err := json.Unmarshal(req.payload, &body); err != nil || len(body.Identifiers) == 0 {
+        writeProblem(w, http.StatusBadRequest, "malformed", "identifiers are required")
+        return
+    }
+    o := &order{url: s.url(fmt.Sprintf("/order/%d", s.next())), account: req.kid, status: "pending", ids: body.Identifiers}
+    for _, id := range body.Identifiers {
+        if id.Type != "dns" {
+            writeProblem(w, http.StatusBadRequest, "unsupportedIdentifier", "only dns identifiers are supported")
+            return
+        }
+        az := &authz{id: id, account: req.kid, status: "pending"}
+        for _, typ := range []string{HTTP01, DNS01} {
+            az.challenges = append(az.challenges, &challenge{Type: typ, URL: s.url(fmt.Sprintf("/chall/%d", s.next())), Token: randomToken(), Status: "pending"})
+        }
+        u := s.url(fmt.Sprintf("/authz/%d", s.next()))
+        s.authzs[u] = az
+        o.authzs = append(o.authzs, u)
+    }
+    s.orders[o.url] = o
+    w.Header().Set("Location", o.url)
+    writeJSON(w, http.StatusCreated, s.orderJSON(o))
+}
+
+func (s *Server) getAuthz(w http.ResponseWriter, req *jwsRequest, u string) {
+    az, ok := s.authzs[u]
+    if !ok || az.account != req.kid {
+        writeProblem(w, http.StatusNotFound, "malformed", "no such authorization")
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]any{"identifier": az.id, "status": az.status, "challenges": az.challenges})
+}
+
+// acceptChallenge validates synchronously, so the authorization is final
+// by the time the client polls it.
+func (s *Server) acceptChallenge(w http.ResponseWriter, req *jwsRequest, u string) {
+    for _, az := range s.authzs {
+        if az.account != req.kid { continue }
+        for _, ch := range az.challenges {
+            if ch.URL != u { continue }
+            if ch.Status == "pending" {
+                keyAuth := ch.Token + "." + s.accounts[req.kid]
+                ch.Status, az.status = "valid", "valid"
+                if s.Validate != nil {
+                    // the validator may call back into the client, so it
+                    // must not run under the lock
+                    s.mu.Unlock()
+                    err := s.Validate(ch.Type, az.id.Value, ch.Token, keyAuth)
+                    s.mu.Lock()
+                    if err != nil {
+                        ch.Status, az.status = "invalid", "invalid"
+                        ch.Error = &problem{Type: "urn:ietf:params:acme:error:unauthorized", Detail: err.Error(), Status: http.StatusForbidden}
+                    }
+                }
+                s.updateOrders()
+            }
+            writeJSON(w, http.StatusOK, ch)
+            return
+        }
+    }
+    writeProblem(w, http.StatusNotFound, "malformed", "no such challenge")
+}
+
+// updateOrders moves pending orders to ready or invalid once all of their
+// authorizations are final.
+func (s *Server) updateOrders() {
+    for _, o := range s.orders {
+        if o.status != "pending" { continue }
+        ready := true
+        for _, u := range o.authzs {
+            switch s.authzs[u].status {
+            case "invalid":
+                o.status = "invalid"
+                o.problem = &problem{Type: "urn:ietf:params:acme:error:unauthorized", Detail: "authorization for " + s.authzs[u].id.Value + " failed"}
+            case "pending":
+                ready = false
+            }
+        }
+        if ready && o.status == "pending" { o.status = "ready" }
+    }
+}
+
+func (s *Server) finalize(w http.ResponseWriter, req *jwsRequest, u string) {
+    o, ok := s.orders[u]
+    if !ok || o.account != req.kid {
+        writeProblem(w, http.StatusNotFound, "malformed", "no such order")
+        return
+    }
+    if o.status != "ready" {
+        writeProblem(w, http.StatusForbidden, "orderNotReady", "order is "+o.status)
+        return
+    }
+    var body struct {
+        CSR string `json:"csr"`
+    }
+    _ = json.Unmarshal(req.payload, &body)
+    der, err := base64.RawURLEncoding.DecodeString(body.CSR)
+    if err != nil {
+        writeProblem(w, http.StatusBadRequest, "badCSR", err.Error())
+        return
+    }
+    csr, err := x509.ParseCertificateRequest(der)
+    if err == nil { err = csr.CheckSignature() }
+    if err != nil {
+        writeProblem(w, http.StatusBadRequest, "badCSR", err.Error())
+        return
+    }
+    if !sameNames(csr.DNSNames, o.ids) {
+        writeProblem(w, http.StatusBadRequest, "badCSR", "CSR names do not match the order")
+        return
+    }
+    chain, err := s.sign(csr)
+    if err != nil {
+        writeProblem(w, http.StatusInternalServerError, "serverInternal", err.Error())
+        return
+    }
+    o.cert = s.url(fmt.Sprintf("/cert/%d", s.next()))
+    o.status = "valid"
+    s.certs[o.cert] = chain
+    w.Header().Set("Location", o.url)
+    writeJSON(w, http.StatusOK, s.orderJSON(o))
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, req *jwsRequest, u string) {
+    o, ok := s.orders[u]
+    if !ok || o.account != req.kid {
+        writeProblem(w, http.StatusNotFound, "malformed", "no such order")
+        return
+    }
+    w.Header().Set("Location", o.url)
+    writeJSON(w, http.StatusOK, s.orderJSON(o))
+}
+
+func (s *Server) getCert(w http.ResponseWriter, _ *jwsRequest, u string) {
+    chain, ok := s.certs[u]
+    if !ok {
+        writeProblem(w, http.StatusNotFound, "malformed", "no such certificate")
+        return
+    }
+    w.Header().Set("Content-Type", "application/pem-certificate-chain")
+    w.WriteHeader(http.StatusOK)
+    w.Write(chain)
+}
+
+func (s *Server) orderJSON(o *order) map[string]any {
+    m := map[string]any{
+        "status":         o.status,
+        "identifiers":    o.ids,
+        "authorizations": o.authzs,
+        "finalize":       strings.Replace(o.url, "/order/", "/finalize/", 1),
+    }
+    if o.cert != "" { m["certificate"] = o.cert }
+    if o.problem != nil { m["error"] = o.problem }
+    return m
+}
+
+// sign issues a leaf for the CSR and returns it followed by the root.
+func (s *Server) sign(csr *x509.CertificateRequest) ([]byte, error) {
+    lifetime := s.Lifetime
+    if lifetime == 0 { lifetime = 90 * 24 * time.Hour }
+    now := time.Now().Truncate(time.Second)
+    tmpl := &x509.Certificate{
+        SerialNumber: big.NewInt(int64(s.next())),
+        Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+        DNSNames:     csr.DNSNames,
+        NotBefore:    now,
+        NotAfter:     now.Add(lifetime),
+        KeyUsage:     x509.KeyUsageDigitalSignature,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, s.caCert, csr.PublicKey, s.caKey)
+    if err != nil { return nil, err }
+    out := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+    return append(out, s.CACertificate()...), nil
+}
+
+func (s *Server) next() int {
+    s.seq++
+    return s.seq
+}
+
+func (s *Server) nonce() string { return randomToken() }
+
+func sameNames(names []string, ids []identifier) bool {
+    if len(names) != len(ids) { return false }
+    want := map[string]bool{}
+    for _, id := range ids { want[strings.ToLower(id.Value)] = true }
+    for _, n := range names {
+        if !want[strings.ToLower(n)] { return false }
+    }
+    return true
+}
+
+func randomToken() string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// jwsRequest is a decoded, unverified JWS request body.
+type jwsRequest struct {
+    kid        string
+    thumbprint string
+    payload    []byte
+}
+
+func parseJWS(r *http.Request) (*jwsRequest, error) {
+    var body struct {
+        Protected string `json:"protected"`
+        Payload   string `json:"payload"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&body); err != nil { return nil, fmt.Errorf("decode jws: %w", err) }
+    raw, err := base64.RawURLEncoding.DecodeString(body.Protected)
+    if err != nil { return nil, fmt.Errorf("decode protected header: %w", err) }
+    var hdr struct {
+        KID string          `json:"kid"`
+        JWK json.RawMessage `json:"jwk"`
+    }
+    if err := json.Unmarshal(raw, &hdr); err != nil { return nil, fmt.Errorf("decode protected header: %w", err) }
+    payload, err := base64.RawURLEncoding.DecodeString(body.Payload)
+    if err != nil { return nil, fmt.Errorf("decode payload: %w", err) }
+    req := &jwsRequest{kid: hdr.KID, payload: payload}
+    if len(hdr.JWK) > 0 {
+        if req.thumbprint, err = thumbprint(hdr.JWK); err != nil { return nil, err }
+    }
+    return req, nil
+}
+
+// thumbprint computes the RFC 7638 thumbprint of an EC or RSA JWK, matching
+// acme.JWKThumbprint on the client side.
+func thumbprint(jwk json.RawMessage) (string, error) {
+    var k map[string]string
+    if err := json.Unmarshal(jwk, &k); err != nil { return "", fmt.Errorf("decode jwk: %w", err) }
+    var canonical string
+    switch k["kty"] {
+    case "EC":
+        canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k["crv"], k["x"], k["y"])
+    case "RSA":
+        canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k["e"], k["n"])
+    default:
+        return "", fmt.Errorf("unsupported jwk type %q", k["kty"])
+    }
+    sum := sha256.Sum256([]byte(canonical))
+    return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
+
+func writeProblem(w http.ResponseWriter, status int, typ, detail string) {
+    w.Header().Set("Content-Type", "application/problem+json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(problem{Type: "urn:ietf:params:acme:error:" + typ, Detail: detail, Status: status})
+}
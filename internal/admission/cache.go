@@ -0,0 +1,106 @@
+package admission
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "k8s.io/client-go/discovery"
+    "k8s.io/client-go/dynamic"
+    "k8s.io/client-go/dynamic/dynamicinformer"
+    "k8s.io/client-go/tools/cache"
+)
+
+// Registries are looked up on every App admission and the kinds claiming
+// hosts on every admission of one of them, so they are served from
+// informers instead of being listed per request.
+var (
+    registriesGVR   = schema.GroupVersionResource{Group: "paas.kubeop.io", Version: "v1beta1", Resource: "registries"}
+    appsGVR         = schema.GroupVersionResource{Group: "paas.kubeop.io", Version: "v1beta1", Resource: "apps"}
+    dnsRecordsGVR   = schema.GroupVersionResource{Group: "paas.kubeop.io", Version: "v1beta1", Resource: "dnsrecords"}
+    certificatesGVR = schema.GroupVersionResource{Group: "paas.kubeop.io", Version: "v1beta1", Resource: "certificates"}
+    ingressesGVR    = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+    httpRoutesGVR   = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+)
+
+// hostIndex indexes cached objects by their lower-cased hosts.
+const hostIndex = "host"
+
+// hostIndexers holds the informer indexes filled by StartInformers. It is
+// only read once synced is set.
+var (
+    hostIndexers = map[schema.GroupVersionResource]cache.Indexer{}
+    synced       atomic.Bool
+)
+
+// hostKeys indexes objects by the hosts returned by hosts.
+func hostKeys(hosts func(map[string]any) []string) cache.IndexFunc {
+    return func(obj any) ([]string, error) {
+        u, ok := obj.(*unstructured.Unstructured)
+        if !ok { return nil, nil }
+        keys := hosts(u.Object)
+        for i := range keys { keys[i] = strings.ToLower(keys[i]) }
+        return keys, nil
+    }
+}
+
+// GatewayAPIServed reports whether the API server serves HTTPRoutes, whose
+// hosts are only checked when it does.
+func GatewayAPIServed(dc discovery.DiscoveryInterface) bool {
+    list, err := dc.ServerResourcesForGroupVersion(httpRoutesGVR.GroupVersion().String())
+    if err != nil { return false }
+    for _, r := range list.APIResources {
+        if r.Name == httpRoutesGVR.Resource { return true }
+    }
+    return false
+}
+
+// StartInformers starts the informers admission lookups are served from and
+// waits until their caches are filled. Listing v1beta1 objects still stored
+// as v1alpha1 goes through this server's /convert, so it runs while requests
+// are served; until it returns, CachesSynced is false. HTTPRoutes are only
+// watched with gatewayAPI set.
+func StartInformers(ctx context.Context, dc dynamic.Interface, gatewayAPI bool) error {
+    f := dynamicinformer.NewDynamicSharedInformerFactory(dc, 10*time.Minute)
+    indexers := map[schema.GroupVersionResource]cache.IndexFunc{registriesGVR: hostKeys(specHosts)}
+    for _, k := range hostKinds {
+        if k.gvr == httpRoutesGVR && !gatewayAPI { continue }
+        indexers[k.gvr] = hostKeys(k.hosts)
+    }
+    gvrs := make([]schema.GroupVersionResource, 0, len(indexers))
+    for gvr, keys := range indexers {
+        if err := f.ForResource(gvr).Informer().AddIndexers(cache.Indexers{hostIndex: keys}); err != nil { return err }
+        gvrs = append(gvrs, gvr)
+    }
+    f.Start(ctx.Done())
+    for gvr, ok := range f.WaitForCacheSync(ctx.Done()) {
+        if !ok { return fmt.Errorf("%s cache did not sync", gvr.Resource) }
+    }
+    for _, gvr := range gvrs {
+        hostIndexers[gvr] = f.ForResource(gvr).Informer().GetIndexer()
+    }
+    synced.Store(true)
+    return nil
+}
+
+// CachesSynced reports whether StartInformers has filled the caches.
+func CachesSynced() bool { return synced.Load() }
+
+// byHost returns the cached objects of gvr whose spec.host is host, ignoring
+// case. Nothing is found before the caches are synced.
+func byHost(gvr schema.GroupVersionResource, host string) []*unstructured.Unstructured {
+    if !CachesSynced() { return nil }
+    idx, ok := hostIndexers[gvr]
+    if !ok { return nil }
+    items, err := idx.ByIndex(hostIndex, strings.ToLower(host))
+    if err != nil { return nil }
+    out := make([]*unstructured.Unstructured, 0, len(items))
+    for _, item := range items {
+        if u, ok := item.(*unstructured.Unstructured); ok { out = append(out, u) }
+    }
+    return out
+}
@@ -0,0 +1,55 @@
+package admission
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    admissionv1 "k8s.io/api/admission/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// listKinds lets the fake dynamic client list every informer resource.
+var listKinds = map[schema.GroupVersionResource]string{
+    registriesGVR: "RegistryList", appsGVR: "AppList", dnsRecordsGVR: "DNSRecordList", certificatesGVR: "CertificateList",
+    ingressesGVR: "IngressList", httpRoutesGVR: "HTTPRouteList",
+}
+
+func Test_registeredRegistry(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    reg := &unstructured.Unstructured{Object: map[string]any{
+        "apiVersion": "paas.kubeop.io/v1beta1", "kind": "Registry",
+        "metadata": map[string]any{"name": "ghcr"},
+        "spec":     map[string]any{"host": "GHCR.io"},
+    }}
+    dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, reg)
+    if err := StartInformers(ctx, dc, true); err != nil { t.Fatal(err) }
+    if !registeredRegistry("ghcr.io") { t.Fatalf("expected ghcr.io to be registered") }
+    if registeredRegistry("quay.io") { t.Fatalf("unexpected registry quay.io") }
+}
+
+func Test_ServeValidateBeforeSync(t *testing.T) {
+    defer synced.Store(synced.Load())
+    synced.Store(false)
+    review := admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+        UID:       "1",
+        Kind:      metav1.GroupVersionKind{Group: "paas.kubeop.io", Version: "v1beta1", Kind: "DNSRecord"},
+        Namespace: "kubeop-acme-web",
+        Name:      "web",
+        Object:    runtime.RawExtension{Raw: []byte(`{"spec":{"host":"web.acme.example.com","target":"203.0.113.7"}}`)},
+    }}
+    body, _ := json.Marshal(review)
+    rec := httptest.NewRecorder()
+    ServeValidate(rec, httptest.NewRequest("POST", "/validate", bytes.NewReader(body)))
+    var out admissionv1.AdmissionReview
+    if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil { t.Fatal(err) }
+    if out.Response.Allowed || !strings.Contains(out.Response.Result.Message, "not synced") { t.Fatalf("expected the request to be denied until the caches are synced, got %+v", out.Response) }
+}
@@ -0,0 +1,55 @@
+package admission
+
+import (
+    "context"
+    "net/http"
+
+    apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+    apiextclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+    "k8s.io/apimachinery/pkg/api/equality"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+    v1alpha1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1alpha1"
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// convertedCRDs are the paas.kubeop.io CRDs served in more than one version.
+var convertedCRDs = []string{"tenants", "projects", "apps", "policies", "registries", "dnsrecords", "certificates"}
+
+// ConvertHandler answers the ConversionReviews of the paas.kubeop.io CRDs.
+// Objects convert between v1alpha1 and the v1beta1 hub.
+func ConvertHandler() http.Handler {
+    s := runtime.NewScheme()
+    _ = v1alpha1.AddToScheme(s)
+    _ = v1beta1.AddToScheme(s)
+    return conversion.NewWebhookHandler(s)
+}
+
+// EnsureConversion points the conversion of the paas.kubeop.io CRDs at the
+// /convert path of Service ns/svc, which presents a certificate signed by ca.
+// Applying the CRDs from deploy/k8s/crds resets them to the None strategy, so
+// it is run periodically; CRDs already set up are left alone.
+func EnsureConversion(ctx context.Context, cs apiextclient.Interface, ns, svc string, ca []byte) error {
+    path, port := "/convert", int32(443)
+    want := &apiextv1.CustomResourceConversion{
+        Strategy: apiextv1.WebhookConverter,
+        Webhook: &apiextv1.WebhookConversion{
+            ClientConfig: &apiextv1.WebhookClientConfig{
+                Service:  &apiextv1.ServiceReference{Namespace: ns, Name: svc, Path: &path, Port: &port},
+                CABundle: ca,
+            },
+            ConversionReviewVersions: []string{"v1"},
+        },
+    }
+    crds := cs.ApiextensionsV1().CustomResourceDefinitions()
+    for _, plural := range convertedCRDs {
+        crd, err := crds.Get(ctx, plural+"."+v1beta1.GroupVersion.Group, metav1.GetOptions{})
+        if err != nil { return err }
+        if equality.Semantic.DeepEqual(crd.Spec.Conversion, want) { continue }
+        crd.Spec.Conversion = want
+        if _, err := crds.Update(ctx, crd, metav1.UpdateOptions{}); err != nil { return err }
+    }
+    return nil
+}
@@ -0,0 +1,59 @@
+package admission
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "net/http/httptest"
+    "testing"
+
+    apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+    apiextfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/types"
+)
+
+func Test_ConvertHandler(t *testing.T) {
+    app := `{"apiVersion":"paas.kubeop.io/v1alpha1","kind":"App","metadata":{"name":"web","namespace":"kubeop-acme-web"},"spec":{"type":"Image","image":"nginx:1.27","replicas":2}}`
+    review := apiextv1.ConversionReview{
+        TypeMeta: metav1.TypeMeta{APIVersion: "apiextensions.k8s.io/v1", Kind: "ConversionReview"},
+        Request:  &apiextv1.ConversionRequest{UID: types.UID("1"), DesiredAPIVersion: "paas.kubeop.io/v1beta1", Objects: []runtime.RawExtension{{Raw: []byte(app)}}},
+    }
+    body, _ := json.Marshal(review)
+    rec := httptest.NewRecorder()
+    ConvertHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/convert", bytes.NewReader(body)))
+    var out apiextv1.ConversionReview
+    if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil { t.Fatalf("decode %q: %v", rec.Body.String(), err) }
+    if out.Response == nil || out.Response.Result.Status != metav1.StatusSuccess || len(out.Response.ConvertedObjects) != 1 { t.Fatalf("unexpected response %s", rec.Body.String()) }
+    var got struct {
+        APIVersion string `json:"apiVersion"`
+        Spec       struct {
+            Image    string `json:"image"`
+            Replicas int32  `json:"replicas"`
+        } `json:"spec"`
+    }
+    if err := json.Unmarshal(out.Response.ConvertedObjects[0].Raw, &got); err != nil { t.Fatal(err) }
+    if got.APIVersion != "paas.kubeop.io/v1beta1" || got.Spec.Image != "nginx:1.27" || got.Spec.Replicas != 2 { t.Fatalf("unexpected object %+v", got) }
+}
+
+func Test_EnsureConversion(t *testing.T) {
+    ctx := context.Background()
+    var objs []runtime.Object
+    for _, plural := range convertedCRDs {
+        objs = append(objs, &apiextv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: plural + ".paas.kubeop.io"}, Spec: apiextv1.CustomResourceDefinitionSpec{Conversion: &apiextv1.CustomResourceConversion{Strategy: apiextv1.NoneConverter}}})
+    }
+    cs := apiextfake.NewSimpleClientset(objs...)
+    if err := EnsureConversion(ctx, cs, "kubeop-system", "kubeop-admission", []byte("ca")); err != nil { t.Fatal(err) }
+    crd, err := cs.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, "apps.paas.kubeop.io", metav1.GetOptions{})
+    if err != nil { t.Fatal(err) }
+    conv := crd.Spec.Conversion
+    if conv.Strategy != apiextv1.WebhookConverter || conv.Webhook.ClientConfig.Service.Name != "kubeop-admission" || *conv.Webhook.ClientConfig.Service.Path != "/convert" || string(conv.Webhook.ClientConfig.CABundle) != "ca" { t.Fatalf("unexpected conversion %+v", conv) }
+
+    // CRDs already converting through the webhook are not updated again
+    cs.ClearActions()
+    if err := EnsureConversion(ctx, cs, "kubeop-system", "kubeop-admission", []byte("ca")); err != nil { t.Fatal(err) }
+    for _, a := range cs.Actions() {
+        if a.GetVerb() == "update" { t.Fatalf("unexpected update of %v", a.GetResource()) }
+    }
+}
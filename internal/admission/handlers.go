@@ -16,9 +16,12 @@ import (
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
     schema "k8s.io/apimachinery/pkg/runtime/schema"
     "k8s.io/apimachinery/pkg/api/resource"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
     "k8s.io/client-go/dynamic"
     "k8s.io/client-go/kubernetes"
     "k8s.io/client-go/rest"
+
+    kubeutil "github.com/vaheed/kubeop/internal/kube"
 )
 
 var (
@@ -79,13 +82,39 @@ func ServeMutate(w http.ResponseWriter, r *http.Request) {
 func ServeValidate(w http.ResponseWriter, r *http.Request) {
     admit := func(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
         resp := &admissionv1.AdmissionResponse{UID: ar.Request.UID, Allowed: true}
+        // hosts must belong to the tenant and to no other namespace; only
+        // added hosts are checked so finalizers can always be removed
+        if k := hostKindOf(ar.Request.Kind.Group, ar.Request.Kind.Kind); k != nil {
+            for _, host := range addedHosts(k, ar.Request.Object.Raw, ar.Request.OldObject.Raw) {
+                if !CachesSynced() { return notReady(resp) }
+                if msg := hostViolation(k.kind, ar.Request.Namespace, ar.Request.Name, host); msg != "" {
+                    resp.Allowed = false
+                    resp.Result = &metav1.Status{Message: k.field + ": " + msg}
+                    return resp
+                }
+            }
+        }
         // Validate image allowlist and cross-tenant via namespace labels for Apps
         if ar.Request.Kind.Group == "paas.kubeop.io" && strings.EqualFold(ar.Request.Kind.Kind, "App") {
-            var obj struct{ Metadata struct{ Namespace string `json:"namespace"` }; Spec struct{ Image string `json:"image"` } }
+            var obj struct{ Metadata struct{ Namespace string `json:"namespace"` }; Spec struct{
+                Image       string                      `json:"image"`
+                Resources   corev1.ResourceRequirements `json:"resources"`
+                Autoscaling *struct{ MaxReplicas int32 `json:"maxReplicas"` } `json:"autoscaling"`
+                Strategy    *struct{ Type string `json:"type"` } `json:"strategy"`
+                Volumes     []struct{ Name string `json:"name"` } `json:"volumes"`
+            } }
             if err := json.Unmarshal(ar.Request.Object.Raw, &obj); err == nil {
+                // canary and blue-green candidates run next to the stable pods,
+                // which hold the ReadWriteOnce claims the candidates would need
+                if obj.Spec.Strategy != nil && len(obj.Spec.Volumes) > 0 && (obj.Spec.Strategy.Type == "Canary" || obj.Spec.Strategy.Type == "BlueGreen") {
+                    resp.Allowed = false
+                    resp.Result = &metav1.Status{Message: fmt.Sprintf("spec.volumes: volumes cannot be combined with %s delivery, as its candidate pods could not attach the claims of the stable pods", obj.Spec.Strategy.Type)}
+                    return resp
+                }
                 // image allowlist
                 if host := imageHost(obj.Spec.Image); host != "" {
                     if !allowedRegistry(host) {
+                        if !CachesSynced() { return notReady(resp) }
                         resp.Allowed = false
                         resp.Result = &metav1.Status{Message: fmt.Sprintf("registry %s is not allowed", host)}
                         return resp
@@ -104,18 +133,44 @@ func ServeValidate(w http.ResponseWriter, r *http.Request) {
                         }
                     }
                 }
+                // the autoscaling maximum must fit into the project quota
+                if obj.Spec.Autoscaling != nil && obj.Metadata.Namespace != "" {
+                    if msg := autoscalingQuotaViolation(obj.Metadata.Namespace, obj.Spec.Autoscaling.MaxReplicas, obj.Spec.Resources); msg != "" {
+                        resp.Allowed = false
+                        resp.Result = &metav1.Status{Message: "spec.autoscaling.maxReplicas: " + msg}
+                        return resp
+                    }
+                }
             }
         }
         if ar.Request.Kind.Group == "paas.kubeop.io" && strings.EqualFold(ar.Request.Kind.Kind, "Project") {
-            var obj struct{ Spec struct{ TenantRef string `json:"tenantRef"` } }
+            var obj struct{ Spec struct{
+                TenantRef      string              `json:"tenantRef"`
+                Quota          corev1.ResourceList `json:"quota"`
+                DefaultRequest corev1.ResourceList `json:"defaultRequest"`
+                DefaultLimit   corev1.ResourceList `json:"defaultLimit"`
+            } }
             if err := json.Unmarshal(ar.Request.Object.Raw, &obj); err == nil {
                 if obj.Spec.TenantRef == "" {
                     resp.Allowed = false
                     resp.Result = &metav1.Status{Message: "spec.tenantRef is required"}
                     return resp
                 }
+                // the quota ceilings apply to project quotas before they reach a namespace
+                if msg := quotaCeilingViolation(obj.Spec.Quota); msg != "" {
+                    resp.Allowed = false
+                    resp.Result = &metav1.Status{Message: "spec.quota: " + msg}
+                    return resp
+                }
+                for name, req := range obj.Spec.DefaultRequest {
+                    if lim, ok := obj.Spec.DefaultLimit[name]; ok && req.Cmp(lim) > 0 {
+                        resp.Allowed = false
+                        resp.Result = &metav1.Status{Message: fmt.Sprintf("spec.defaultRequest %s exceeds spec.defaultLimit", name)}
+                        return resp
+                    }
+                }
                 // tenant existence check is best-effort; ignore error
-                gvr := schema.GroupVersionResource{Group: "paas.kubeop.io", Version: "v1alpha1", Resource: "tenants"}
+                gvr := schema.GroupVersionResource{Group: "paas.kubeop.io", Version: "v1beta1", Resource: "tenants"}
                 _, err := dyn().Resource(gvr).Get(context.Background(), obj.Spec.TenantRef, metav1.GetOptions{})
                 if err != nil {
                     resp.Allowed = false
@@ -163,17 +218,16 @@ func ServeValidate(w http.ResponseWriter, r *http.Request) {
                     resp.Result = &metav1.Status{Message: "resourcequota must set requests.cpu and requests.memory"}
                     return resp
                 }
-                if maxCPU := os.Getenv("KUBEOP_QUOTA_MAX_REQUESTS_CPU"); maxCPU != "" {
-                    if !quantityLEQ(rl[corev1.ResourceRequestsCPU], maxCPU) {
-                        resp.Allowed = false
-                        resp.Result = &metav1.Status{Message: fmt.Sprintf("requests.cpu exceeds maximum %s", maxCPU)}
-                        return resp
-                    }
+                if msg := quotaCeilingViolation(rl); msg != "" {
+                    resp.Allowed = false
+                    resp.Result = &metav1.Status{Message: msg}
+                    return resp
                 }
-                if maxMem := os.Getenv("KUBEOP_QUOTA_MAX_REQUESTS_MEMORY"); maxMem != "" {
-                    if !quantityLEQ(rl[corev1.ResourceRequestsMemory], maxMem) {
+                // project quotas must fit the tenant's spec.limits when set
+                if rq.Name == "kubeop-quota" {
+                    if msg := tenantLimitViolation(ar.Request.Namespace, rl); msg != "" {
                         resp.Allowed = false
-                        resp.Result = &metav1.Status{Message: fmt.Sprintf("requests.memory exceeds maximum %s", maxMem)}
+                        resp.Result = &metav1.Status{Message: msg}
                         return resp
                     }
                 }
@@ -210,6 +264,14 @@ func ServeValidate(w http.ResponseWriter, r *http.Request) {
     serve(w, r, admit)
 }
 
+// notReady denies a request whose checks need the informer caches while they
+// are still being filled, rather than admitting it unchecked.
+func notReady(resp *admissionv1.AdmissionResponse) *admissionv1.AdmissionResponse {
+    resp.Allowed = false
+    resp.Result = &metav1.Status{Message: "admission caches are not synced yet, retry shortly", Code: http.StatusServiceUnavailable}
+    return resp
+}
+
 func serve(w http.ResponseWriter, r *http.Request, f func(admissionv1.AdmissionReview) *admissionv1.AdmissionResponse) {
     var review admissionv1.AdmissionReview
     if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
@@ -235,7 +297,13 @@ func allowedRegistry(host string) bool {
     for _, a := range strings.Split(allow, ",") {
         if strings.EqualFold(strings.TrimSpace(a), host) { return true }
     }
-    return false
+    return registeredRegistry(host)
+}
+
+// registeredRegistry reports whether a Registry object declares host; those
+// hosts are allowed on top of KUBEOP_IMAGE_ALLOWLIST.
+func registeredRegistry(host string) bool {
+    return len(byHost(registriesGVR, host)) > 0
 }
 
 func parseCIDRs(csv string) []*net.IPNet {
@@ -272,6 +340,111 @@ func lastIP(n *net.IPNet) net.IP {
     return last
 }
 
+// tenantLimitViolation checks the kubeop-quota of namespace, together with
+// the kubeop-quotas of the tenant's other namespaces, against the tenant's
+// spec.limits. Lookup errors are ignored like the other best-effort checks.
+func tenantLimitViolation(namespace string, hard corev1.ResourceList) string {
+    ctx := context.Background()
+    ns, err := kube().CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+    if err != nil || ns.Labels["app.kubeop.io/tenant"] == "" { return "" }
+    tenant := ns.Labels["app.kubeop.io/tenant"]
+    gvr := schema.GroupVersionResource{Group: "paas.kubeop.io", Version: "v1beta1", Resource: "tenants"}
+    t, err := dyn().Resource(gvr).Get(ctx, tenant, metav1.GetOptions{})
+    if err != nil { return "" }
+    raw, _, _ := unstructured.NestedMap(t.Object, "spec", "limits")
+    if len(raw) == 0 { return "" }
+    limits := corev1.ResourceList{}
+    for k, v := range raw {
+        q, err := resource.ParseQuantity(fmt.Sprint(v))
+        if err != nil { continue }
+        limits[corev1.ResourceName(k)] = q
+    }
+    nss, err := kube().CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: "app.kubeop.io/tenant=" + tenant})
+    if err != nil { return "" }
+    total := hard
+    for _, other := range nss.Items {
+        if other.Name == namespace { continue }
+        q, err := kube().CoreV1().ResourceQuotas(other.Name).Get(ctx, "kubeop-quota", metav1.GetOptions{})
+        if err != nil { continue }
+        total = kubeutil.AddResources(total, q.Spec.Hard)
+    }
+    if over := kubeutil.ExceededResources(total, limits); len(over) > 0 {
+        return fmt.Sprintf("project quotas of tenant %s would exceed its limits for %v", tenant, over)
+    }
+    return ""
+}
+
+// autoscalingQuotaViolation checks that maxReplicas pods of an App with
+// container resources res fit into the ResourceQuotas of namespace. Lookup
+// errors are ignored like the other best-effort checks.
+func autoscalingQuotaViolation(namespace string, maxReplicas int32, res corev1.ResourceRequirements) string {
+    ctx := context.Background()
+    quotas, err := kube().CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+    if err != nil { return "" }
+    lrs, err := kube().CoreV1().LimitRanges(namespace).List(ctx, metav1.ListOptions{})
+    if err != nil { return "" }
+    return replicaQuotaViolation(maxReplicas, res, lrs.Items, quotas.Items)
+}
+
+// replicaQuotaViolation reports the quotas n replicas of a container with
+// resources res would exceed. Requests and limits the container leaves out
+// are defaulted as on admission of its pods.
+func replicaQuotaViolation(n int32, res corev1.ResourceRequirements, lrs []corev1.LimitRange, quotas []corev1.ResourceQuota) string {
+    requests, limits := res.Requests.DeepCopy(), res.Limits.DeepCopy()
+    if requests == nil { requests = corev1.ResourceList{} }
+    if limits == nil { limits = corev1.ResourceList{} }
+    // pod defaulting makes a limit without a request the request, before
+    // the LimitRanger fills in the rest
+    for name, q := range limits {
+        if _, ok := requests[name]; !ok { requests[name] = q }
+    }
+    for _, lr := range lrs {
+        for _, item := range lr.Spec.Limits {
+            if item.Type != corev1.LimitTypeContainer { continue }
+            for name, q := range item.Default {
+                if _, ok := limits[name]; !ok { limits[name] = q }
+            }
+            for name, q := range item.DefaultRequest {
+                if _, ok := requests[name]; !ok { requests[name] = q }
+            }
+        }
+    }
+    use := corev1.ResourceList{corev1.ResourcePods: *resource.NewQuantity(int64(n), resource.DecimalSI)}
+    scale := func(q resource.Quantity) resource.Quantity {
+        total := resource.NewMilliQuantity(q.MilliValue()*int64(n), q.Format)
+        return *total
+    }
+    for name, q := range requests {
+        use[corev1.ResourceName("requests."+name)] = scale(q)
+        if name == corev1.ResourceCPU || name == corev1.ResourceMemory { use[name] = scale(q) }
+    }
+    for name, q := range limits {
+        use[corev1.ResourceName("limits."+name)] = scale(q)
+    }
+    for _, q := range quotas {
+        if over := kubeutil.ExceededResources(use, q.Spec.Hard); len(over) > 0 {
+            return fmt.Sprintf("%d replicas would exceed ResourceQuota %s for %v", n, q.Name, over)
+        }
+    }
+    return ""
+}
+
+// quotaCeilingViolation checks the requests.cpu and requests.memory of hard
+// against KUBEOP_QUOTA_MAX_REQUESTS_CPU and KUBEOP_QUOTA_MAX_REQUESTS_MEMORY.
+func quotaCeilingViolation(hard corev1.ResourceList) string {
+    if maxCPU := os.Getenv("KUBEOP_QUOTA_MAX_REQUESTS_CPU"); maxCPU != "" {
+        if !quantityLEQ(hard[corev1.ResourceRequestsCPU], maxCPU) {
+            return fmt.Sprintf("requests.cpu exceeds maximum %s", maxCPU)
+        }
+    }
+    if maxMem := os.Getenv("KUBEOP_QUOTA_MAX_REQUESTS_MEMORY"); maxMem != "" {
+        if !quantityLEQ(hard[corev1.ResourceRequestsMemory], maxMem) {
+            return fmt.Sprintf("requests.memory exceeds maximum %s", maxMem)
+        }
+    }
+    return ""
+}
+
 func quantityLEQ(val resource.Quantity, max string) bool {
     // compare Kubernetes quantities (Quantity <= max)
     qm, err := resource.ParseQuantity(max)
@@ -0,0 +1,69 @@
+package admission
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    admissionv1 "k8s.io/api/admission/v1"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+)
+
+func Test_replicaQuotaViolation(t *testing.T) {
+    quota := corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-quota"}, Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{
+        corev1.ResourcePods:           resource.MustParse("10"),
+        corev1.ResourceRequestsCPU:    resource.MustParse("1"),
+        corev1.ResourceRequestsMemory: resource.MustParse("1Gi"),
+    }}}
+    defaults := corev1.LimitRange{Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+        Type:           corev1.LimitTypeContainer,
+        DefaultRequest: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+        Default:        corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("256Mi")},
+    }}}}
+    lrs := []corev1.LimitRange{defaults}
+    quotas := []corev1.ResourceQuota{quota}
+    cases := []struct {
+        name string
+        n    int32
+        res  corev1.ResourceRequirements
+        want string
+    }{
+        {"defaults fit", 10, corev1.ResourceRequirements{}, ""},
+        {"too many pods", 11, corev1.ResourceRequirements{}, "11 replicas would exceed ResourceQuota kubeop-quota for [pods requests.cpu]"},
+        {"requests", 5, corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")}}, "5 replicas would exceed ResourceQuota kubeop-quota for [requests.memory]"},
+        {"limit without request", 4, corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")}}, ""},
+        {"limit without request over", 5, corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")}}, "5 replicas would exceed ResourceQuota kubeop-quota for [requests.cpu]"},
+    }
+    for _, tc := range cases {
+        if got := replicaQuotaViolation(tc.n, tc.res, lrs, quotas); got != tc.want { t.Fatalf("%s: got %q, want %q", tc.name, got, tc.want) }
+    }
+}
+
+// validate sends req through ServeValidate and returns the response.
+func validate(t *testing.T, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+    t.Helper()
+    body, _ := json.Marshal(admissionv1.AdmissionReview{Request: req})
+    rec := httptest.NewRecorder()
+    ServeValidate(rec, httptest.NewRequest("POST", "/validate", bytes.NewReader(body)))
+    var out admissionv1.AdmissionReview
+    if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil { t.Fatal(err) }
+    return out.Response
+}
+
+func Test_ServeValidateDeliveryVolumes(t *testing.T) {
+    for _, strategy := range []string{"Canary", "BlueGreen"} {
+        resp := validate(t, &admissionv1.AdmissionRequest{
+            UID:       "1",
+            Kind:      metav1.GroupVersionKind{Group: "paas.kubeop.io", Version: "v1beta1", Kind: "App"},
+            Namespace: "kubeop-acme-web",
+            Name:      "web",
+            Object:    runtime.RawExtension{Raw: []byte(`{"spec":{"type":"Image","image":"nginx","strategy":{"type":"` + strategy + `"},"volumes":[{"name":"data","mountPath":"/data","size":"1Gi","accessMode":"ReadWriteOnce"}]}}`)},
+        })
+        if resp.Allowed || !strings.Contains(resp.Result.Message, "spec.volumes") { t.Fatalf("%s: expected volumes to be rejected, got %+v", strategy, resp) }
+    }
+}
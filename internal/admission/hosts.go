@@ -0,0 +1,146 @@
+package admission
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strings"
+
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    schema "k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// hostKind is a kind that claims DNS names, with the spec field holding them.
+type hostKind struct {
+    kind  string
+    gvr   schema.GroupVersionResource
+    field string
+    hosts func(obj map[string]any) []string
+    // routes split a host by path, so several of them in one namespace may
+    // serve it
+    route bool
+}
+
+// hostKinds are the kinds whose hosts admission keeps within the tenant
+// domains and within a single namespace.
+var hostKinds = []hostKind{
+    {kind: "App", gvr: appsGVR, field: "spec.host", hosts: specHosts},
+    {kind: "DNSRecord", gvr: dnsRecordsGVR, field: "spec.host", hosts: specHosts},
+    {kind: "Certificate", gvr: certificatesGVR, field: "spec.host", hosts: specHosts},
+    {kind: "Ingress", gvr: ingressesGVR, field: "spec.rules.host", hosts: ingressHosts, route: true},
+    {kind: "HTTPRoute", gvr: httpRoutesGVR, field: "spec.hostnames", hosts: httpRouteHosts, route: true},
+}
+
+// hostKindOf returns the host kind of group and kind, nil for other kinds.
+func hostKindOf(group, kind string) *hostKind {
+    for i, k := range hostKinds {
+        if k.gvr.Group == group && strings.EqualFold(k.kind, kind) { return &hostKinds[i] }
+    }
+    return nil
+}
+
+// rawHosts returns the hosts a raw object of kind k claims.
+func (k *hostKind) rawHosts(raw []byte) []string {
+    var obj map[string]any
+    if len(raw) == 0 || json.Unmarshal(raw, &obj) != nil { return nil }
+    return k.hosts(obj)
+}
+
+func specHosts(obj map[string]any) []string {
+    host, _, _ := unstructured.NestedString(obj, "spec", "host")
+    if host == "" { return nil }
+    return []string{host}
+}
+
+// ingressHosts returns the hosts of the rules and TLS entries of an Ingress.
+func ingressHosts(obj map[string]any) []string {
+    var hosts []string
+    rules, _, _ := unstructured.NestedSlice(obj, "spec", "rules")
+    for _, r := range rules {
+        if m, ok := r.(map[string]any); ok {
+            if h, _ := m["host"].(string); h != "" { hosts = append(hosts, h) }
+        }
+    }
+    tls, _, _ := unstructured.NestedSlice(obj, "spec", "tls")
+    for _, t := range tls {
+        if m, ok := t.(map[string]any); ok {
+            hs, _, _ := unstructured.NestedStringSlice(m, "hosts")
+            hosts = append(hosts, hs...)
+        }
+    }
+    return uniqueHosts(hosts)
+}
+
+func httpRouteHosts(obj map[string]any) []string {
+    hosts, _, _ := unstructured.NestedStringSlice(obj, "spec", "hostnames")
+    return uniqueHosts(hosts)
+}
+
+// uniqueHosts lower-cases hosts and drops empty and repeated ones.
+func uniqueHosts(hosts []string) []string {
+    seen := map[string]bool{}
+    out := hosts[:0]
+    for _, h := range hosts {
+        h = strings.ToLower(h)
+        if h == "" || seen[h] { continue }
+        seen[h] = true
+        out = append(out, h)
+    }
+    return out
+}
+
+// addedHosts returns the hosts of obj that old does not claim yet, so that
+// objects keeping their hosts, e.g. to drop a finalizer, are not checked.
+func addedHosts(k *hostKind, obj, old []byte) []string {
+    had := map[string]bool{}
+    for _, h := range k.rawHosts(old) { had[strings.ToLower(h)] = true }
+    var out []string
+    for _, h := range k.rawHosts(obj) {
+        if !had[strings.ToLower(h)] { out = append(out, h) }
+    }
+    return out
+}
+
+// hostViolation checks a host the object of kind named namespace/name
+// claims. In tenant namespaces the host must lie within the
+// tenant's spec.domains. Unlike the quota checks, lookup errors deny the
+// request, as a host published for the wrong tenant is taken over.
+func hostViolation(kind, namespace, name, host string) string {
+    if host == "" { return "" }
+    ctx := context.Background()
+    ns, err := kube().CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+    if err != nil { return fmt.Sprintf("cannot look up namespace %s: %v", namespace, err) }
+    if tenant := ns.Labels["app.kubeop.io/tenant"]; tenant != "" {
+        gvr := schema.GroupVersionResource{Group: "paas.kubeop.io", Version: "v1beta1", Resource: "tenants"}
+        t, err := dyn().Resource(gvr).Get(ctx, tenant, metav1.GetOptions{})
+        if err != nil { return fmt.Sprintf("cannot look up tenant %s: %v", tenant, err) }
+        domains, _, _ := unstructured.NestedStringSlice(t.Object, "spec", "domains")
+        if !hostWithin(host, domains) { return fmt.Sprintf("host %s is not within the domains of tenant %s", host, tenant) }
+    }
+    return hostConflict(kind, namespace, name, host)
+}
+
+// hostWithin reports whether host is one of domains or a subdomain of one.
+func hostWithin(host string, domains []string) bool {
+    host = strings.TrimSuffix(strings.ToLower(host), ".")
+    for _, d := range domains {
+        d = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), ".")
+        if d != "" && (host == d || strings.HasSuffix(host, "."+d)) { return true }
+    }
+    return false
+}
+
+// hostConflict reports the object already holding host. A host belongs to a
+// single namespace and to a single object of each kind in it, so an App
+// shares it only with the DNSRecord, Certificate and routes created for it.
+// Routes of one namespace may share a host, as they split it by path.
+func hostConflict(kind, namespace, name, host string) string {
+    for _, k := range hostKinds {
+        for _, u := range byHost(k.gvr, host) {
+            if u.GetNamespace() == namespace && (!strings.EqualFold(k.kind, kind) || k.route || u.GetName() == name) { continue }
+            return fmt.Sprintf("host %s is already used by %s %s/%s", host, k.kind, u.GetNamespace(), u.GetName())
+        }
+    }
+    return ""
+}
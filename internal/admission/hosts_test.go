@@ -0,0 +1,82 @@
+package admission
+
+import (
+    "context"
+    "strings"
+    "testing"
+
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime"
+    dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func Test_hostWithin(t *testing.T) {
+    domains := []string{"acme.example.com", " Shop.Example.org. "}
+    cases := map[string]bool{
+        "acme.example.com":     true,
+        "WEB.acme.example.com": true,
+        "shop.example.org.":    true,
+        "evilacme.example.com": false,
+        "example.com":          false,
+        "":                     false,
+    }
+    for host, want := range cases {
+        if got := hostWithin(host, domains); got != want { t.Fatalf("hostWithin(%q) = %v, want %v", host, got, want) }
+    }
+    if hostWithin("web.acme.example.com", nil) { t.Fatalf("a tenant without domains must not claim hosts") }
+}
+
+func Test_hostConflict(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    obj := func(kind, ns, name, host string) *unstructured.Unstructured {
+        return &unstructured.Unstructured{Object: map[string]any{
+            "apiVersion": "paas.kubeop.io/v1beta1", "kind": kind,
+            "metadata": map[string]any{"name": name, "namespace": ns},
+            "spec":     map[string]any{"host": host},
+        }}
+    }
+    dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds,
+        obj("App", "kubeop-acme-web", "web", "web.acme.example.com"),
+        obj("DNSRecord", "kubeop-acme-web", "web", "web.acme.example.com"),
+        &unstructured.Unstructured{Object: map[string]any{
+            "apiVersion": "networking.k8s.io/v1", "kind": "Ingress",
+            "metadata": map[string]any{"name": "shop", "namespace": "kubeop-acme-shop"},
+            "spec":     map[string]any{"tls": []any{map[string]any{"hosts": []any{"Shop.acme.example.com"}}}},
+        }},
+    )
+    if err := StartInformers(ctx, dc, true); err != nil { t.Fatal(err) }
+    cases := []struct {
+        kind, ns, name string
+        conflict       bool
+    }{
+        {"App", "kubeop-acme-web", "web", false},
+        {"Certificate", "kubeop-acme-web", "web", false},
+        {"DNSRecord", "kubeop-acme-web", "web", false},
+        {"DNSRecord", "kubeop-acme-web", "other", true},
+        {"App", "kubeop-acme-web", "other", true},
+        {"Certificate", "kubeop-evil-web", "web", true},
+        {"Ingress", "kubeop-acme-web", "web-acme-solver", false},
+        {"HTTPRoute", "kubeop-evil-web", "web", true},
+    }
+    for _, c := range cases {
+        msg := hostConflict(c.kind, c.ns, c.name, "Web.Acme.Example.com")
+        if (msg != "") != c.conflict { t.Fatalf("%s %s/%s: unexpected result %q", c.kind, c.ns, c.name, msg) }
+    }
+    if msg := hostConflict("App", "kubeop-evil-web", "web", "blog.acme.example.com"); msg != "" { t.Fatalf("unexpected conflict %q", msg) }
+    if msg := hostConflict("App", "kubeop-evil-web", "web", "shop.acme.example.com"); msg == "" { t.Fatalf("expected the host of the Ingress to be taken") }
+    if msg := hostConflict("Ingress", "kubeop-acme-shop", "admin", "shop.acme.example.com"); msg != "" { t.Fatalf("routes of one namespace must share a host, got %q", msg) }
+}
+
+func Test_addedHosts(t *testing.T) {
+    ing := hostKindOf("networking.k8s.io", "Ingress")
+    if ing == nil { t.Fatalf("Ingress must be a host kind") }
+    obj := []byte(`{"spec":{"rules":[{"host":"a.example.com"},{"host":"B.example.com"},{}],"tls":[{"hosts":["b.example.com","c.example.com"]}]}}`)
+    old := []byte(`{"spec":{"rules":[{"host":"a.example.com"}]}}`)
+    got := addedHosts(ing, obj, old)
+    if strings.Join(got, ",") != "b.example.com,c.example.com" { t.Fatalf("unexpected added hosts %v", got) }
+    if got := addedHosts(ing, obj, nil); len(got) != 3 { t.Fatalf("every host of a new Ingress must be checked, got %v", got) }
+    route := hostKindOf("gateway.networking.k8s.io", "HTTPRoute")
+    if got := addedHosts(route, []byte(`{"spec":{"hostnames":["web.example.com"]}}`), nil); len(got) != 1 || got[0] != "web.example.com" { t.Fatalf("unexpected HTTPRoute hosts %v", got) }
+    if hostKindOf("networking.k8s.io", "NetworkPolicy") != nil || hostKindOf("", "App") != nil { t.Fatalf("unexpected host kind") }
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "os"
+    "strconv"
+    "time"
+
+    authenticationv1 "k8s.io/api/authentication/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/rest"
+    "k8s.io/client-go/tools/clientcmd"
+    clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// projectServiceAccount is the ServiceAccount the operator creates, bound to
+// the project Role, in every project namespace.
+const projectServiceAccount = "kubeop-project"
+
+// Lifetime bounds of minted kubeconfig tokens; the TokenRequest API rejects
+// tokens shorter than 10 minutes.
+const (
+    defaultTokenTTL = time.Hour
+    minTokenTTL     = 10 * time.Minute
+    maxTokenTTL     = 24 * time.Hour
+)
+
+// tokenTTL reads the ttlMinutes query parameter.
+func tokenTTL(r *http.Request) (time.Duration, error) {
+    v := r.URL.Query().Get("ttlMinutes")
+    if v == "" { return defaultTokenTTL, nil }
+    n, err := strconv.Atoi(v)
+    ttl := time.Duration(n) * time.Minute
+    if err != nil || ttl < minTokenTTL || ttl > maxTokenTTL { return 0, errors.New("ttlMinutes must be between 10 and 1440") }
+    return ttl, nil
+}
+
+// writeKubeconfig responds with a kubeconfig minted for the project namespace
+// ns of cfg and the expiry of its token.
+func (s *Server) writeKubeconfig(w http.ResponseWriter, r *http.Request, cfg *rest.Config, ns string) {
+    ttl, err := tokenTTL(r)
+    if err != nil { http.Error(w, `{"error":"ttlMinutes must be between 10 and 1440"}`, http.StatusBadRequest); return }
+    raw, exp, err := mintKubeconfig(r.Context(), cfg, ns, ttl)
+    // the operator creates the ServiceAccount when it bootstraps the project
+    if apierrors.IsNotFound(err) { http.Error(w, `{"error":"project not bootstrapped"}`, http.StatusConflict); return }
+    if err != nil { http.Error(w, `{"error":"token"}`, http.StatusBadGateway); return }
+    json.NewEncoder(w).Encode(map[string]string{"kubeconfig": string(raw), "expiresAt": exp.UTC().Format(time.RFC3339)})
+}
+
+// mintKubeconfig requests a token for the project ServiceAccount of ns and
+// returns a kubeconfig using it against the API server of cfg.
+func mintKubeconfig(ctx context.Context, cfg *rest.Config, ns string, ttl time.Duration) ([]byte, time.Time, error) {
+    kc, err := kubernetes.NewForConfig(cfg)
+    if err != nil { return nil, time.Time{}, err }
+    secs := int64(ttl.Seconds())
+    tr, err := kc.CoreV1().ServiceAccounts(ns).CreateToken(ctx, projectServiceAccount, &authenticationv1.TokenRequest{
+        Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &secs},
+    }, metav1.CreateOptions{})
+    if err != nil { return nil, time.Time{}, err }
+    raw, err := buildKubeconfig(cfg, ns, tr.Status.Token)
+    return raw, tr.Status.ExpirationTimestamp.Time, err
+}
+
+// buildKubeconfig returns a kubeconfig for token in namespace ns, trusting the
+// server and CA of cfg.
+func buildKubeconfig(cfg *rest.Config, ns, token string) ([]byte, error) {
+    ca := cfg.TLSClientConfig.CAData
+    if len(ca) == 0 && cfg.TLSClientConfig.CAFile != "" {
+        var err error
+        if ca, err = os.ReadFile(cfg.TLSClientConfig.CAFile); err != nil { return nil, err }
+    }
+    kc := clientcmdapi.NewConfig()
+    kc.Clusters["kubeop"] = &clientcmdapi.Cluster{
+        Server:                   cfg.Host,
+        CertificateAuthorityData: ca,
+        TLSServerName:            cfg.TLSClientConfig.ServerName,
+        InsecureSkipTLSVerify:    cfg.TLSClientConfig.Insecure,
+    }
+    kc.AuthInfos[ns] = &clientcmdapi.AuthInfo{Token: token}
+    kc.Contexts[ns] = &clientcmdapi.Context{Cluster: "kubeop", AuthInfo: ns, Namespace: ns}
+    kc.CurrentContext = ns
+    return clientcmd.Write(*kc)
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+    "net/http/httptest"
+    "testing"
+
+    "k8s.io/client-go/rest"
+    "k8s.io/client-go/tools/clientcmd"
+)
+
+func Test_buildKubeconfig(t *testing.T) {
+    cfg := &rest.Config{Host: "https://api.acme.example.com:6443", TLSClientConfig: rest.TLSClientConfig{CAData: []byte("test-ca")}}
+    raw, err := buildKubeconfig(cfg, "kubeop-acme-web", "sa-token")
+    if err != nil { t.Fatal(err) }
+    kc, err := clientcmd.Load(raw)
+    if err != nil { t.Fatal(err) }
+    ctx := kc.Contexts[kc.CurrentContext]
+    if ctx == nil || ctx.Namespace != "kubeop-acme-web" { t.Fatalf("unexpected context %+v", ctx) }
+    cl := kc.Clusters[ctx.Cluster]
+    if cl.Server != cfg.Host || string(cl.CertificateAuthorityData) != "test-ca" { t.Fatalf("unexpected cluster %+v", cl) }
+    if kc.AuthInfos[ctx.AuthInfo].Token != "sa-token" { t.Fatalf("unexpected user %+v", kc.AuthInfos[ctx.AuthInfo]) }
+}
+
+func Test_tokenTTL(t *testing.T) {
+    for q, ok := range map[string]bool{"": true, "?ttlMinutes=30": true, "?ttlMinutes=5": false, "?ttlMinutes=2000": false, "?ttlMinutes=x": false} {
+        _, err := tokenTTL(httptest.NewRequest("GET", "/v1/kubeconfigs/project/p1"+q, nil))
+        if (err == nil) != ok { t.Fatalf("ttl %q: unexpected error %v", q, err) }
+    }
+}
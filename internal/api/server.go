@@ -28,6 +28,10 @@ import (
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
     apierrors "k8s.io/apimachinery/pkg/api/errors"
     "k8s.io/client-go/tools/clientcmd"
+    "k8s.io/client-go/dynamic"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "k8s.io/apimachinery/pkg/types"
     batchv1 "k8s.io/api/batch/v1"
     corev1 "k8s.io/api/core/v1"
 )
@@ -708,6 +712,10 @@ func (s *Server) projectsGetDelete(w http.ResponseWriter, r *http.Request, claim
 func (s *Server) appsGetDelete(w http.ResponseWriter, r *http.Request, claims *auth.Claims) {
     id := strings.TrimPrefix(r.URL.Path, "/v1/apps/")
     if id == "" { http.Error(w, `{"error":"id"}`, http.StatusBadRequest); return }
+    if i := strings.Index(id, "/"); i > 0 {
+        s.appsRevisions(w, r, claims, id[:i], id[i+1:])
+        return
+    }
     switch r.Method {
     case http.MethodGet:
         t0 := time.Now()
@@ -728,6 +736,43 @@ func (s *Server) appsGetDelete(w http.ResponseWriter, r *http.Request, claims *a
     }
 }
 
+var appsGVR = schema.GroupVersionResource{Group: "paas.kubeop.io", Version: "v1beta1", Resource: "apps"}
+
+// /v1/apps/{id}/revisions [GET] lists the revision history of the App and
+// /v1/apps/{id}/rollback [POST] {"revision": N} restores one of them.
+func (s *Server) appsRevisions(w http.ResponseWriter, r *http.Request, claims *auth.Claims, id, sub string) {
+    a, err := s.store.GetApp(r.Context(), id)
+    if err != nil { http.Error(w, `{"error":"db"}`, http.StatusInternalServerError); return }
+    if a == nil { http.Error(w, `{"error":"not found"}`, http.StatusNotFound); return }
+    if s.cfgAuth && !(auth.IsAdmin(claims) || auth.IsProject(claims, a.ProjectID)) { http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden); return }
+    cfg, ns, err := s.configAndNamespaceForProject(r.Context(), a.ProjectID)
+    if err != nil { http.Error(w, `{"error":"resolve"}`, http.StatusInternalServerError); return }
+    dc, err := dynamic.NewForConfig(cfg)
+    if err != nil { http.Error(w, `{"error":"k8s"}`, http.StatusInternalServerError); return }
+    switch sub {
+    case "revisions":
+        if r.Method != http.MethodGet { http.Error(w, `{"error":"method"}`, http.StatusMethodNotAllowed); return }
+        u, err := dc.Resource(appsGVR).Namespace(ns).Get(r.Context(), a.Name, metav1.GetOptions{})
+        if apierrors.IsNotFound(err) { http.Error(w, `{"error":"not found"}`, http.StatusNotFound); return }
+        if err != nil { http.Error(w, `{"error":"get"}`, http.StatusInternalServerError); return }
+        history, _, _ := unstructured.NestedSlice(u.Object, "status", "history")
+        if history == nil { history = []interface{}{} }
+        json.NewEncoder(w).Encode(history)
+    case "rollback":
+        if r.Method != http.MethodPost { http.Error(w, `{"error":"method"}`, http.StatusMethodNotAllowed); return }
+        var in struct{ Revision int64 `json:"revision"` }
+        if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Revision < 1 { http.Error(w, `{"error":"invalid"}`, http.StatusBadRequest); return }
+        patch, _ := json.Marshal(map[string]any{"spec": map[string]any{"rollbackTo": map[string]int64{"revision": in.Revision}}})
+        _, err := dc.Resource(appsGVR).Namespace(ns).Patch(r.Context(), a.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+        if apierrors.IsNotFound(err) { http.Error(w, `{"error":"not found"}`, http.StatusNotFound); return }
+        if err != nil { http.Error(w, `{"error":"rollback"}`, http.StatusInternalServerError); return }
+        w.WriteHeader(http.StatusAccepted)
+        json.NewEncoder(w).Encode(map[string]any{"status": "rolling back", "revision": in.Revision})
+    default:
+        http.Error(w, `{"error":"path"}`, http.StatusNotFound)
+    }
+}
+
 func (s *Server) usageIngest(w http.ResponseWriter, r *http.Request, claims *auth.Claims) {
     if r.Method != http.MethodPost { http.Error(w, `{"error":"method"}`, http.StatusMethodNotAllowed); return }
     var items []models.UsageLine
@@ -742,30 +787,14 @@ func (s *Server) usageIngest(w http.ResponseWriter, r *http.Request, claims *aut
     json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// kubeconfigIssue mints a kubeconfig for the project namespace in the path,
+// on the manager's cluster or the stored cluster given as clusterID.
 func (s *Server) kubeconfigIssue(w http.ResponseWriter, r *http.Request, _ *auth.Claims) {
-    // Return simple kubeconfig content base64: Provide namespace from path after prefix
     ns := strings.TrimPrefix(r.URL.Path, "/v1/kubeconfigs/")
-    if ns == "" { ns = "default" }
-    cfg := `apiVersion: v1
-clusters:
-- cluster:
-    server: https://kubernetes.default.svc
-  name: kind-kubeop
-contexts:
-- context:
-    cluster: kind-kubeop
-    namespace: ` + ns + `
-    user: token-user
-  name: ` + ns + `
-current-context: ` + ns + `
-kind: Config
-preferences: {}
-users:
-- name: token-user
-  user:
-    token: placeholder
-`
-    json.NewEncoder(w).Encode(map[string]string{"kubeconfig": cfg})
+    if ns == "" || strings.Contains(ns, "/") { http.Error(w, `{"error":"namespace"}`, http.StatusBadRequest); return }
+    cfg, err := s.configForRequestCluster(r)
+    if err != nil { http.Error(w, `{"error":"cluster"}`, http.StatusBadRequest); return }
+    s.writeKubeconfig(w, r, cfg, ns)
 }
 
 // Mint a project-scoped JWT and return kubeconfig for that project
@@ -783,36 +812,15 @@ func (s *Server) jwtMintProject(w http.ResponseWriter, r *http.Request, claims *
     json.NewEncoder(w).Encode(map[string]string{"token": tok})
 }
 
-// Issue kubeconfig for project by id, includes namespace and token placeholder
+// kubeconfigProject mints a kubeconfig for the project by id on the cluster
+// of its tenant.
 func (s *Server) kubeconfigProject(w http.ResponseWriter, r *http.Request, claims *auth.Claims) {
     pid := strings.TrimPrefix(r.URL.Path, "/v1/kubeconfigs/project/")
     if pid == "" { http.Error(w, `{"error":"project id"}`, http.StatusBadRequest); return }
     if s.cfgAuth && !(auth.IsAdmin(claims) || auth.IsProject(claims, pid)) { http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden); return }
-    p, err := s.store.GetProject(r.Context(), pid)
-    if err != nil || p == nil { http.Error(w, `{"error":"not found"}`, http.StatusNotFound); return }
-    t, err := s.store.GetTenant(r.Context(), p.TenantID)
-    if err != nil || t == nil { http.Error(w, `{"error":"not found"}`, http.StatusNotFound); return }
-    ns := "kubeop-" + strings.ToLower(t.Name) + "-" + strings.ToLower(p.Name)
-    cfg := `apiVersion: v1
-clusters:
-- cluster:
-    server: https://kubernetes.default.svc
-  name: kind-kubeop
-contexts:
-- context:
-    cluster: kind-kubeop
-    namespace: ` + ns + `
-    user: token-user
-  name: ` + ns + `
-current-context: ` + ns + `
-kind: Config
-preferences: {}
-users:
-- name: token-user
-  user:
-    token: ` + r.Header.Get("Authorization") + `
-`
-    json.NewEncoder(w).Encode(map[string]string{"kubeconfig": cfg})
+    cfg, ns, err := s.configAndNamespaceForProject(r.Context(), pid)
+    if err != nil { http.Error(w, `{"error":"not found"}`, http.StatusNotFound); return }
+    s.writeKubeconfig(w, r, cfg, ns)
 }
 
 func (s *Server) Start(ctx context.Context, addr string) error {
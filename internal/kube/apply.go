@@ -3,6 +3,7 @@ package kube
 import (
     "bufio"
     "context"
+    "fmt"
     "io"
     "os"
     "path/filepath"
@@ -38,31 +39,77 @@ func ApplyDir(ctx context.Context, cfg *rest.Config, dir string, defaultNS strin
     })
 }
 
+// DecodeDir walks a directory and decodes every YAML document found, in the
+// same order ApplyDir would apply them. Symlinks may point outside dir, so
+// symlinked files are skipped and symlinked directories are an error.
+func DecodeDir(dir string) ([]*unstructured.Unstructured, error) {
+    var out []*unstructured.Unstructured
+    err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+        if err != nil { return err }
+        if info.Mode()&os.ModeSymlink != 0 {
+            if st, err := os.Stat(path); err == nil && st.IsDir() { return fmt.Errorf("%s: symlinked directories are not allowed", path) }
+            return nil
+        }
+        if !info.Mode().IsRegular() { return nil }
+        if !(strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")) { return nil }
+        f, err := os.Open(path)
+        if err != nil { return err }
+        defer f.Close()
+        objs, err := DecodeManifests(f)
+        if err != nil { return fmt.Errorf("%s: %w", path, err) }
+        out = append(out, objs...)
+        return nil
+    })
+    return out, err
+}
+
 func applyFile(ctx context.Context, dc dynamic.Interface, mapper meta.RESTMapper, r io.Reader, defaultNS string) error {
+    objs, err := DecodeManifests(r)
+    if err != nil { return err }
+    for _, obj := range objs {
+        if err := applyObject(ctx, dc, mapper, obj, defaultNS); err != nil { return err }
+    }
+    return nil
+}
+
+// DecodeManifests splits a multi-document YAML stream on "---" separators and
+// decodes every non-empty document into an unstructured object.
+func DecodeManifests(r io.Reader) ([]*unstructured.Unstructured, error) {
     reader := bufio.NewReader(r)
+    var out []*unstructured.Unstructured
     var b strings.Builder
+    flush := func() error {
+        if strings.TrimSpace(b.String()) == "" { b.Reset(); return nil }
+        obj, err := decodeDoc([]byte(b.String()))
+        b.Reset()
+        if err != nil { return err }
+        if obj != nil { out = append(out, obj) }
+        return nil
+    }
     for {
         line, err := reader.ReadString('\n')
-        if err != nil && err != io.EOF { return err }
+        if err != nil && err != io.EOF { return nil, err }
         if strings.HasPrefix(line, "---") {
-            if strings.TrimSpace(b.String()) != "" {
-                if err := applyDoc(ctx, dc, mapper, []byte(b.String()), defaultNS); err != nil { return err }
-                b.Reset()
-            }
+            if ferr := flush(); ferr != nil { return nil, ferr }
         } else {
             b.WriteString(line)
         }
         if err == io.EOF { break }
     }
-    if strings.TrimSpace(b.String()) != "" {
-        if err := applyDoc(ctx, dc, mapper, []byte(b.String()), defaultNS); err != nil { return err }
-    }
-    return nil
+    if err := flush(); err != nil { return nil, err }
+    return out, nil
 }
 
-func applyDoc(ctx context.Context, dc dynamic.Interface, mapper meta.RESTMapper, data []byte, defaultNS string) error {
+// decodeDoc decodes a single YAML document. Documents holding only comments
+// decode to nil and are skipped.
+func decodeDoc(data []byte) (*unstructured.Unstructured, error) {
     var obj unstructured.Unstructured
-    if err := yaml.Unmarshal(data, &obj.Object); err != nil { return err }
+    if err := yaml.Unmarshal(data, &obj.Object); err != nil { return nil, err }
+    if len(obj.Object) == 0 { return nil, nil }
+    return &obj, nil
+}
+
+func applyObject(ctx context.Context, dc dynamic.Interface, mapper meta.RESTMapper, obj *unstructured.Unstructured, defaultNS string) error {
     if obj.GetNamespace() == "" && defaultNS != "" {
         obj.SetNamespace(defaultNS)
     }
@@ -78,12 +125,12 @@ func applyDoc(ctx context.Context, dc dynamic.Interface, mapper meta.RESTMapper,
         ri = dc.Resource(m.Resource)
     }
     // Try create, then update on conflict
-    _, err = ri.Create(ctx, &obj, metav1.CreateOptions{})
+    _, err = ri.Create(ctx, obj, metav1.CreateOptions{})
     if errors.IsAlreadyExists(err) {
         current, getErr := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
         if getErr != nil { return getErr }
         obj.SetResourceVersion(current.GetResourceVersion())
-        _, err = ri.Update(ctx, &obj, metav1.UpdateOptions{})
+        _, err = ri.Update(ctx, obj, metav1.UpdateOptions{})
     }
     return err
 }
@@ -0,0 +1,26 @@
+package kube
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestDecodeManifests(t *testing.T) {
+    in := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+---
+# only a comment
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: b
+`
+    objs, err := DecodeManifests(strings.NewReader(in))
+    if err != nil { t.Fatal(err) }
+    if len(objs) != 2 { t.Fatalf("expected 2 objects, got %d", len(objs)) }
+    if objs[0].GetKind() != "ConfigMap" || objs[1].GetName() != "b" { t.Fatalf("unexpected objects: %v", objs) }
+    if _, err := DecodeManifests(strings.NewReader("kind: [")); err == nil { t.Fatalf("expected decode error") }
+}
@@ -0,0 +1,33 @@
+package kube
+
+import (
+    "sort"
+
+    corev1 "k8s.io/api/core/v1"
+)
+
+// AddResources returns the sum of a and b as a new list.
+func AddResources(a, b corev1.ResourceList) corev1.ResourceList {
+    out := corev1.ResourceList{}
+    for _, l := range []corev1.ResourceList{a, b} {
+        for name, q := range l {
+            cur := out[name]
+            cur.Add(q)
+            out[name] = cur
+        }
+    }
+    return out
+}
+
+// ExceededResources returns, sorted, the resources whose total is above the
+// ceiling in limits. Resources without a ceiling are unconstrained.
+func ExceededResources(total, limits corev1.ResourceList) []corev1.ResourceName {
+    var out []corev1.ResourceName
+    for name, max := range limits {
+        if q, ok := total[name]; ok && q.Cmp(max) > 0 {
+            out = append(out, name)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+    return out
+}
@@ -0,0 +1,24 @@
+package kube
+
+import (
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestAddAndExceededResources(t *testing.T) {
+    a := corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("500m"), corev1.ResourcePods: resource.MustParse("10")}
+    b := corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1"), corev1.ResourceRequestsMemory: resource.MustParse("1Gi")}
+    sum := AddResources(a, b)
+    if cpu := sum[corev1.ResourceRequestsCPU]; cpu.String() != "1500m" { t.Fatalf("unexpected cpu sum: %s", cpu.String()) }
+    if _, ok := a[corev1.ResourceRequestsMemory]; ok { t.Fatalf("inputs must not be modified") }
+
+    limits := corev1.ResourceList{
+        corev1.ResourceRequestsCPU:    resource.MustParse("1"),
+        corev1.ResourceRequestsMemory: resource.MustParse("1Gi"),
+        corev1.ResourceLimitsCPU:      resource.MustParse("1"),
+    }
+    over := ExceededResources(sum, limits)
+    if len(over) != 1 || over[0] != corev1.ResourceRequestsCPU { t.Fatalf("unexpected exceeded set: %v", over) }
+}
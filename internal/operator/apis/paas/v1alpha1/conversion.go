@@ -0,0 +1,48 @@
+package v1alpha1
+
+import (
+    "encoding/json"
+    "reflect"
+
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "sigs.k8s.io/controller-runtime/pkg/conversion"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// convert copies src into dst, which is reset first. v1alpha1 and v1beta1
+// share their fields, so an object converts through its JSON form and only
+// its apiVersion changes to gv.
+func convert(src, dst runtime.Object, gv schema.GroupVersion) error {
+    raw, err := json.Marshal(src)
+    if err != nil { return err }
+    v := reflect.ValueOf(dst).Elem()
+    v.Set(reflect.Zero(v.Type()))
+    if err := json.Unmarshal(raw, dst); err != nil { return err }
+    dst.GetObjectKind().SetGroupVersionKind(gv.WithKind(v.Type().Name()))
+    return nil
+}
+
+// Every kind converts to and from its v1beta1 hub.
+
+func (t *Tenant) ConvertTo(hub conversion.Hub) error   { return convert(t, hub, v1beta1.GroupVersion) }
+func (t *Tenant) ConvertFrom(hub conversion.Hub) error { return convert(hub, t, GroupVersion) }
+
+func (p *Project) ConvertTo(hub conversion.Hub) error   { return convert(p, hub, v1beta1.GroupVersion) }
+func (p *Project) ConvertFrom(hub conversion.Hub) error { return convert(hub, p, GroupVersion) }
+
+func (a *App) ConvertTo(hub conversion.Hub) error   { return convert(a, hub, v1beta1.GroupVersion) }
+func (a *App) ConvertFrom(hub conversion.Hub) error { return convert(hub, a, GroupVersion) }
+
+func (p *Policy) ConvertTo(hub conversion.Hub) error   { return convert(p, hub, v1beta1.GroupVersion) }
+func (p *Policy) ConvertFrom(hub conversion.Hub) error { return convert(hub, p, GroupVersion) }
+
+func (r *Registry) ConvertTo(hub conversion.Hub) error   { return convert(r, hub, v1beta1.GroupVersion) }
+func (r *Registry) ConvertFrom(hub conversion.Hub) error { return convert(hub, r, GroupVersion) }
+
+func (d *DNSRecord) ConvertTo(hub conversion.Hub) error   { return convert(d, hub, v1beta1.GroupVersion) }
+func (d *DNSRecord) ConvertFrom(hub conversion.Hub) error { return convert(hub, d, GroupVersion) }
+
+func (c *Certificate) ConvertTo(hub conversion.Hub) error   { return convert(c, hub, v1beta1.GroupVersion) }
+func (c *Certificate) ConvertFrom(hub conversion.Hub) error { return convert(hub, c, GroupVersion) }
@@ -0,0 +1,134 @@
+package v1alpha1
+
+import (
+    "testing"
+    "time"
+
+    autoscalingv2 "k8s.io/api/autoscaling/v2"
+    corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    "k8s.io/apimachinery/pkg/api/equality"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/util/intstr"
+    "sigs.k8s.io/controller-runtime/pkg/conversion"
+    ctrlconversion "sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// spokes returns an object of every kind with most fields set.
+func spokes() []conversion.Convertible {
+    now := metav1.NewTime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+    qty := resource.MustParse("10Gi")
+    claims, replicas, minReplicas, cpu := int64(5), int32(2), int32(1), int32(70)
+    class := "fast"
+    conds := []Condition{{Type: "Ready", Status: "True", Reason: "Ready", Message: "ok", LastTransitionTime: now}}
+    quota := corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("2"), corev1.ResourceRequestsMemory: resource.MustParse("4Gi")}
+    meta := func(name, ns string) metav1.ObjectMeta {
+        return metav1.ObjectMeta{Name: name, Namespace: ns, Labels: map[string]string{"app.kubeop.io/tenant": "acme"}, Annotations: map[string]string{"note": name}, Generation: 3, Finalizers: []string{"paas.kubeop.io/test"}}
+    }
+    probe := &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt32(8080)}}, PeriodSeconds: 5}
+    return []conversion.Convertible{
+        &Tenant{
+            ObjectMeta: meta("acme", ""),
+            Spec:       TenantSpec{Name: "acme", Limits: quota, Domains: []string{"acme.example.com"}},
+            Status:     TenantStatus{Ready: true, Conditions: conds, Projects: 2, ReadyProjects: 1, NotReadyProjects: 1, Allocated: quota, Used: quota},
+        },
+        &Project{
+            ObjectMeta: meta("acme-web", ""),
+            Spec: ProjectSpec{TenantRef: "acme", Name: "web", ProjectResources: ProjectResources{
+                Quota: quota, DefaultRequest: quota, DefaultLimit: quota,
+                Storage: &ProjectStorage{Requests: &qty, PersistentVolumeClaims: &claims, Classes: map[string]resource.Quantity{"fast": qty}},
+            }},
+            Status: ProjectStatus{Namespace: "kubeop-acme-web", Ready: true, Quota: quota, Conditions: conds},
+        },
+        &App{
+            ObjectMeta: meta("web", "kubeop-acme-web"),
+            Spec: AppSpec{
+                Type: "Image", Image: "ghcr.io/acme/web:1.2.3", Host: "web.example.com",
+                Git: &GitSource{Repo: "https://git.example.com/acme/web", Ref: "main", Path: "deploy"},
+                Helm: &HelmSource{Chart: "web", Version: "1.0.0", Values: "replicas: 2"},
+                RawManifests: "kind: ConfigMap",
+                Hooks: &Hooks{Pre: []Hook{{Image: "busybox", Args: []string{"migrate"}}}, Post: []Hook{{Image: "busybox"}}},
+                Workload: Workload{
+                    Replicas: &replicas, Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP}},
+                    Command: []string{"/web"}, Args: []string{"--port=8080"},
+                    Env: []corev1.EnvVar{{Name: "MODE", Value: "prod"}, {Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "web"}, Key: "token"}}}},
+                    EnvFrom: []corev1.EnvFromSource{{Prefix: "CFG_", ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "web"}}}},
+                    Resources: corev1.ResourceRequirements{Requests: quota, Limits: quota},
+                    LivenessProbe: probe, ReadinessProbe: probe,
+                    Volumes: []Volume{{Name: "data", MountPath: "/data", Size: qty, StorageClassName: &class, AccessMode: corev1.ReadWriteOnce, RetentionPolicy: "Retain"}},
+                },
+                RollbackTo: &RollbackConfig{Revision: 2},
+                Autoscaling: &Autoscaling{MinReplicas: &minReplicas, MaxReplicas: 5, TargetCPUUtilization: &cpu, Metrics: []autoscalingv2.MetricSpec{{
+                    Type: autoscalingv2.PodsMetricSourceType,
+                    Pods: &autoscalingv2.PodsMetricSource{Metric: autoscalingv2.MetricIdentifier{Name: "rps"}, Target: autoscalingv2.MetricTarget{Type: autoscalingv2.AverageValueMetricType, AverageValue: &qty}},
+                }}},
+                Strategy: &DeliveryStrategy{Type: "Canary", Steps: []int32{10, 50}, StepSeconds: 30, AutoPromote: true, Promote: "abc", Checks: []MetricCheck{{Name: "errors", Query: "sum(rate(errors[1m]))", Max: "0.5"}}},
+            },
+            Status: AppStatus{
+                Ready: true, ObservedGeneration: 3, DesiredReplicas: 2, ReadyReplicas: 2, Revision: "abc", URL: "https://web.example.com", Conditions: conds,
+                Helm:      &HelmReleaseStatus{Chart: "web", Version: "1.0.0", Revision: 2, Digest: "sha", History: []HelmReleaseRevision{{Revision: 1, Version: "0.9.0", Digest: "old", Deployed: now}}},
+                Resources: []ResourceRef{{APIVersion: "v1", Kind: "ConfigMap", Name: "web"}},
+                Hooks:     []HookStatus{{Phase: "pre", Revision: "abc", Result: "Succeeded", Message: "done"}},
+                History:   []AppRevision{{Number: 1, Revision: "abc", ControllerRevision: "web-abc", Applied: now, Healthy: true}},
+                Rollout:   &RolloutStatus{Strategy: "Canary", Revision: "def", StableRevision: "abc", Phase: "Progressing", Step: 1, Weight: 10, StepStarted: now, Message: "step 1"},
+            },
+        },
+        &Policy{
+            ObjectMeta: meta("egress", ""),
+            Spec:       PolicySpec{EgressAllowCIDRs: []string{"10.0.0.0/8"}, NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app.kubeop.io/tenant": "acme"}}},
+            Status:     PolicyStatus{Ready: true, Conditions: conds, Namespaces: []string{"kubeop-acme-web"}, Egress: []networkingv1.NetworkPolicyEgressRule{{To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8"}}}}}},
+        },
+        &Registry{
+            ObjectMeta: meta("ghcr", ""),
+            Spec:       RegistrySpec{Host: "ghcr.io", Username: "acme", PasswordRef: "kubeop-system/ghcr"},
+            Status:     RegistryStatus{Ready: true, Conditions: conds, SecretName: "kubeop-registry-ghcr", Namespaces: []string{"kubeop-acme-web"}},
+        },
+        &DNSRecord{
+            ObjectMeta: meta("web", "kubeop-acme-web"),
+            Spec:       DNSRecordSpec{Host: "web.example.com", Target: "203.0.113.7"},
+            Status:     DNSRecordStatus{Ready: true, Message: "published", Host: "web.example.com", Target: "203.0.113.7", Type: "A", Conditions: conds},
+        },
+        &Certificate{
+            ObjectMeta: meta("web", "kubeop-acme-web"),
+            Spec:       CertificateSpec{Host: "web.example.com", DNSRecordRef: "web", SecretName: "web-tls", Challenge: "dns-01"},
+            Status:     CertificateStatus{Ready: true, Message: "issued", SecretName: "web-tls", NotBefore: &now, NotAfter: &now, RenewalTime: &now, Order: "https://acme.example.com/order/1", Conditions: conds},
+        },
+    }
+}
+
+func Test_ConversionRoundTrip(t *testing.T) {
+    s := runtime.NewScheme()
+    if err := AddToScheme(s); err != nil { t.Fatal(err) }
+    if err := v1beta1.AddToScheme(s); err != nil { t.Fatal(err) }
+    for _, spoke := range spokes() {
+        if ok, err := ctrlconversion.IsConvertible(s, spoke); !ok || err != nil { t.Fatalf("%T is not convertible: %v", spoke, err) }
+        gvks, _, err := s.ObjectKinds(spoke)
+        if err != nil { t.Fatal(err) }
+        kind := gvks[0].Kind
+
+        // v1alpha1 -> v1beta1 -> v1alpha1 keeps every field
+        obj, err := s.New(v1beta1.GroupVersion.WithKind(kind))
+        if err != nil { t.Fatal(err) }
+        hub := obj.(conversion.Hub)
+        if err := spoke.ConvertTo(hub); err != nil { t.Fatalf("%s to hub: %v", kind, err) }
+        if gvk := hub.GetObjectKind().GroupVersionKind(); gvk != v1beta1.GroupVersion.WithKind(kind) { t.Fatalf("%s: unexpected hub kind %v", kind, gvk) }
+        obj, err = s.New(GroupVersion.WithKind(kind))
+        if err != nil { t.Fatal(err) }
+        back := obj.(conversion.Convertible)
+        if err := back.ConvertFrom(hub); err != nil { t.Fatalf("%s from hub: %v", kind, err) }
+        if gvk := back.GetObjectKind().GroupVersionKind(); gvk != GroupVersion.WithKind(kind) { t.Fatalf("%s: unexpected spoke kind %v", kind, gvk) }
+        back.GetObjectKind().SetGroupVersionKind(spoke.GetObjectKind().GroupVersionKind())
+        if !equality.Semantic.DeepEqual(spoke, back) { t.Fatalf("%s changed in a round trip:\n%+v\n%+v", kind, spoke, back) }
+
+        // v1beta1 -> v1alpha1 -> v1beta1 keeps every field
+        obj, err = s.New(v1beta1.GroupVersion.WithKind(kind))
+        if err != nil { t.Fatal(err) }
+        again := obj.(conversion.Hub)
+        if err := back.ConvertTo(again); err != nil { t.Fatal(err) }
+        if !equality.Semantic.DeepEqual(hub, again) { t.Fatalf("%s hub changed in a round trip:\n%+v\n%+v", kind, hub, again) }
+    }
+}
@@ -1,6 +1,14 @@
+// Package v1alpha1 is the original paas.kubeop.io API. It is still served;
+// objects are stored as v1beta1 and converted by the admission server.
+// +kubebuilder:object:generate=true
+// +groupName=paas.kubeop.io
 package v1alpha1
 
 import (
+    autoscalingv2 "k8s.io/api/autoscaling/v2"
+    corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
     runtime "k8s.io/apimachinery/pkg/runtime"
     schema "k8s.io/apimachinery/pkg/runtime/schema"
@@ -24,11 +32,15 @@ func AddToScheme(s *runtime.Scheme) error {
     return nil
 }
 
-// +k8s:deepcopy-gen=false
-// Minimal structs without codegen; rely on runtime.Object interfaces.
-
+// +kubebuilder:validation:XValidation:rule="has(self.name) && size(self.name) > 0",message="spec.name is required"
 type TenantSpec struct {
     Name string `json:"name,omitempty"`
+    // Limits caps the sum of the kubeop-quota hard limits of all the
+    // tenant's projects, keyed like ResourceQuota (e.g. requests.cpu).
+    Limits corev1.ResourceList `json:"limits,omitempty"`
+    // Domains are the DNS names the tenant's Apps, DNSRecords and
+    // Certificates may use as spec.host, together with their subdomains.
+    Domains []string `json:"domains,omitempty"`
 }
 type Condition struct {
     Type               string      `json:"type,omitempty"`
@@ -38,47 +50,100 @@ type Condition struct {
     LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
 }
 type TenantStatus struct {
-    Ready      bool        `json:"ready,omitempty"`
-    Conditions []Condition `json:"conditions,omitempty"`
+    Ready            bool        `json:"ready,omitempty"`
+    Conditions       []Condition `json:"conditions,omitempty"`
+    Projects         int32       `json:"projects,omitempty"`
+    ReadyProjects    int32       `json:"readyProjects,omitempty"`
+    NotReadyProjects int32       `json:"notReadyProjects,omitempty"`
+    // Allocated and Used sum the hard limits and usage of project quotas.
+    Allocated corev1.ResourceList `json:"allocated,omitempty"`
+    Used      corev1.ResourceList `json:"used,omitempty"`
 }
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName=ten
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Projects",type=integer,JSONPath=`.status.projects`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:deprecatedversion:warning="paas.kubeop.io/v1alpha1 is deprecated; use paas.kubeop.io/v1beta1"
 type Tenant struct {
     metav1.TypeMeta   `json:",inline"`
     metav1.ObjectMeta `json:"metadata,omitempty"`
     Spec              TenantSpec   `json:"spec,omitempty"`
     Status            TenantStatus `json:"status,omitempty"`
 }
-func (t *Tenant) DeepCopyObject() runtime.Object { return t }
+// +kubebuilder:object:root=true
 type TenantList struct {
     metav1.TypeMeta `json:",inline"`
     metav1.ListMeta `json:"metadata,omitempty"`
     Items           []Tenant `json:"items"`
 }
-func (t *TenantList) DeepCopyObject() runtime.Object { return t }
 
+// +kubebuilder:validation:XValidation:rule="has(self.tenantRef) && size(self.tenantRef) > 0",message="spec.tenantRef is required"
+// +kubebuilder:validation:XValidation:rule="has(self.name) && size(self.name) > 0",message="spec.name is required"
 type ProjectSpec struct {
     TenantRef string `json:"tenantRef,omitempty"`
     Name      string `json:"name,omitempty"`
+    // Resources override the operator's project defaults key by key.
+    ProjectResources `json:",inline"`
+}
+// ProjectResources sizes a project namespace. The same fields form the
+// operator-wide project defaults.
+type ProjectResources struct {
+    // Quota is the kubeop-quota hard limit, keyed like ResourceQuota.
+    Quota corev1.ResourceList `json:"quota,omitempty"`
+    // DefaultRequest and DefaultLimit are the container defaults of the
+    // kubeop-defaults LimitRange.
+    DefaultRequest corev1.ResourceList `json:"defaultRequest,omitempty"`
+    DefaultLimit   corev1.ResourceList `json:"defaultLimit,omitempty"`
+    Storage        *ProjectStorage     `json:"storage,omitempty"`
+}
+// ProjectStorage caps persistent storage; it is added to the quota.
+type ProjectStorage struct {
+    // Requests caps the total requests.storage of all claims.
+    Requests *resource.Quantity `json:"requests,omitempty"`
+    // PersistentVolumeClaims caps the number of claims.
+    // +kubebuilder:validation:Minimum=0
+    PersistentVolumeClaims *int64 `json:"persistentVolumeClaims,omitempty"`
+    // Classes caps requests.storage per storage class.
+    Classes map[string]resource.Quantity `json:"classes,omitempty"`
 }
 type ProjectStatus struct {
     Namespace  string      `json:"namespace,omitempty"`
     Ready      bool        `json:"ready,omitempty"`
+    // Quota is the kubeop-quota hard limit applied to the namespace.
+    Quota      corev1.ResourceList `json:"quota,omitempty"`
     Conditions []Condition `json:"conditions,omitempty"`
 }
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName=proj
+// +kubebuilder:printcolumn:name="Namespace",type=string,JSONPath=`.status.namespace`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:deprecatedversion:warning="paas.kubeop.io/v1alpha1 is deprecated; use paas.kubeop.io/v1beta1"
 type Project struct {
     metav1.TypeMeta   `json:",inline"`
     metav1.ObjectMeta `json:"metadata,omitempty"`
     Spec              ProjectSpec   `json:"spec,omitempty"`
     Status            ProjectStatus `json:"status,omitempty"`
 }
-func (p *Project) DeepCopyObject() runtime.Object { return p }
+// +kubebuilder:object:root=true
 type ProjectList struct {
     metav1.TypeMeta `json:",inline"`
     metav1.ListMeta `json:"metadata,omitempty"`
     Items           []Project `json:"items"`
 }
-func (p *ProjectList) DeepCopyObject() runtime.Object { return p }
 
+// +kubebuilder:validation:XValidation:rule="self.type == 'Image' ? has(self.image) : true",message="spec.image required when type=Image"
+// +kubebuilder:validation:XValidation:rule="self.type == 'Git' ? has(self.git) && has(self.git.repo) : true",message="spec.git.repo required when type=Git"
+// +kubebuilder:validation:XValidation:rule="self.type == 'Helm' ? has(self.helm) && has(self.helm.chart) : true",message="spec.helm.chart required when type=Helm"
+// +kubebuilder:validation:XValidation:rule="self.type == 'Raw' ? has(self.rawManifests) && size(self.rawManifests) > 0 : true",message="spec.rawManifests required when type=Raw"
+// +kubebuilder:validation:XValidation:rule="has(self.strategy) && has(self.strategy.type) && self.strategy.type != 'RollingUpdate' ? self.type == 'Image' : true",message="spec.strategy applies to type=Image"
+// +kubebuilder:validation:XValidation:rule="has(self.volumes) && size(self.volumes) > 0 ? self.type == 'Image' : true",message="spec.volumes applies to type=Image"
+// +kubebuilder:validation:XValidation:rule="has(self.volumes) && size(self.volumes) > 0 && has(self.strategy) && has(self.strategy.type) ? self.strategy.type == 'RollingUpdate' : true",message="spec.volumes cannot be combined with Canary or BlueGreen delivery"
 type AppSpec struct {
+    // +kubebuilder:validation:Enum=Image;Git;Helm;Raw
     Type  string `json:"type,omitempty"`
     Image string `json:"image,omitempty"`
     Host  string `json:"host,omitempty"`
@@ -86,6 +151,110 @@ type AppSpec struct {
     Helm  *HelmSource `json:"helm,omitempty"`
     RawManifests string `json:"rawManifests,omitempty"`
     Hooks *Hooks `json:"hooks,omitempty"`
+    // Workload configures the container of Image Apps.
+    Workload `json:",inline"`
+    // RollbackTo restores the spec of a revision in status.history; it is
+    // cleared once the rollback is applied.
+    RollbackTo *RollbackConfig `json:"rollbackTo,omitempty"`
+    // Autoscaling replaces spec.replicas with a HorizontalPodAutoscaler.
+    Autoscaling *Autoscaling `json:"autoscaling,omitempty"`
+    // Strategy rolls Image updates out next to the running revision; by
+    // default the image is replaced in place.
+    Strategy *DeliveryStrategy `json:"strategy,omitempty"`
+}
+// Workload is the container and scale of an Image App. Every field except
+// Replicas is part of the App revision.
+type Workload struct {
+    // Replicas defaults to 1.
+    // +kubebuilder:validation:Minimum=0
+    Replicas *int32 `json:"replicas,omitempty"`
+    // Ports the container listens on; the first one backs the App Service.
+    // Defaults to port 80.
+    Ports          []corev1.ContainerPort      `json:"ports,omitempty"`
+    Command        []string                    `json:"command,omitempty"`
+    Args           []string                    `json:"args,omitempty"`
+    Env            []corev1.EnvVar             `json:"env,omitempty"`
+    EnvFrom        []corev1.EnvFromSource      `json:"envFrom,omitempty"`
+    Resources      corev1.ResourceRequirements `json:"resources,omitempty"`
+    LivenessProbe  *corev1.Probe               `json:"livenessProbe,omitempty"`
+    ReadinessProbe *corev1.Probe               `json:"readinessProbe,omitempty"`
+    // Volumes are PersistentVolumeClaims mounted into the container.
+    // +listType=map
+    // +listMapKey=name
+    Volumes        []Volume                    `json:"volumes,omitempty"`
+}
+// Volume is a PersistentVolumeClaim app-<app>-<name> owned by the App.
+type Volume struct {
+    // +kubebuilder:validation:MaxLength=63
+    // +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+    Name             string            `json:"name"`
+    // +kubebuilder:validation:Pattern=`^/`
+    MountPath        string            `json:"mountPath"`
+    Size             resource.Quantity `json:"size"`
+    // StorageClassName defaults to the cluster default class.
+    StorageClassName *string           `json:"storageClassName,omitempty"`
+    // AccessMode defaults to ReadWriteOnce.
+    // +kubebuilder:validation:Enum=ReadWriteOnce;ReadOnlyMany;ReadWriteMany;ReadWriteOncePod
+    AccessMode       corev1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+    // RetentionPolicy is Delete (the default) or Retain, which keeps the claim
+    // when the volume is removed or the App is deleted.
+    // +kubebuilder:validation:Enum=Delete;Retain
+    RetentionPolicy  string            `json:"retentionPolicy,omitempty"`
+}
+// Autoscaling scales an Image App between MinReplicas and MaxReplicas. The
+// utilization targets are percentages of the container requests; without
+// any target the App scales on 80% CPU.
+// +kubebuilder:validation:XValidation:rule="!has(self.minReplicas) || self.minReplicas <= self.maxReplicas",message="spec.autoscaling.minReplicas must not exceed maxReplicas"
+type Autoscaling struct {
+    // MinReplicas defaults to 1.
+    // +kubebuilder:validation:Minimum=1
+    MinReplicas             *int32 `json:"minReplicas,omitempty"`
+    // +kubebuilder:validation:Minimum=1
+    MaxReplicas             int32  `json:"maxReplicas"`
+    // +kubebuilder:validation:Minimum=1
+    TargetCPUUtilization    *int32 `json:"targetCPUUtilization,omitempty"`
+    // +kubebuilder:validation:Minimum=1
+    TargetMemoryUtilization *int32 `json:"targetMemoryUtilization,omitempty"`
+    // Metrics are further targets, e.g. Pods or External metrics.
+    Metrics []autoscalingv2.MetricSpec `json:"metrics,omitempty"`
+}
+// DeliveryStrategy configures progressive delivery of Image Apps.
+type DeliveryStrategy struct {
+    // Type is RollingUpdate (the default), Canary or BlueGreen.
+    // +kubebuilder:validation:Enum=RollingUpdate;Canary;BlueGreen
+    Type string `json:"type,omitempty"`
+    // Steps are the traffic percentages a Canary candidate receives in turn
+    // before it is promoted. Defaults to 10 and 50.
+    // +kubebuilder:validation:items:Minimum=1
+    // +kubebuilder:validation:items:Maximum=100
+    Steps []int32 `json:"steps,omitempty"`
+    // StepSeconds is how long the candidate must stay healthy at each canary
+    // step, or before a BlueGreen candidate is auto promoted. Defaults to 60.
+    // +kubebuilder:validation:Minimum=0
+    StepSeconds int32 `json:"stepSeconds,omitempty"`
+    // AutoPromote promotes a BlueGreen candidate after StepSeconds; otherwise
+    // it waits for Promote.
+    AutoPromote bool `json:"autoPromote,omitempty"`
+    // Promote approves the BlueGreen candidate whose status.rollout.revision
+    // it names.
+    Promote string `json:"promote,omitempty"`
+    // Checks gate every step; a check out of bounds aborts the rollout.
+    Checks []MetricCheck `json:"checks,omitempty"`
+}
+// MetricCheck is a Prometheus instant query whose value must stay within
+// Min and Max. $app, $namespace and $deployment in the query are replaced
+// with the App name, its namespace and the candidate Deployment.
+type MetricCheck struct {
+    Name  string `json:"name"`
+    Query string `json:"query"`
+    // +kubebuilder:validation:Pattern=`^-?[0-9]+(\.[0-9]+)?$`
+    Min   string `json:"min,omitempty"`
+    // +kubebuilder:validation:Pattern=`^-?[0-9]+(\.[0-9]+)?$`
+    Max   string `json:"max,omitempty"`
+}
+type RollbackConfig struct {
+    // +kubebuilder:validation:Minimum=1
+    Revision int64 `json:"revision"`
 }
 type GitSource struct {
     Repo string `json:"repo,omitempty"`
@@ -101,57 +270,172 @@ type Hook struct { Image string `json:"image,omitempty"`; Args []string `json:"a
 type Hooks struct { Pre []Hook `json:"pre,omitempty"`; Post []Hook `json:"post,omitempty"` }
 type AppStatus struct {
     Ready      bool        `json:"ready,omitempty"`
+    // ObservedGeneration is the App generation this status reflects.
+    ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+    // DesiredReplicas and ReadyReplicas mirror the App's Deployment.
+    DesiredReplicas int32 `json:"desiredReplicas,omitempty"`
+    ReadyReplicas   int32 `json:"readyReplicas,omitempty"`
     Revision   string      `json:"revision,omitempty"`
+    // URL is where the App is reachable when spec.host is set.
+    URL        string      `json:"url,omitempty"`
     Conditions []Condition `json:"conditions,omitempty"`
+    Helm       *HelmReleaseStatus `json:"helm,omitempty"`
+    Resources  []ResourceRef      `json:"resources,omitempty"`
+    Hooks      []HookStatus       `json:"hooks,omitempty"`
+    // History lists the latest applied revisions, oldest first.
+    History    []AppRevision      `json:"history,omitempty"`
+    // Rollout is the latest progressive rollout.
+    Rollout    *RolloutStatus     `json:"rollout,omitempty"`
+}
+// RolloutStatus tracks a Canary or BlueGreen rollout of an Image App.
+type RolloutStatus struct {
+    Strategy       string `json:"strategy,omitempty"`
+    // Revision is the candidate; StableRevision serves the remaining traffic.
+    Revision       string `json:"revision,omitempty"`
+    StableRevision string `json:"stableRevision,omitempty"`
+    // Phase is Progressing, Paused, Promoting, Succeeded or Aborted.
+    // +kubebuilder:validation:Enum=Progressing;Paused;Promoting;Succeeded;Aborted
+    Phase          string `json:"phase,omitempty"`
+    Step           int32  `json:"step,omitempty"`
+    // Weight is the percentage of traffic routed to the candidate.
+    Weight         int32  `json:"weight,omitempty"`
+    StepStarted    metav1.Time `json:"stepStarted,omitempty"`
+    Message        string `json:"message,omitempty"`
+}
+// AppRevision is an applied App spec, stored in full in a ControllerRevision.
+type AppRevision struct {
+    Number             int64       `json:"number"`
+    Revision           string      `json:"revision,omitempty"`
+    ControllerRevision string      `json:"controllerRevision,omitempty"`
+    Applied            metav1.Time `json:"applied,omitempty"`
+    // Healthy is set once the revision became Ready.
+    Healthy            bool        `json:"healthy,omitempty"`
 }
+// HookStatus is the outcome of the latest hook run of a phase (pre or post).
+type HookStatus struct {
+    // +kubebuilder:validation:Enum=pre;post
+    Phase    string `json:"phase,omitempty"`
+    Revision string `json:"revision,omitempty"`
+    // +kubebuilder:validation:Enum=Running;Succeeded;Failed
+    Result   string `json:"result,omitempty"`
+    Message  string `json:"message,omitempty"`
+}
+// ResourceRef identifies an object the App applied into its namespace.
+type ResourceRef struct {
+    APIVersion string `json:"apiVersion,omitempty"`
+    Kind       string `json:"kind,omitempty"`
+    Name       string `json:"name,omitempty"`
+}
+type HelmReleaseStatus struct {
+    Chart    string `json:"chart,omitempty"`
+    Version  string `json:"version,omitempty"`
+    Revision int    `json:"revision,omitempty"`
+    Digest   string `json:"digest,omitempty"`
+    History  []HelmReleaseRevision `json:"history,omitempty"`
+}
+type HelmReleaseRevision struct {
+    Revision int         `json:"revision,omitempty"`
+    Version  string      `json:"version,omitempty"`
+    Digest   string      `json:"digest,omitempty"`
+    Deployed metav1.Time `json:"deployed,omitempty"`
+}
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="Host",type=string,JSONPath=`.spec.host`
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`,priority=1
+// +kubebuilder:printcolumn:name="Revision",type=string,JSONPath=`.status.revision`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Rollout",type=string,JSONPath=`.status.rollout.phase`,priority=1
+// +kubebuilder:printcolumn:name="Replicas",type=string,JSONPath=`.status.readyReplicas`,priority=1
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:deprecatedversion:warning="paas.kubeop.io/v1alpha1 is deprecated; use paas.kubeop.io/v1beta1"
 type App struct {
     metav1.TypeMeta   `json:",inline"`
     metav1.ObjectMeta `json:"metadata,omitempty"`
     Spec              AppSpec   `json:"spec,omitempty"`
     Status            AppStatus `json:"status,omitempty"`
 }
-func (a *App) DeepCopyObject() runtime.Object { return a }
+// +kubebuilder:object:root=true
 type AppList struct {
     metav1.TypeMeta `json:",inline"`
     metav1.ListMeta `json:"metadata,omitempty"`
     Items           []App `json:"items"`
 }
-func (a *AppList) DeepCopyObject() runtime.Object { return a }
 
+// +kubebuilder:validation:XValidation:rule="!has(self.egressAllowCIDRs) || size(self.egressAllowCIDRs) <= 64",message="egressAllowCIDRs list too large"
 type PolicySpec struct {
     EgressAllowCIDRs []string `json:"egressAllowCIDRs,omitempty"`
+    // NamespaceSelector picks the project namespaces the policy applies to;
+    // empty selects every project namespace.
+    NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+type PolicyStatus struct {
+    Ready      bool        `json:"ready,omitempty"`
+    Conditions []Condition `json:"conditions,omitempty"`
+    // Namespaces whose kubeop-egress NetworkPolicy includes this policy.
+    Namespaces []string `json:"namespaces,omitempty"`
+    // Egress holds the rules generated from this policy, DNS included.
+    Egress []networkingv1.NetworkPolicyEgressRule `json:"egress,omitempty"`
 }
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:deprecatedversion:warning="paas.kubeop.io/v1alpha1 is deprecated; use paas.kubeop.io/v1beta1"
 type Policy struct {
     metav1.TypeMeta   `json:",inline"`
     metav1.ObjectMeta `json:"metadata,omitempty"`
-    Spec              PolicySpec `json:"spec,omitempty"`
+    Spec              PolicySpec   `json:"spec,omitempty"`
+    Status            PolicyStatus `json:"status,omitempty"`
 }
-func (p *Policy) DeepCopyObject() runtime.Object { return p }
+// +kubebuilder:object:root=true
 type PolicyList struct {
     metav1.TypeMeta `json:",inline"`
     metav1.ListMeta `json:"metadata,omitempty"`
     Items           []Policy `json:"items"`
 }
-func (p *PolicyList) DeepCopyObject() runtime.Object { return p }
 
+// +kubebuilder:validation:XValidation:rule="has(self.host) && size(self.host) > 0",message="spec.host is required"
+// +kubebuilder:validation:XValidation:rule="!(has(self.username)) || has(self.passwordRef)",message="spec.passwordRef must be set when username provided"
 type RegistrySpec struct {
     Host       string `json:"host,omitempty"`
     Username   string `json:"username,omitempty"`
+    // PasswordRef names a Secret as "[namespace/]name" holding the password
+    // under the "password" key; the namespace defaults to kubeop-system.
     PasswordRef string `json:"passwordRef,omitempty"`
 }
+type RegistryStatus struct {
+    Ready      bool        `json:"ready,omitempty"`
+    Conditions []Condition `json:"conditions,omitempty"`
+    // SecretName is the pull secret created in every project namespace.
+    SecretName string   `json:"secretName,omitempty"`
+    Namespaces []string `json:"namespaces,omitempty"`
+}
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Host",type=string,JSONPath=`.spec.host`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:deprecatedversion:warning="paas.kubeop.io/v1alpha1 is deprecated; use paas.kubeop.io/v1beta1"
 type Registry struct {
     metav1.TypeMeta   `json:",inline"`
     metav1.ObjectMeta `json:"metadata,omitempty"`
-    Spec              RegistrySpec `json:"spec,omitempty"`
+    Spec              RegistrySpec   `json:"spec,omitempty"`
+    Status            RegistryStatus `json:"status,omitempty"`
 }
-func (r *Registry) DeepCopyObject() runtime.Object { return r }
+// +kubebuilder:object:root=true
 type RegistryList struct {
     metav1.TypeMeta `json:",inline"`
     metav1.ListMeta `json:"metadata,omitempty"`
     Items           []Registry `json:"items"`
 }
-func (r *RegistryList) DeepCopyObject() runtime.Object { return r }
 
+// +kubebuilder:validation:XValidation:rule="has(self.host) && size(self.host) > 0",message="spec.host is required"
+// +kubebuilder:validation:XValidation:rule="has(self.target) && size(self.target) > 0",message="spec.target is required"
 type DNSRecordSpec struct {
     Host   string `json:"host,omitempty"`
     Target string `json:"target,omitempty"`
@@ -159,39 +443,75 @@ type DNSRecordSpec struct {
 type DNSRecordStatus struct {
     Ready   bool   `json:"ready,omitempty"`
     Message string `json:"message,omitempty"`
+    // Host, Target and Type describe the record currently published.
+    Host       string      `json:"host,omitempty"`
+    Target     string      `json:"target,omitempty"`
+    Type       string      `json:"type,omitempty"`
+    Conditions []Condition `json:"conditions,omitempty"`
 }
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Host",type=string,JSONPath=`.spec.host`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.ready`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:deprecatedversion:warning="paas.kubeop.io/v1alpha1 is deprecated; use paas.kubeop.io/v1beta1"
 type DNSRecord struct {
     metav1.TypeMeta   `json:",inline"`
     metav1.ObjectMeta `json:"metadata,omitempty"`
     Spec              DNSRecordSpec   `json:"spec,omitempty"`
     Status            DNSRecordStatus `json:"status,omitempty"`
 }
-func (d *DNSRecord) DeepCopyObject() runtime.Object { return d }
+// +kubebuilder:object:root=true
 type DNSRecordList struct {
     metav1.TypeMeta `json:",inline"`
     metav1.ListMeta `json:"metadata,omitempty"`
     Items           []DNSRecord `json:"items"`
 }
-func (d *DNSRecordList) DeepCopyObject() runtime.Object { return d }
 
+// +kubebuilder:validation:XValidation:rule="has(self.host) && size(self.host) > 0",message="spec.host is required"
 type CertificateSpec struct {
     Host        string `json:"host,omitempty"`
     DNSRecordRef string `json:"dnsRecordRef,omitempty"`
+    // SecretName is the kubernetes.io/tls Secret the certificate is stored in,
+    // <name>-tls when empty.
+    SecretName string `json:"secretName,omitempty"`
+    // Challenge is the ACME challenge used to prove control of Host:
+    // http-01 (the default) or dns-01.
+    // +kubebuilder:validation:Enum=http-01;dns-01
+    Challenge string `json:"challenge,omitempty"`
 }
 type CertificateStatus struct {
     Ready   bool   `json:"ready,omitempty"`
     Message string `json:"message,omitempty"`
+    // SecretName is set once the Secret holds an issued certificate.
+    SecretName string `json:"secretName,omitempty"`
+    // NotBefore and NotAfter are the validity of the stored certificate.
+    NotBefore *metav1.Time `json:"notBefore,omitempty"`
+    NotAfter  *metav1.Time `json:"notAfter,omitempty"`
+    // RenewalTime is when the stored certificate is due for renewal.
+    RenewalTime *metav1.Time `json:"renewalTime,omitempty"`
+    // Order is the URL of the ACME order in progress, polled until the CA
+    // has validated the host.
+    Order      string      `json:"order,omitempty"`
+    Conditions []Condition `json:"conditions,omitempty"`
 }
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Host",type=string,JSONPath=`.spec.host`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.ready`
+// +kubebuilder:printcolumn:name="Expires",type=date,JSONPath=`.status.notAfter`
+// +kubebuilder:printcolumn:name="Renewal",type=date,JSONPath=`.status.renewalTime`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:deprecatedversion:warning="paas.kubeop.io/v1alpha1 is deprecated; use paas.kubeop.io/v1beta1"
 type Certificate struct {
     metav1.TypeMeta   `json:",inline"`
     metav1.ObjectMeta `json:"metadata,omitempty"`
     Spec              CertificateSpec   `json:"spec,omitempty"`
     Status            CertificateStatus `json:"status,omitempty"`
 }
-func (c *Certificate) DeepCopyObject() runtime.Object { return c }
+// +kubebuilder:object:root=true
 type CertificateList struct {
     metav1.TypeMeta `json:",inline"`
     metav1.ListMeta `json:"metadata,omitempty"`
     Items           []Certificate `json:"items"`
 }
-func (c *CertificateList) DeepCopyObject() runtime.Object { return c }
@@ -0,0 +1,12 @@
+package v1beta1
+
+// v1beta1 is the conversion hub: the stored version every other version
+// converts to and from.
+
+func (*Tenant) Hub()      {}
+func (*Project) Hub()     {}
+func (*App) Hub()         {}
+func (*Policy) Hub()      {}
+func (*Registry) Hub()    {}
+func (*DNSRecord) Hub()   {}
+func (*Certificate) Hub() {}
@@ -0,0 +1,22 @@
+// Package v1beta1 is the paas.kubeop.io API served and stored by default.
+// v1alpha1 objects are converted to it by the conversion webhook of the
+// admission server.
+// +kubebuilder:object:generate=true
+// +groupName=paas.kubeop.io
+package v1beta1
+
+import (
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+    // GroupVersion for this API.
+    GroupVersion = schema.GroupVersion{Group: "paas.kubeop.io", Version: "v1beta1"}
+
+    // SchemeBuilder registers the types of this API.
+    SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+    // AddToScheme registers types to a scheme.
+    AddToScheme = SchemeBuilder.AddToScheme
+)
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+    "context"
+
+    appsv1 "k8s.io/api/apps/v1"
+    autoscalingv2 "k8s.io/api/autoscaling/v2"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/equality"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/types"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// defaultTargetCPU is the CPU utilization Apps scale on without targets.
+const defaultTargetCPU = 80
+
+// autoscaled reports whether an HPA owns the replica count of a.
+func autoscaled(a *v1beta1.App) bool {
+    return a.Spec.Type == "Image" && a.Spec.Autoscaling != nil
+}
+
+// hpaSpec scales the App Deployment as configured in spec.autoscaling.
+func hpaSpec(a *v1beta1.App) autoscalingv2.HorizontalPodAutoscalerSpec {
+    as := a.Spec.Autoscaling
+    min := int32(1)
+    if as.MinReplicas != nil { min = *as.MinReplicas }
+    utilization := func(name corev1.ResourceName, target int32) autoscalingv2.MetricSpec {
+        return autoscalingv2.MetricSpec{Type: autoscalingv2.ResourceMetricSourceType, Resource: &autoscalingv2.ResourceMetricSource{
+            Name:   name,
+            Target: autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType, AverageUtilization: &target},
+        }}
+    }
+    var metrics []autoscalingv2.MetricSpec
+    if as.TargetCPUUtilization != nil { metrics = append(metrics, utilization(corev1.ResourceCPU, *as.TargetCPUUtilization)) }
+    if as.TargetMemoryUtilization != nil { metrics = append(metrics, utilization(corev1.ResourceMemory, *as.TargetMemoryUtilization)) }
+    metrics = append(metrics, as.Metrics...)
+    if len(metrics) == 0 { metrics = append(metrics, utilization(corev1.ResourceCPU, defaultTargetCPU)) }
+    return autoscalingv2.HorizontalPodAutoscalerSpec{
+        ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "Deployment", Name: "app-" + a.Name},
+        MinReplicas:    &min,
+        MaxReplicas:    as.MaxReplicas,
+        Metrics:        metrics,
+    }
+}
+
+// ensureHPA gives autoscaled Apps an HPA for their Deployment and removes it
+// once spec.autoscaling is cleared.
+func (r *AppReconciler) ensureHPA(ctx context.Context, a *v1beta1.App) error {
+    name := "app-" + a.Name
+    if !autoscaled(a) { return r.deleteOwned(ctx, a, &autoscalingv2.HorizontalPodAutoscaler{}, name) }
+    spec := hpaSpec(a)
+    var hpa autoscalingv2.HorizontalPodAutoscaler
+    err := r.Get(ctx, types.NamespacedName{Namespace: a.Namespace, Name: name}, &hpa)
+    if apierrors.IsNotFound(err) {
+        hpa = autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: appObjectMeta(a, name), Spec: spec}
+        if err := controllerutil.SetControllerReference(a, &hpa, r.Scheme()); err != nil { return err }
+        return r.Create(ctx, &hpa)
+    }
+    if err != nil { return err }
+    if equality.Semantic.DeepEqual(hpa.Spec, spec) { return nil }
+    hpa.Spec = spec
+    return r.Update(ctx, &hpa)
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+    "context"
+    "testing"
+
+    appsv1 "k8s.io/api/apps/v1"
+    autoscalingv2 "k8s.io/api/autoscaling/v2"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_AppAutoscaling(t *testing.T) {
+    ctx := context.Background()
+    ns := "kubeop-acme-web"
+    min, cpu := int32(2), int32(70)
+    app := &v1beta1.App{
+        ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: ns, Generation: 1},
+        Spec:       v1beta1.AppSpec{Type: "Image", Image: "nginx:1.27", Autoscaling: &v1beta1.Autoscaling{MinReplicas: &min, MaxReplicas: 5, TargetCPUUtilization: &cpu}},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(app).
+        WithStatusSubresource(&v1beta1.App{}, &appsv1.Deployment{}).Build()
+    r := &AppReconciler{Client: c}
+    req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(app)}
+    key := client.ObjectKey{Namespace: ns, Name: "app-web"}
+    reconcileApp := func() *appsv1.Deployment {
+        t.Helper()
+        if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+        var d appsv1.Deployment
+        if err := c.Get(ctx, key, &d); err != nil { t.Fatal(err) }
+        return &d
+    }
+
+    if d := reconcileApp(); *d.Spec.Replicas != 2 { t.Fatalf("expected the minimum replicas, got %d", *d.Spec.Replicas) }
+    var hpa autoscalingv2.HorizontalPodAutoscaler
+    if err := c.Get(ctx, key, &hpa); err != nil { t.Fatal(err) }
+    if !metav1.IsControlledBy(&hpa, app) || hpa.Spec.ScaleTargetRef.Name != "app-web" || *hpa.Spec.MinReplicas != 2 || hpa.Spec.MaxReplicas != 5 { t.Fatalf("unexpected hpa %+v", hpa.Spec) }
+    if m := hpa.Spec.Metrics; len(m) != 1 || m[0].Resource.Name != corev1.ResourceCPU || *m[0].Resource.Target.AverageUtilization != 70 { t.Fatalf("unexpected metrics %+v", m) }
+
+    // the replica count set by the HPA is kept
+    d := reconcileApp()
+    scaled := int32(4)
+    d.Spec.Replicas = &scaled
+    if err := c.Update(ctx, d); err != nil { t.Fatal(err) }
+    if d = reconcileApp(); *d.Spec.Replicas != 4 { t.Fatalf("replicas reset to %d", *d.Spec.Replicas) }
+
+    // custom metrics are passed through and replace the CPU default
+    var cur v1beta1.App
+    if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+    cur.Spec.Autoscaling.TargetCPUUtilization = nil
+    cur.Spec.Autoscaling.Metrics = []autoscalingv2.MetricSpec{{Type: autoscalingv2.PodsMetricSourceType, Pods: &autoscalingv2.PodsMetricSource{Metric: autoscalingv2.MetricIdentifier{Name: "http_requests"}}}}
+    if err := c.Update(ctx, &cur); err != nil { t.Fatal(err) }
+    reconcileApp()
+    if err := c.Get(ctx, key, &hpa); err != nil { t.Fatal(err) }
+    if m := hpa.Spec.Metrics; len(m) != 1 || m[0].Pods == nil || m[0].Pods.Metric.Name != "http_requests" { t.Fatalf("unexpected metrics %+v", m) }
+
+    // without autoscaling the HPA goes and spec.replicas applies again
+    if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+    cur.Spec.Autoscaling = nil
+    if err := c.Update(ctx, &cur); err != nil { t.Fatal(err) }
+    if d = reconcileApp(); *d.Spec.Replicas != 1 { t.Fatalf("expected 1 replica, got %d", *d.Spec.Replicas) }
+    if err := c.Get(ctx, key, &hpa); !apierrors.IsNotFound(err) { t.Fatalf("expected hpa removed: %v", err) }
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    "k8s.io/apimachinery/pkg/api/equality"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/event"
+    "sigs.k8s.io/controller-runtime/pkg/predicate"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// fieldManager is the server-side apply field manager kubeOP writes project
+// baseline objects with.
+const fieldManager = client.FieldOwner("kubeop")
+
+// driftReportPeriod is how long the Drifted condition stays True after kubeOP
+// reverted a manual change to a baseline object.
+const driftReportPeriod = 10 * time.Minute
+
+// baseline is an object kubeOP keeps in every project namespace.
+type baseline struct {
+    // desired is applied; current receives the object found in the cluster.
+    desired, current client.Object
+    // same reports whether current matches desired.
+    same func() bool
+    // reset copies the desired spec onto current.
+    reset func()
+}
+
+// applyBaseline server-side applies b.desired, forcing ownership of its fields
+// so edits of them are reverted. Fields another manager added are not touched
+// by an apply, so a still drifted object is overwritten with an update. The
+// returned message describes the drift that was corrected, if any; a missing
+// object counts as drift once the project is bootstrapped.
+func applyBaseline(ctx context.Context, c client.Client, b baseline, bootstrapped bool) (string, error) {
+    gvk, err := c.GroupVersionKindFor(b.desired)
+    if err != nil { return "", err }
+    drift := ""
+    err = c.Get(ctx, client.ObjectKeyFromObject(b.desired), b.current)
+    switch {
+    case apierrors.IsNotFound(err):
+        if bootstrapped { drift = fmt.Sprintf("%s %s was deleted", gvk.Kind, b.desired.GetName()) }
+    case err != nil:
+        return "", err
+    case !b.same():
+        drift = fmt.Sprintf("%s %s was modified", gvk.Kind, b.desired.GetName())
+    }
+    raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(b.desired)
+    if err != nil { return "", err }
+    obj := &unstructured.Unstructured{Object: raw}
+    obj.SetGroupVersionKind(gvk)
+    unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+    unstructured.RemoveNestedField(obj.Object, "status")
+    if err := c.Apply(ctx, client.ApplyConfigurationFromUnstructured(obj), fieldManager, client.ForceOwnership); err != nil {
+        return "", fmt.Errorf("apply %s %s: %w", gvk.Kind, b.desired.GetName(), err)
+    }
+    if drift == "" { return "", nil }
+    if err := c.Get(ctx, client.ObjectKeyFromObject(b.desired), b.current); err != nil { return "", err }
+    if !b.same() {
+        b.reset()
+        if err := c.Update(ctx, b.current, fieldManager); err != nil { return "", err }
+    }
+    return drift, nil
+}
+
+// baselineOwner returns the controller reference of ns, the Project, so
+// baseline objects are watched and collected with their Project.
+func baselineOwner(ns *corev1.Namespace) []metav1.OwnerReference {
+    if ref := metav1.GetControllerOf(ns); ref != nil { return []metav1.OwnerReference{*ref} }
+    return nil
+}
+
+func limitRangeBaseline(ns *corev1.Namespace, res v1beta1.ProjectResources) baseline {
+    desired := &corev1.LimitRange{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-defaults", Namespace: ns.Name, OwnerReferences: baselineOwner(ns)}, Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+        Type:           corev1.LimitTypeContainer,
+        DefaultRequest: res.DefaultRequest,
+        Default:        res.DefaultLimit,
+    }}}}
+    current := &corev1.LimitRange{}
+    return baseline{desired: desired, current: current,
+        same:  func() bool { return equality.Semantic.DeepEqual(current.Spec, desired.Spec) },
+        reset: func() { current.Spec = desired.Spec },
+    }
+}
+
+func resourceQuotaBaseline(ns *corev1.Namespace, hard corev1.ResourceList) baseline {
+    desired := &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-quota", Namespace: ns.Name, OwnerReferences: baselineOwner(ns)}, Spec: corev1.ResourceQuotaSpec{Hard: hard}}
+    current := &corev1.ResourceQuota{}
+    return baseline{desired: desired, current: current,
+        same:  func() bool { return equality.Semantic.DeepEqual(current.Spec, desired.Spec) },
+        reset: func() { current.Spec = desired.Spec },
+    }
+}
+
+// ingressIsolationBaseline allows ingress only from pods within the same
+// namespace, effectively blocking cross-namespace traffic, and from the
+// ingress controller and gateway namespaces that route to Apps.
+func ingressIsolationBaseline(ns *corev1.Namespace, ingressNamespaces []string) baseline {
+    from := []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}
+    if len(ingressNamespaces) > 0 {
+        from = append(from, networkingv1.NetworkPolicyPeer{NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+            {Key: corev1.LabelMetadataName, Operator: metav1.LabelSelectorOpIn, Values: ingressNamespaces},
+        }}})
+    }
+    desired := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-ingress", Namespace: ns.Name, OwnerReferences: baselineOwner(ns)}, Spec: networkingv1.NetworkPolicySpec{
+        PodSelector: metav1.LabelSelector{},
+        PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+        Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: from}},
+    }}
+    current := &networkingv1.NetworkPolicy{}
+    return baseline{desired: desired, current: current,
+        same:  func() bool { return equality.Semantic.DeepEqual(current.Spec, desired.Spec) },
+        reset: func() { current.Spec = desired.Spec },
+    }
+}
+
+// egressBaseline renders the Policies selecting ns into its kubeop-egress
+// NetworkPolicy.
+func egressBaseline(ns *corev1.Namespace, policies []v1beta1.Policy) baseline {
+    desired := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-egress", Namespace: ns.Name, OwnerReferences: baselineOwner(ns)}, Spec: networkingv1.NetworkPolicySpec{
+        PodSelector: metav1.LabelSelector{},
+        PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+        Egress:      desiredEgress(ns, policies),
+    }}
+    current := &networkingv1.NetworkPolicy{}
+    return baseline{desired: desired, current: current,
+        same:  func() bool { return equality.Semantic.DeepEqual(current.Spec, desired.Spec) },
+        reset: func() { current.Spec = desired.Spec },
+    }
+}
+
+// reportDrift sets the Drifted condition of p from the drift corrected in this
+// reconcile. A report is kept for driftReportPeriod, since the correction
+// itself triggers the next reconcile; the returned duration is when it can be
+// cleared.
+func reportDrift(p *v1beta1.Project, drift []string) time.Duration {
+    if len(drift) > 0 {
+        setCondition(&p.Status.Conditions, "Drifted", "True", "DriftReverted", "Reverted manual changes: "+strings.Join(drift, ", "))
+        return driftReportPeriod
+    }
+    for _, c := range p.Status.Conditions {
+        if c.Type != "Drifted" || c.Status != "True" { continue }
+        if left := driftReportPeriod - time.Since(c.LastTransitionTime.Time); left > 0 { return left }
+    }
+    setCondition(&p.Status.Conditions, "Drifted", "False", "InSync", "Baseline objects match the desired state")
+    return 0
+}
+
+// specChanged ignores status-only updates, such as quota usage, of baseline
+// objects.
+var specChanged = predicate.Funcs{UpdateFunc: func(e event.UpdateEvent) bool {
+    switch o := e.ObjectOld.(type) {
+    case *corev1.ResourceQuota:
+        n, ok := e.ObjectNew.(*corev1.ResourceQuota)
+        return !ok || !equality.Semantic.DeepEqual(o.Spec, n.Spec) || e.ObjectNew.GetDeletionTimestamp() != nil
+    }
+    return true
+}}
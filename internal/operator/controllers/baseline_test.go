@@ -0,0 +1,96 @@
+package controllers
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_ProjectBaselineDrift(t *testing.T) {
+    ctx := context.Background()
+    p := &v1beta1.Project{
+        ObjectMeta: metav1.ObjectMeta{Name: "acme-web"},
+        Spec:       v1beta1.ProjectSpec{TenantRef: "acme", Name: "web"},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(p).WithStatusSubresource(&v1beta1.Project{}).Build()
+    r := &ProjectReconciler{Client: c}
+    req := reconcile.Request{NamespacedName: client.ObjectKey{Name: "acme-web"}}
+    ns := "kubeop-acme-web"
+    get := func() *v1beta1.Project {
+        var cur v1beta1.Project
+        if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+        return &cur
+    }
+
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    var rq corev1.ResourceQuota
+    if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: "kubeop-quota"}, &rq); err != nil { t.Fatal(err) }
+    if ref := metav1.GetControllerOf(&rq); ref == nil || ref.Kind != "Project" || ref.Name != "acme-web" { t.Fatalf("quota not controlled by the project: %+v", rq.OwnerReferences) }
+    if cond := findCondition(get().Status.Conditions, "Drifted"); cond == nil || cond.Status != "False" { t.Fatalf("expected Drifted=False, got %+v", cond) }
+    // a reconcile without changes reports no drift
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if cond := findCondition(get().Status.Conditions, "Drifted"); cond.Status != "False" { t.Fatalf("unexpected drift %+v", cond) }
+
+    // a tenant admin raises the quota, narrows the isolation policy and deletes the defaults
+    rq.Spec.Hard[corev1.ResourceRequestsCPU] = resourceMust("8")
+    rq.Spec.Hard[corev1.ResourceServices] = resourceMust("100")
+    if err := c.Update(ctx, &rq, client.FieldOwner("kubectl")); err != nil { t.Fatal(err) }
+    var np networkingv1.NetworkPolicy
+    if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: "kubeop-ingress"}, &np); err != nil { t.Fatal(err) }
+    np.Spec.PodSelector.MatchLabels = map[string]string{"isolated": "true"}
+    if err := c.Update(ctx, &np, client.FieldOwner("kubectl")); err != nil { t.Fatal(err) }
+    if err := c.Delete(ctx, &corev1.LimitRange{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "kubeop-defaults"}}); err != nil { t.Fatal(err) }
+
+    res, err := r.Reconcile(ctx, req)
+    if err != nil { t.Fatal(err) }
+    if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: "kubeop-quota"}, &rq); err != nil { t.Fatal(err) }
+    if cpu := rq.Spec.Hard[corev1.ResourceRequestsCPU]; len(rq.Spec.Hard) != len(quotaHard(builtinProjectResources())) || cpu.String() != "1" { t.Fatalf("quota not reverted: %v", rq.Spec.Hard) }
+    if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: "kubeop-ingress"}, &np); err != nil { t.Fatal(err) }
+    if len(np.Spec.PodSelector.MatchLabels) != 0 { t.Fatalf("ingress isolation not reverted: %+v", np.Spec.PodSelector) }
+    if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: "kubeop-defaults"}, &corev1.LimitRange{}); err != nil { t.Fatalf("limit range not recreated: %v", err) }
+    cond := findCondition(get().Status.Conditions, "Drifted")
+    if cond == nil || cond.Status != "True" || res.RequeueAfter != driftReportPeriod { t.Fatalf("expected Drifted=True, got %+v %+v", cond, res) }
+    for _, want := range []string{"ResourceQuota kubeop-quota was modified", "NetworkPolicy kubeop-ingress was modified", "LimitRange kubeop-defaults was deleted"} {
+        if !strings.Contains(cond.Message, want) { t.Fatalf("drift message %q lacks %q", cond.Message, want) }
+    }
+
+    // the report outlives the reconcile triggered by the correction itself
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if cond := findCondition(get().Status.Conditions, "Drifted"); cond.Status != "True" { t.Fatalf("drift report cleared early: %+v", cond) }
+    cur := get()
+    for i := range cur.Status.Conditions {
+        if cur.Status.Conditions[i].Type == "Drifted" { cur.Status.Conditions[i].LastTransitionTime = metav1.NewTime(time.Now().Add(-driftReportPeriod)) }
+    }
+    if err := c.Status().Update(ctx, cur); err != nil { t.Fatal(err) }
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if cond := findCondition(get().Status.Conditions, "Drifted"); cond.Status != "False" { t.Fatalf("expected the drift report to expire: %+v", cond) }
+}
+
+func Test_ingressIsolationAdmitsIngressNamespaces(t *testing.T) {
+    ctx := context.Background()
+    p := &v1beta1.Project{
+        ObjectMeta: metav1.ObjectMeta{Name: "acme-web"},
+        Spec:       v1beta1.ProjectSpec{TenantRef: "acme", Name: "web"},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(p).WithStatusSubresource(&v1beta1.Project{}).Build()
+    r := &ProjectReconciler{Client: c, IngressNamespaces: []string{"ingress-nginx", "gateways"}}
+    if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKey{Name: "acme-web"}}); err != nil { t.Fatal(err) }
+    var np networkingv1.NetworkPolicy
+    if err := c.Get(ctx, client.ObjectKey{Namespace: "kubeop-acme-web", Name: "kubeop-ingress"}, &np); err != nil { t.Fatal(err) }
+    from := np.Spec.Ingress[0].From
+    if len(from) != 2 || from[0].PodSelector == nil || from[1].NamespaceSelector == nil { t.Fatalf("unexpected peers %+v", from) }
+    sel := from[1].NamespaceSelector.MatchExpressions
+    if len(sel) != 1 || sel[0].Key != corev1.LabelMetadataName || sel[0].Operator != metav1.LabelSelectorOpIn || strings.Join(sel[0].Values, ",") != "ingress-nginx,gateways" {
+        t.Fatalf("unexpected namespace selector %+v", sel)
+    }
+}
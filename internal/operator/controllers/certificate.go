@@ -0,0 +1,394 @@
+package controllers
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/x509"
+    "encoding/pem"
+    "fmt"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/tools/record"
+    "k8s.io/client-go/util/retry"
+    ctrl "sigs.k8s.io/controller-runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+    "sigs.k8s.io/controller-runtime/pkg/log"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+    "github.com/vaheed/kubeop/internal/operator/issuer"
+)
+
+// defaultRenewFraction is the share of a certificate's lifetime after which
+// it is renewed when CertificateReconciler.RenewFraction is unset.
+const defaultRenewFraction = 2.0 / 3
+
+// certDNSWaitInterval is how long an http-01 Certificate waits for its
+// DNSRecord to be published before asking the CA to validate the host.
+const certDNSWaitInterval = 5 * time.Second
+
+// certOrderPollInterval is how often an ACME order is polled while the CA
+// validates the host.
+const certOrderPollInterval = 5 * time.Second
+
+// SolverRoute routes http-01 challenges for Certificate hosts to the
+// operator. For every issuance a temporary Ingress for the host's
+// /.well-known/acme-challenge/ path is created next to the Certificate,
+// backed by an ExternalName Service pointing at Service.
+type SolverRoute struct {
+    // Service is the DNS name of the Service in front of the operator's
+    // http-01 handler. No routes are created when it is empty.
+    Service string
+    Port    int32
+    // IngressClass is set as spec.ingressClassName when non-empty.
+    IngressClass string
+}
+
+// Certificate reconciler: issue certificates and store them in TLS Secrets.
+type CertificateReconciler struct{
+    client.Client
+    Issuer issuer.Issuer
+    Solver SolverRoute
+    // RenewFraction is the share of the lifetime after which certificates
+    // are renewed, between 0 and 1.
+    RenewFraction float64
+    Recorder      record.EventRecorder
+}
+
+func (r *CertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+    var c v1beta1.Certificate
+    if err := r.Get(ctx, req.NamespacedName, &c); err != nil {
+        if apierrors.IsNotFound(err) { certExpiry.forget(req.NamespacedName) }
+        return ctrl.Result{}, client.IgnoreNotFound(err)
+    }
+    if c.Spec.Host == "" {
+        if conditionChanged(c.Status.Conditions, "Ready", "False", "InvalidSpec") { recordEvent(r.Recorder, &c, corev1.EventTypeWarning, "InvalidSpec", "spec.host is required") }
+        return ctrl.Result{}, r.notReady(ctx, &c, "InvalidSpec", "spec.host is required")
+    }
+    secretName := certSecretName(&c)
+    var sec corev1.Secret
+    err := r.Get(ctx, types.NamespacedName{Namespace: c.Namespace, Name: secretName}, &sec)
+    if err != nil && !apierrors.IsNotFound(err) { return ctrl.Result{}, err }
+    exists := err == nil
+    if exists && !metav1.IsControlledBy(&sec, &c) {
+        msg := fmt.Sprintf("Secret %s exists and is not managed by this Certificate", secretName)
+        if conditionChanged(c.Status.Conditions, "Ready", "False", "SecretConflict") { recordEvent(r.Recorder, &c, corev1.EventTypeWarning, "SecretConflict", msg) }
+        return ctrl.Result{}, r.notReady(ctx, &c, "SecretConflict", msg)
+    }
+    // keep a stored certificate while it covers the host and is not due
+    // for renewal
+    var current *x509.Certificate
+    if exists {
+        if leaf, err := issuer.Parse(sec.Data[corev1.TLSCertKey], sec.Data[corev1.TLSPrivateKeyKey]); err == nil && leaf.VerifyHostname(c.Spec.Host) == nil && time.Now().Before(leaf.NotAfter) {
+            current = leaf
+        }
+    }
+    if current != nil && time.Now().Before(r.renewalTime(current)) {
+        return r.issued(ctx, &c, secretName, current)
+    }
+
+    challenge := c.Spec.Challenge
+    if challenge == "" { challenge = issuer.ChallengeHTTP01 }
+    if current == nil && challenge == issuer.ChallengeHTTP01 && c.Spec.DNSRecordRef != "" {
+        // the CA resolves the host, so it has to be published first
+        var rec v1beta1.DNSRecord
+        err := r.Get(ctx, types.NamespacedName{Namespace: c.Namespace, Name: c.Spec.DNSRecordRef}, &rec)
+        if err != nil && !apierrors.IsNotFound(err) { return ctrl.Result{}, err }
+        if err != nil || !rec.Status.Ready {
+            if err := r.notReady(ctx, &c, "WaitingForDNS", "Waiting for DNSRecord "+c.Spec.DNSRecordRef); err != nil { return ctrl.Result{}, err }
+            return ctrl.Result{RequeueAfter: certDNSWaitInterval}, nil
+        }
+    }
+    // a certificate that is only due for renewal keeps serving, so Ready
+    // stays true and progress is reported in the Renewing condition
+    if current != nil {
+        certExpiry.set(req.NamespacedName, c.Spec.Host, current.NotAfter)
+        if err := r.renewing(ctx, &c, "RenewalDue", fmt.Sprintf("Renewing the certificate for %s, which expires at %s", c.Spec.Host, current.NotAfter.UTC().Format(time.RFC3339))); err != nil { return ctrl.Result{}, err }
+    } else if err := r.notReady(ctx, &c, "Issuing", fmt.Sprintf("Requesting a certificate for %s (%s)", c.Spec.Host, challenge)); err != nil {
+        return ctrl.Result{}, err
+    }
+    route := challenge == issuer.ChallengeHTTP01 && r.Solver.Service != ""
+    // the route lives as long as the order
+    if route && c.Status.Order == "" {
+        if err := r.ensureSolverRoute(ctx, &c); err != nil { return ctrl.Result{}, fmt.Errorf("solver route: %w", err) }
+    }
+    res, err := r.Issuer.Issue(ctx, issuer.Request{Host: c.Spec.Host, Challenge: challenge, Order: c.Status.Order})
+    if err == nil && res.Order != "" {
+        // the CA validates the host in the background; poll the order
+        // instead of holding the worker
+        if c.Status.Order != res.Order {
+            c.Status.Order = res.Order
+            if err := r.Status().Update(ctx, &c); err != nil { return ctrl.Result{}, err }
+        }
+        return ctrl.Result{RequeueAfter: certOrderPollInterval}, nil
+    }
+    if route { r.deleteSolverRoute(context.WithoutCancel(ctx), &c) }
+    // a failed order is not resumed, and a finished one is done
+    if c.Status.Order != "" {
+        c.Status.Order = ""
+        if uerr := r.Status().Update(ctx, &c); uerr != nil { return ctrl.Result{}, uerr }
+    }
+    var leaf *x509.Certificate
+    if err == nil {
+        // never store a chain that does not match its key
+        if leaf, err = issuer.Parse(res.CertPEM, res.KeyPEM); err != nil { err = fmt.Errorf("issued certificate: %w", err) }
+    }
+    if err != nil {
+        var uerr error
+        if current != nil {
+            recordEvent(r.Recorder, &c, corev1.EventTypeWarning, "RenewFailed", err.Error())
+            uerr = r.renewing(ctx, &c, "RenewFailed", err.Error())
+        } else {
+            recordEvent(r.Recorder, &c, corev1.EventTypeWarning, "IssueFailed", err.Error())
+            uerr = r.notReady(ctx, &c, "IssueFailed", err.Error())
+        }
+        if uerr != nil { log.FromContext(ctx).Error(uerr, "update certificate status") }
+        return ctrl.Result{}, err
+    }
+    var prev *corev1.Secret
+    if exists { prev = &sec }
+    if err := r.storeSecret(ctx, &c, secretName, prev, res); err != nil { return ctrl.Result{}, fmt.Errorf("store certificate: %w", err) }
+    return r.issued(ctx, &c, secretName, leaf)
+}
+
+func (r *CertificateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+    return ctrl.NewControllerManagedBy(mgr).
+        For(&v1beta1.Certificate{}).
+        Owns(&corev1.Secret{}).
+        WithOptions(controller.Options{MaxConcurrentReconciles: 2}).
+        Complete(instrument("Certificate", mgr.GetClient(), r))
+}
+
+// issued marks c ready with the validity of leaf and requeues it for
+// renewal.
+func (r *CertificateReconciler) issued(ctx context.Context, c *v1beta1.Certificate, secretName string, leaf *x509.Certificate) (ctrl.Result, error) {
+    certExpiry.set(client.ObjectKeyFromObject(c), c.Spec.Host, leaf.NotAfter)
+    renewAt := r.renewalTime(leaf)
+    result := ctrl.Result{RequeueAfter: time.Until(renewAt)}
+    notBefore, notAfter, renewal := metav1.NewTime(leaf.NotBefore), metav1.NewTime(leaf.NotAfter), metav1.NewTime(renewAt)
+    renewingCond := conditionStatus(c.Status.Conditions, "Renewing")
+    if c.Status.Ready && c.Status.SecretName == secretName && c.Status.NotBefore.Equal(&notBefore) && c.Status.NotAfter.Equal(&notAfter) &&
+        c.Status.RenewalTime.Equal(&renewal) && renewingCond != "True" {
+        return result, nil
+    }
+    c.Status.Ready = true
+    c.Status.SecretName = secretName
+    c.Status.NotBefore, c.Status.NotAfter, c.Status.RenewalTime = &notBefore, &notAfter, &renewal
+    c.Status.Message = fmt.Sprintf("Certificate for %s stored in %s, valid until %s", c.Spec.Host, secretName, leaf.NotAfter.UTC().Format(time.RFC3339))
+    setCondition(&c.Status.Conditions, "Ready", "True", "Issued", c.Status.Message)
+    reason := "Issued"
+    if renewingCond == "True" { reason = "Renewed" }
+    recordEvent(r.Recorder, c, corev1.EventTypeNormal, reason, c.Status.Message)
+    if renewingCond != "" {
+        setCondition(&c.Status.Conditions, "Renewing", "False", "Renewed", "Renewal due at "+renewAt.UTC().Format(time.RFC3339))
+    }
+    if err := r.Status().Update(ctx, c); err != nil { return ctrl.Result{}, err }
+    return result, nil
+}
+
+// renewing records the progress of a renewal while the current certificate
+// keeps c ready.
+func (r *CertificateReconciler) renewing(ctx context.Context, c *v1beta1.Certificate, reason, msg string) error {
+    setCondition(&c.Status.Conditions, "Renewing", "True", reason, msg)
+    return r.Status().Update(ctx, c)
+}
+
+// renewalTime is when RenewFraction of leaf's lifetime has passed.
+func (r *CertificateReconciler) renewalTime(leaf *x509.Certificate) time.Time {
+    f := r.RenewFraction
+    if f <= 0 || f >= 1 { f = defaultRenewFraction }
+    lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+    return leaf.NotBefore.Add(time.Duration(float64(lifetime) * f))
+}
+
+func conditionStatus(conds []v1beta1.Condition, t string) string {
+    for _, c := range conds {
+        if c.Type == t { return c.Status }
+    }
+    return ""
+}
+
+// notReady records why c has no usable certificate. A Secret that still holds
+// a previous certificate stays referenced in the status. Repeating the
+// current reason is a no-op, so waiting does not trigger new reconciles.
+func (r *CertificateReconciler) notReady(ctx context.Context, c *v1beta1.Certificate, reason, msg string) error {
+    for _, cond := range c.Status.Conditions {
+        if cond.Type == "Ready" && cond.Status == "False" && cond.Reason == reason && cond.Message == msg && !c.Status.Ready { return nil }
+    }
+    c.Status.Ready = false
+    c.Status.Message = msg
+    setCondition(&c.Status.Conditions, "Ready", "False", reason, msg)
+    return r.Status().Update(ctx, c)
+}
+
+// storeSecret writes the chain and key into a kubernetes.io/tls Secret
+// controlled by c. Both keys change in a single write guarded by the
+// resourceVersion of prev, the Secret as it was read, so a concurrent change
+// makes the rotation fail and retry instead of mixing a key and a chain.
+func (r *CertificateReconciler) storeSecret(ctx context.Context, c *v1beta1.Certificate, name string, prev *corev1.Secret, res *issuer.Result) error {
+    data := map[string][]byte{corev1.TLSCertKey: res.CertPEM, corev1.TLSPrivateKeyKey: res.KeyPEM}
+    if prev == nil {
+        sec := corev1.Secret{
+            ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: c.Namespace, Labels: map[string]string{"app.kubeop.io/certificate": c.Name, ManagedSecretLabel: "certificate"}},
+            Type:       corev1.SecretTypeTLS,
+            Data:       data,
+        }
+        if err := controllerutil.SetControllerReference(c, &sec, r.Scheme()); err != nil { return err }
+        return r.Create(ctx, &sec)
+    }
+    sec := prev.DeepCopy()
+    sec.Data = data
+    if sec.Labels == nil { sec.Labels = map[string]string{} }
+    sec.Labels[ManagedSecretLabel] = "certificate"
+    return r.Update(ctx, sec)
+}
+
+// ensureSolverRoute sends http://<host>/.well-known/acme-challenge/ to the
+// operator through an ExternalName Service in the Certificate's namespace.
+func (r *CertificateReconciler) ensureSolverRoute(ctx context.Context, c *v1beta1.Certificate) error {
+    meta := metav1.ObjectMeta{Name: solverRouteName(c), Namespace: c.Namespace, Labels: map[string]string{"app.kubeop.io/certificate": c.Name}}
+    svc := &corev1.Service{ObjectMeta: meta, Spec: corev1.ServiceSpec{
+        Type:         corev1.ServiceTypeExternalName,
+        ExternalName: r.Solver.Service,
+        Ports:        []corev1.ServicePort{{Name: "http", Port: r.Solver.Port, Protocol: corev1.ProtocolTCP}},
+    }}
+    pathType := networkingv1.PathTypePrefix
+    ing := &networkingv1.Ingress{ObjectMeta: meta, Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+        Host: c.Spec.Host,
+        IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{{
+            Path:     "/.well-known/acme-challenge/",
+            PathType: &pathType,
+            Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+                Name: meta.Name,
+                Port: networkingv1.ServiceBackendPort{Number: r.Solver.Port},
+            }},
+        }}}},
+    }}}}
+    if r.Solver.IngressClass != "" {
+        class := r.Solver.IngressClass
+        ing.Spec.IngressClassName = &class
+    }
+    // the route only lives for one issuance, so a leftover is replaced
+    for _, obj := range []client.Object{svc, ing} {
+        if err := controllerutil.SetControllerReference(c, obj, r.Scheme()); err != nil { return err }
+        err := r.Create(ctx, obj)
+        if apierrors.IsAlreadyExists(err) {
+            if err := r.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) { return err }
+            obj.SetResourceVersion("")
+            err = r.Create(ctx, obj)
+        }
+        if err != nil { return err }
+    }
+    return nil
+}
+
+func (r *CertificateReconciler) deleteSolverRoute(ctx context.Context, c *v1beta1.Certificate) {
+    meta := metav1.ObjectMeta{Name: solverRouteName(c), Namespace: c.Namespace}
+    for _, obj := range []client.Object{&networkingv1.Ingress{ObjectMeta: meta}, &corev1.Service{ObjectMeta: meta}} {
+        if err := client.IgnoreNotFound(r.Delete(ctx, obj)); err != nil {
+            log.FromContext(ctx).Error(err, "delete acme solver route", "name", meta.Name)
+        }
+    }
+}
+
+func certSecretName(c *v1beta1.Certificate) string {
+    if c.Spec.SecretName != "" { return c.Spec.SecretName }
+    return c.Name + "-tls"
+}
+
+func solverRouteName(c *v1beta1.Certificate) string { return c.Name + "-acme-solver" }
+
+// acmeAccountKeyName is the Secret in the operator namespace holding the
+// ACME account key.
+const acmeAccountKeyName = "kubeop-acme-account"
+
+// AccountKeySecret loads the ACME account key from a Secret in namespace,
+// generating and storing one on first use so the account survives restarts.
+func AccountKeySecret(c client.Client, namespace string) issuer.AccountKeyFunc {
+    return func(ctx context.Context) (crypto.Signer, error) {
+        var sec corev1.Secret
+        err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: acmeAccountKeyName}, &sec)
+        if apierrors.IsNotFound(err) {
+            key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+            if err != nil { return nil, err }
+            der, err := x509.MarshalECPrivateKey(key)
+            if err != nil { return nil, err }
+            sec = corev1.Secret{
+                ObjectMeta: metav1.ObjectMeta{Name: acmeAccountKeyName, Namespace: namespace},
+                Data:       map[string][]byte{"key.pem": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})},
+            }
+            err = c.Create(ctx, &sec)
+            if err == nil { return key, nil }
+            if !apierrors.IsAlreadyExists(err) { return nil, err }
+            // another replica won the race; use its key
+            err = c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: acmeAccountKeyName}, &sec)
+        }
+        if err != nil { return nil, err }
+        block, _ := pem.Decode(sec.Data["key.pem"])
+        if block == nil { return nil, fmt.Errorf("secret %s/%s has no key.pem", namespace, acmeAccountKeyName) }
+        return x509.ParseECPrivateKey(block.Bytes)
+    }
+}
+
+// acmeChallengeName is the Secret in the operator namespace holding the
+// http-01 responses of the orders in progress.
+const acmeChallengeName = "kubeop-acme-http01"
+
+// ChallengeSecret keeps http-01 responses in a Secret in namespace, so every
+// operator replica behind the solver Service can answer the CA, not only the
+// leader that placed the order. Responses are read through reader; the
+// solver route only exists during an issuance, so reads are rare and go to
+// the API server to see a response as soon as it is written.
+func ChallengeSecret(c client.Client, reader client.Reader, namespace string) issuer.TokenStore {
+    return &challengeSecret{client: c, reader: reader, key: types.NamespacedName{Namespace: namespace, Name: acmeChallengeName}}
+}
+
+type challengeSecret struct {
+    client client.Client
+    reader client.Reader
+    key    types.NamespacedName
+}
+
+func (s *challengeSecret) Set(ctx context.Context, token, value string) error {
+    return s.update(ctx, func(data map[string][]byte) { data[token] = []byte(value) })
+}
+
+func (s *challengeSecret) Delete(ctx context.Context, token string) error {
+    return s.update(ctx, func(data map[string][]byte) { delete(data, token) })
+}
+
+func (s *challengeSecret) Get(ctx context.Context, token string) (string, error) {
+    var sec corev1.Secret
+    if err := s.reader.Get(ctx, s.key, &sec); err != nil { return "", client.IgnoreNotFound(err) }
+    return string(sec.Data[token]), nil
+}
+
+// update applies change to the responses, retrying when another issuance
+// changed them concurrently.
+func (s *challengeSecret) update(ctx context.Context, change func(map[string][]byte)) error {
+    return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+        var sec corev1.Secret
+        err := s.client.Get(ctx, s.key, &sec)
+        if apierrors.IsNotFound(err) {
+            sec = corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: s.key.Name, Namespace: s.key.Namespace}, Data: map[string][]byte{}}
+            change(sec.Data)
+            err = s.client.Create(ctx, &sec)
+            // a concurrent create is retried as a conflict
+            if apierrors.IsAlreadyExists(err) { return apierrors.NewConflict(corev1.Resource("secrets"), s.key.Name, err) }
+            return err
+        }
+        if err != nil { return err }
+        if sec.Data == nil { sec.Data = map[string][]byte{} }
+        change(sec.Data)
+        return s.client.Update(ctx, &sec)
+    })
+}
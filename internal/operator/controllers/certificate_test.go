@@ -0,0 +1,216 @@
+package controllers
+
+import (
+    "context"
+    "crypto"
+    "errors"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+    "github.com/vaheed/kubeop/internal/operator/issuer"
+)
+
+// fakeIssuer issues self-signed certificates, records requests and fails
+// while err is set. check runs before every issuance. The first pending
+// calls leave the order in progress.
+type fakeIssuer struct {
+    requests []issuer.Request
+    err      error
+    check    func()
+    lifetime time.Duration
+    pending  int
+}
+
+func (f *fakeIssuer) Issue(ctx context.Context, req issuer.Request) (*issuer.Result, error) {
+    f.requests = append(f.requests, req)
+    if f.check != nil { f.check() }
+    if f.err != nil { return nil, f.err }
+    if f.pending > 0 {
+        f.pending--
+        return &issuer.Result{Order: "https://acme.example.com/order/1"}, nil
+    }
+    return (&issuer.SelfSigned{Lifetime: f.lifetime}).Issue(ctx, req)
+}
+
+func Test_CertificateIssuance(t *testing.T) {
+    ctx := context.Background()
+    ns := "kubeop-acme-web"
+    cert := &v1beta1.Certificate{
+        ObjectMeta: metav1.ObjectMeta{Name: "app-web", Namespace: ns},
+        Spec:       v1beta1.CertificateSpec{Host: "web.example.com", DNSRecordRef: "app-web"},
+    }
+    rec := &v1beta1.DNSRecord{ObjectMeta: metav1.ObjectMeta{Name: "app-web", Namespace: ns}}
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(cert, rec).
+        WithStatusSubresource(&v1beta1.Certificate{}, &v1beta1.DNSRecord{}).Build()
+    iss := &fakeIssuer{}
+    r := &CertificateReconciler{Client: c, Issuer: iss, Solver: SolverRoute{Service: "kubeop-operator-acme.kubeop-system.svc.cluster.local", Port: 8089}}
+    req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cert)}
+    get := func() *v1beta1.Certificate {
+        var cur v1beta1.Certificate
+        if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+        return &cur
+    }
+    solverKey := types.NamespacedName{Namespace: ns, Name: "app-web-acme-solver"}
+
+    // http-01 waits for the host to be published
+    res, err := r.Reconcile(ctx, req)
+    if err != nil { t.Fatal(err) }
+    if res.RequeueAfter == 0 || len(iss.requests) != 0 { t.Fatalf("expected to wait for the DNSRecord, got %+v %v", res, iss.requests) }
+    if cur := get(); cur.Status.Ready || cur.Status.Conditions[0].Reason != "WaitingForDNS" { t.Fatalf("unexpected status %+v", cur.Status) }
+
+    rec.Status.Ready = true
+    if err := c.Status().Update(ctx, rec); err != nil { t.Fatal(err) }
+    iss.check = func() {
+        if err := c.Get(ctx, solverKey, &networkingv1.Ingress{}); err != nil { t.Errorf("solver ingress missing during issuance: %v", err) }
+        var svc corev1.Service
+        if err := c.Get(ctx, solverKey, &svc); err != nil || svc.Spec.ExternalName != r.Solver.Service { t.Errorf("solver service not routed to the operator: %v %+v", err, svc.Spec) }
+    }
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    cur := get()
+    if !cur.Status.Ready || cur.Status.SecretName != "app-web-tls" || cur.Status.NotAfter == nil { t.Fatalf("unexpected status %+v", cur.Status) }
+    var sec corev1.Secret
+    if err := c.Get(ctx, types.NamespacedName{Namespace: ns, Name: "app-web-tls"}, &sec); err != nil { t.Fatal(err) }
+    leaf, err := issuer.Parse(sec.Data[corev1.TLSCertKey], sec.Data[corev1.TLSPrivateKeyKey])
+    if err != nil || sec.Type != corev1.SecretTypeTLS || !metav1.IsControlledBy(&sec, cur) { t.Fatalf("unexpected secret %v %+v", err, sec.ObjectMeta) }
+    if !leaf.NotAfter.Equal(cur.Status.NotAfter.Time) { t.Fatalf("status expiry %v does not match %v", cur.Status.NotAfter, leaf.NotAfter) }
+    if err := c.Get(ctx, solverKey, &networkingv1.Ingress{}); !apierrors.IsNotFound(err) { t.Fatalf("solver route left behind: %v", err) }
+
+    // a valid stored certificate is reused
+    iss.check = nil
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if len(iss.requests) != 1 { t.Fatalf("expected one issuance, got %d", len(iss.requests)) }
+
+    // a new host needs a new certificate; issuer errors are surfaced
+    cur.Spec.Host, cur.Spec.Challenge = "www.example.com", issuer.ChallengeDNS01
+    if err := c.Update(ctx, cur); err != nil { t.Fatal(err) }
+    iss.err = errors.New("rateLimited")
+    if _, err := r.Reconcile(ctx, req); err == nil { t.Fatalf("expected the issuer error to be returned") }
+    if cur := get(); cur.Status.Ready || cur.Status.Message != "rateLimited" || cur.Status.SecretName != "app-web-tls" { t.Fatalf("unexpected status %+v", cur.Status) }
+    iss.err = nil
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if got := iss.requests[len(iss.requests)-1]; got.Host != "www.example.com" || got.Challenge != issuer.ChallengeDNS01 { t.Fatalf("unexpected request %+v", got) }
+    if err := c.Get(ctx, solverKey, &corev1.Service{}); !apierrors.IsNotFound(err) { t.Fatalf("dns-01 must not create a solver route: %v", err) }
+    if cur := get(); !cur.Status.Ready { t.Fatalf("expected the new certificate to be ready: %+v", cur.Status) }
+}
+
+func Test_CertificateOrderPolling(t *testing.T) {
+    ctx := context.Background()
+    cert := &v1beta1.Certificate{
+        ObjectMeta: metav1.ObjectMeta{Name: "app-web", Namespace: "kubeop-acme-web"},
+        Spec:       v1beta1.CertificateSpec{Host: "web.example.com"},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(cert).WithStatusSubresource(&v1beta1.Certificate{}).Build()
+    iss := &fakeIssuer{pending: 1}
+    r := &CertificateReconciler{Client: c, Issuer: iss, Solver: SolverRoute{Service: "kubeop-operator-acme.kubeop-system.svc.cluster.local", Port: 8089}}
+    req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cert)}
+    solverKey := types.NamespacedName{Namespace: cert.Namespace, Name: "app-web-acme-solver"}
+    get := func() *v1beta1.Certificate {
+        var cur v1beta1.Certificate
+        if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+        return &cur
+    }
+
+    // the reconcile returns while the CA validates and keeps the route
+    res, err := r.Reconcile(ctx, req)
+    if err != nil { t.Fatal(err) }
+    if res.RequeueAfter != certOrderPollInterval || get().Status.Order == "" { t.Fatalf("expected the order to be polled, got %+v %+v", res, get().Status) }
+    if err := c.Get(ctx, solverKey, &networkingv1.Ingress{}); err != nil { t.Fatalf("solver route removed while the order is pending: %v", err) }
+
+    // the next reconcile resumes the order
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if got := iss.requests[1]; got.Order != "https://acme.example.com/order/1" { t.Fatalf("order not resumed: %+v", got) }
+    if cur := get(); !cur.Status.Ready || cur.Status.Order != "" { t.Fatalf("unexpected status %+v", cur.Status) }
+    if err := c.Get(ctx, solverKey, &networkingv1.Ingress{}); !apierrors.IsNotFound(err) { t.Fatalf("solver route left behind: %v", err) }
+}
+
+func Test_CertificateRenewal(t *testing.T) {
+    ctx := context.Background()
+    cert := &v1beta1.Certificate{
+        ObjectMeta: metav1.ObjectMeta{Name: "app-web", Namespace: "kubeop-acme-web"},
+        Spec:       v1beta1.CertificateSpec{Host: "web.example.com", Challenge: issuer.ChallengeDNS01},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(cert).WithStatusSubresource(&v1beta1.Certificate{}).Build()
+    iss := &fakeIssuer{lifetime: 30 * 24 * time.Hour}
+    r := &CertificateReconciler{Client: c, Issuer: iss, RenewFraction: 0.5}
+    req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cert)}
+    secretKey := types.NamespacedName{Namespace: cert.Namespace, Name: "app-web-tls"}
+    get := func() *v1beta1.Certificate {
+        var cur v1beta1.Certificate
+        if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+        return &cur
+    }
+
+    // the requeue lands on the renewal time, half way through the lifetime
+    res, err := r.Reconcile(ctx, req)
+    if err != nil { t.Fatal(err) }
+    if d := res.RequeueAfter; d < 14*24*time.Hour || d > 15*24*time.Hour { t.Fatalf("unexpected requeue %v", d) }
+    cur := get()
+    if cur.Status.NotBefore == nil || cur.Status.RenewalTime == nil || !cur.Status.RenewalTime.Time.Equal(cur.Status.NotBefore.Add(15*24*time.Hour)) {
+        t.Fatalf("unexpected validity in status %+v", cur.Status)
+    }
+    if v, ok := certExpiry.certs[req.NamespacedName]; !ok || !v.notAfter.Equal(cur.Status.NotAfter.Time) || v.host != "web.example.com" {
+        t.Fatalf("expiry gauge not recorded: %+v", v)
+    }
+    var before corev1.Secret
+    if err := c.Get(ctx, secretKey, &before); err != nil { t.Fatal(err) }
+
+    // once due, a failed renewal keeps the current certificate in service
+    r.RenewFraction = 1e-9
+    iss.err = errors.New("rateLimited")
+    if _, err := r.Reconcile(ctx, req); err == nil { t.Fatalf("expected the renewal error to be returned") }
+    cur = get()
+    if !cur.Status.Ready || cur.Status.Conditions[len(cur.Status.Conditions)-1].Reason != "RenewFailed" { t.Fatalf("unexpected status %+v", cur.Status) }
+
+    iss.err = nil
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    var after corev1.Secret
+    if err := c.Get(ctx, secretKey, &after); err != nil { t.Fatal(err) }
+    if string(after.Data[corev1.TLSPrivateKeyKey]) == string(before.Data[corev1.TLSPrivateKeyKey]) { t.Fatalf("expected a rotated key") }
+    if _, err := issuer.Parse(after.Data[corev1.TLSCertKey], after.Data[corev1.TLSPrivateKeyKey]); err != nil { t.Fatalf("rotated secret is not a key pair: %v", err) }
+    if cur := get(); !cur.Status.Ready || conditionStatus(cur.Status.Conditions, "Renewing") != "False" { t.Fatalf("unexpected status after renewal %+v", cur.Status) }
+
+    if err := c.Delete(ctx, cert); err != nil { t.Fatal(err) }
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if _, ok := certExpiry.certs[req.NamespacedName]; ok { t.Fatalf("expected the gauge to be dropped with the Certificate") }
+}
+
+func Test_AccountKeySecret(t *testing.T) {
+    ctx := context.Background()
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).Build()
+    load := AccountKeySecret(c, "kubeop-system")
+    first, err := load(ctx)
+    if err != nil { t.Fatal(err) }
+    second, err := load(ctx)
+    if err != nil { t.Fatal(err) }
+    if !first.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(second.Public()) { t.Fatalf("expected the stored key to be reused") }
+}
+
+func Test_ChallengeSecret(t *testing.T) {
+    ctx := context.Background()
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).Build()
+    // one replica presents the response, another serves it
+    leader := &issuer.HTTP01{Store: ChallengeSecret(c, c, "kubeop-system")}
+    follower := &issuer.HTTP01{Store: ChallengeSecret(c, c, "kubeop-system")}
+    serve := func(token string) *httptest.ResponseRecorder {
+        rec := httptest.NewRecorder()
+        follower.ServeHTTP(rec, httptest.NewRequest("GET", "http://web.example.com/.well-known/acme-challenge/"+token, nil))
+        return rec
+    }
+    if err := leader.Present(ctx, "web.example.com", "tok-1", "tok-1.thumb"); err != nil { t.Fatal(err) }
+    if err := leader.Present(ctx, "api.example.com", "tok-2", "tok-2.thumb"); err != nil { t.Fatal(err) }
+    if rec := serve("tok-1"); rec.Code != 200 || rec.Body.String() != "tok-1.thumb" { t.Fatalf("unexpected response %d %q", rec.Code, rec.Body.String()) }
+    if err := leader.CleanUp(ctx, "web.example.com", "tok-1", ""); err != nil { t.Fatal(err) }
+    if rec := serve("tok-1"); rec.Code != 404 { t.Fatalf("expected a cleaned up token to be gone, got %d", rec.Code) }
+    if rec := serve("tok-2"); rec.Body.String() != "tok-2.thumb" { t.Fatalf("unexpected response %q", rec.Body.String()) }
+}
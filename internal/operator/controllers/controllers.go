@@ -5,30 +5,40 @@ import (
     "fmt"
     "os"
     "strconv"
+    "strings"
     "crypto/sha1"
     "encoding/hex"
-    "net/http"
     "time"
 
     appsv1 "k8s.io/api/apps/v1"
+    autoscalingv2 "k8s.io/api/autoscaling/v2"
     batchv1 "k8s.io/api/batch/v1"
     corev1 "k8s.io/api/core/v1"
     resource "k8s.io/apimachinery/pkg/api/resource"
     networkingv1 "k8s.io/api/networking/v1"
+    rbacv1 "k8s.io/api/rbac/v1"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
     apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/api/equality"
     "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/tools/record"
     ctrl "sigs.k8s.io/controller-runtime"
+    "sigs.k8s.io/controller-runtime/pkg/builder"
     "sigs.k8s.io/controller-runtime/pkg/client"
     "sigs.k8s.io/controller-runtime/pkg/controller"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+    "sigs.k8s.io/controller-runtime/pkg/handler"
     "sigs.k8s.io/controller-runtime/pkg/log"
+    "sigs.k8s.io/controller-runtime/pkg/predicate"
 
-    v1alpha1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1alpha1"
+    "github.com/vaheed/kubeop/internal/kube"
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+    "github.com/vaheed/kubeop/internal/operator/source"
 )
 
-func setCondition(conds *[]v1alpha1.Condition, t, status, reason, msg string) {
+func setCondition(conds *[]v1beta1.Condition, t, status, reason, msg string) {
     now := metav1.NewTime(time.Now())
-    c := v1alpha1.Condition{Type: t, Status: status, Reason: reason, Message: msg, LastTransitionTime: now}
+    c := v1beta1.Condition{Type: t, Status: status, Reason: reason, Message: msg, LastTransitionTime: now}
     // replace existing of same type
     found := false
     for i := range *conds {
@@ -43,150 +53,251 @@ func setCondition(conds *[]v1alpha1.Condition, t, status, reason, msg string) {
     }
 }
 
-// Tenant reconciler: no-op beyond setting Ready for now.
-type TenantReconciler struct{ client.Client }
+// Tenant reconciler: aggregate project state and quota usage, check limits.
+type TenantReconciler struct{
+    client.Client
+    Recorder record.EventRecorder
+}
 
 func (r *TenantReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
     lg := log.FromContext(ctx)
-    var t v1alpha1.Tenant
+    var t v1beta1.Tenant
     if err := r.Get(ctx, req.NamespacedName, &t); err != nil {
+        if apierrors.IsNotFound(err) { readiness.forget("Tenant", req.NamespacedName) }
         return ctrl.Result{}, client.IgnoreNotFound(err)
     }
+    var projects v1beta1.ProjectList
+    if err := r.List(ctx, &projects, client.MatchingLabels{"app.kubeop.io/tenant": t.Name}); err != nil {
+        return ctrl.Result{}, err
+    }
+    var readyCount int32
+    allocated, used := corev1.ResourceList{}, corev1.ResourceList{}
+    for _, p := range projects.Items {
+        if p.Status.Ready { readyCount++ }
+        if p.Status.Namespace == "" { continue }
+        var rq corev1.ResourceQuota
+        if err := r.Get(ctx, types.NamespacedName{Namespace: p.Status.Namespace, Name: "kubeop-quota"}, &rq); err != nil {
+            if apierrors.IsNotFound(err) { continue }
+            return ctrl.Result{}, err
+        }
+        allocated = kube.AddResources(allocated, rq.Spec.Hard)
+        used = kube.AddResources(used, rq.Status.Used)
+    }
+    t.Status.Projects = int32(len(projects.Items))
+    t.Status.ReadyProjects = readyCount
+    t.Status.NotReadyProjects = t.Status.Projects - readyCount
+    t.Status.Allocated = allocated
+    t.Status.Used = used
+    if over := kube.ExceededResources(allocated, t.Spec.Limits); len(over) > 0 {
+        msg := fmt.Sprintf("project quotas exceed tenant limits for %v", over)
+        if conditionChanged(t.Status.Conditions, "WithinLimits", "False", "LimitExceeded") { recordEvent(r.Recorder, &t, corev1.EventTypeWarning, "LimitExceeded", msg) }
+        setCondition(&t.Status.Conditions, "WithinLimits", "False", "LimitExceeded", msg)
+    } else {
+        if conditionStatus(t.Status.Conditions, "WithinLimits") == "False" { recordEvent(r.Recorder, &t, corev1.EventTypeNormal, "WithinLimits", "Project quotas fit the tenant limits again") }
+        setCondition(&t.Status.Conditions, "WithinLimits", "True", "WithinLimits", "Project quotas fit the tenant limits")
+    }
     setCondition(&t.Status.Conditions, "Ready", "True", "Bootstrapped", "Tenant initialized")
     t.Status.Ready = true
     if err := r.Status().Update(ctx, &t); err != nil {
         lg.Error(err, "update tenant status")
         return ctrl.Result{}, err
     }
-    return ctrl.Result{}, nil
+    readiness.set("Tenant", req.NamespacedName, t.Name, t.Status.Ready)
+    // quota usage changes without any event on the Tenant
+    return ctrl.Result{RequeueAfter: tenantUsageInterval}, nil
 }
 func (r *TenantReconciler) SetupWithManager(mgr ctrl.Manager) error {
     return ctrl.NewControllerManagedBy(mgr).
-        For(&v1alpha1.Tenant{}).
+        For(&v1beta1.Tenant{}).
+        Watches(&v1beta1.Project{}, handler.EnqueueRequestsFromMapFunc(projectToTenant)).
         WithOptions(controller.Options{MaxConcurrentReconciles: 1}).
-        Complete(r)
+        Complete(instrument("Tenant", mgr.GetClient(), r))
 }
 
-// Project reconciler: ensure namespace exists and set ready.
-type ProjectReconciler struct{ client.Client }
+// Project reconciler: ensure namespace exists and set ready; tear it down on delete.
+type ProjectReconciler struct{
+    client.Client
+    // Defaults is the ConfigMap holding the operator's project defaults;
+    // the built-in defaults are used when unset.
+    Defaults types.NamespacedName
+    // IngressNamespaces are the namespaces of the ingress controllers and
+    // gateways routing to Apps; the kubeop-ingress policy admits them.
+    IngressNamespaces []string
+    Recorder record.EventRecorder
+}
 
 func (r *ProjectReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
     lg := log.FromContext(ctx)
-    var p v1alpha1.Project
+    var p v1beta1.Project
     if err := r.Get(ctx, req.NamespacedName, &p); err != nil {
+        if apierrors.IsNotFound(err) { readiness.forget("Project", req.NamespacedName) }
         return ctrl.Result{}, client.IgnoreNotFound(err)
     }
-    nsName := fmt.Sprintf("kubeop-%s-%s", p.Spec.TenantRef, p.Spec.Name)
+    defer func() { readiness.set("Project", req.NamespacedName, p.Spec.TenantRef, p.Status.Ready) }()
+    if !p.DeletionTimestamp.IsZero() {
+        return r.teardown(ctx, &p)
+    }
+    // label the Project with its tenant so tenants can select their projects
+    changed := controllerutil.AddFinalizer(&p, projectFinalizer)
+    if p.Labels["app.kubeop.io/tenant"] != p.Spec.TenantRef {
+        labels := map[string]string{}
+        for k, v := range p.Labels { labels[k] = v }
+        labels["app.kubeop.io/tenant"] = p.Spec.TenantRef
+        p.Labels = labels
+        changed = true
+    }
+    if changed {
+        if err := r.Update(ctx, &p); err != nil { return ctrl.Result{}, err }
+    }
+    res, err := r.projectResources(ctx, &p)
+    if err != nil { return ctrl.Result{}, r.baselineFailed(ctx, &p, err) }
+    quota := quotaHard(res)
+    nsName := projectNamespace(&p)
     var ns corev1.Namespace
     if err := r.Get(ctx, types.NamespacedName{Name: nsName}, &ns); err != nil {
         if apierrors.IsNotFound(err) {
+            // a new namespace allocates a project quota, which must fit the tenant
+            msg, err := r.checkTenantLimits(ctx, &p, quota)
+            if err != nil { return ctrl.Result{}, err }
+            if msg != "" {
+                if conditionChanged(p.Status.Conditions, "Ready", "False", "TenantLimitExceeded") { recordEvent(r.Recorder, &p, corev1.EventTypeWarning, "TenantLimitExceeded", msg) }
+                setCondition(&p.Status.Conditions, "Ready", "False", "TenantLimitExceeded", msg)
+                p.Status.Ready = false
+                if err := r.Status().Update(ctx, &p); err != nil { return ctrl.Result{}, err }
+                return ctrl.Result{RequeueAfter: tenantUsageInterval}, nil
+            }
             ns = corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: nsName, Labels: map[string]string{
                 "app.kubeop.io/tenant": p.Spec.TenantRef,
                 "app.kubeop.io/project": p.Spec.Name,
             }}}
+            // owned by the Project so namespace events reach this reconciler
+            if err := controllerutil.SetControllerReference(&p, &ns, r.Scheme()); err != nil { return ctrl.Result{}, err }
             if err := r.Create(ctx, &ns); err != nil {
                 lg.Error(err, "create namespace")
+                recordEvent(r.Recorder, &p, corev1.EventTypeWarning, "CreateFailed", err.Error())
                 setCondition(&p.Status.Conditions, "Ready", "False", "CreateFailed", err.Error())
                 _ = r.Status().Update(ctx, &p)
                 return ctrl.Result{}, err
             }
+            recordEvent(r.Recorder, &p, corev1.EventTypeNormal, "NamespaceCreated", "Created namespace "+nsName)
         } else {
             return ctrl.Result{}, err
         }
     }
-    // ensure baseline policies
-    if err := r.ensureLimitRange(ctx, nsName); err != nil { return ctrl.Result{}, err }
-    if err := r.ensureResourceQuota(ctx, nsName); err != nil { return ctrl.Result{}, err }
-    if err := r.ensureEgressPolicy(ctx, nsName); err != nil { return ctrl.Result{}, err }
-    if err := r.ensureIngressIsolation(ctx, nsName); err != nil { return ctrl.Result{}, err }
+    // quota changes of an existing namespace must fit the tenant as well;
+    // until they do, the applied quota is kept, and a project without one
+    // (such as a namespace bootstrapped before quotas were recorded) gets none
+    msg, err := r.checkTenantLimits(ctx, &p, quota)
+    if err != nil { return ctrl.Result{}, err }
+    if msg != "" {
+        quota = p.Status.Quota
+        if conditionChanged(p.Status.Conditions, "QuotaApplied", "False", "TenantLimitExceeded") { recordEvent(r.Recorder, &p, corev1.EventTypeWarning, "TenantLimitExceeded", msg) }
+        setCondition(&p.Status.Conditions, "QuotaApplied", "False", "TenantLimitExceeded", msg)
+    } else {
+        setCondition(&p.Status.Conditions, "QuotaApplied", "True", "Applied", "Project quota applied")
+    }
+    // apply baseline policies, reverting manual changes
+    var policies v1beta1.PolicyList
+    if err := r.List(ctx, &policies); err != nil { return ctrl.Result{}, err }
+    bootstrapped := p.Status.Namespace == nsName
+    var drift []string
+    baselines := []baseline{limitRangeBaseline(&ns, res)}
+    if len(quota) > 0 { baselines = append(baselines, resourceQuotaBaseline(&ns, quota)) }
+    baselines = append(baselines, egressBaseline(&ns, policies.Items), ingressIsolationBaseline(&ns, r.IngressNamespaces), serviceAccountBaseline(&ns), roleBaseline(&ns), roleBindingBaseline(&ns))
+    for _, b := range baselines {
+        msg, err := applyBaseline(ctx, r.Client, b, bootstrapped)
+        if err != nil { return ctrl.Result{}, r.baselineFailed(ctx, &p, err) }
+        if msg != "" { drift = append(drift, msg) }
+    }
+    if len(drift) > 0 {
+        lg.Info("reverted drift of baseline objects", "namespace", nsName, "drift", drift)
+        recordEvent(r.Recorder, &p, corev1.EventTypeWarning, "DriftReverted", "Reverted manual changes: "+strings.Join(drift, ", "))
+    }
+    requeue := reportDrift(&p, drift)
 
+    if !equality.Semantic.DeepEqual(p.Status.Quota, quota) {
+        recordEvent(r.Recorder, &p, corev1.EventTypeNormal, "QuotaApplied", "Applied project quota to namespace "+nsName)
+    }
     p.Status.Namespace = nsName
+    p.Status.Quota = quota
     setCondition(&p.Status.Conditions, "Ready", "True", "Bootstrapped", "Project namespace ready")
     p.Status.Ready = true
     if err := r.Status().Update(ctx, &p); err != nil {
         lg.Error(err, "update project status")
         return ctrl.Result{}, err
     }
-    return ctrl.Result{}, nil
+    return ctrl.Result{RequeueAfter: requeue}, nil
 }
 func (r *ProjectReconciler) SetupWithManager(mgr ctrl.Manager) error {
-    return ctrl.NewControllerManagedBy(mgr).
-        For(&v1alpha1.Project{}).
+    b := ctrl.NewControllerManagedBy(mgr).
+        For(&v1beta1.Project{}).
         Owns(&corev1.Namespace{}).
-        WithOptions(controller.Options{MaxConcurrentReconciles: 1}).
-        Complete(r)
-}
-
-func (r *ProjectReconciler) ensureLimitRange(ctx context.Context, ns string) error {
-    var lr corev1.LimitRange
-    err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: "kubeop-defaults"}, &lr)
-    if apierrors.IsNotFound(err) {
-        lr = corev1.LimitRange{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-defaults", Namespace: ns}, Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
-            Type: corev1.LimitTypeContainer,
-            DefaultRequest: corev1.ResourceList{corev1.ResourceCPU: resourceMust("100m"), corev1.ResourceMemory: resourceMust("64Mi")},
-            Default:        corev1.ResourceList{corev1.ResourceCPU: resourceMust("500m"), corev1.ResourceMemory: resourceMust("256Mi")},
-        }}}}
-        return r.Create(ctx, &lr)
+        Owns(&corev1.LimitRange{}).
+        Owns(&corev1.ResourceQuota{}, builder.WithPredicates(specChanged)).
+        Owns(&networkingv1.NetworkPolicy{}).
+        Owns(&corev1.ServiceAccount{}).
+        Owns(&rbacv1.Role{}).
+        Owns(&rbacv1.RoleBinding{})
+    if r.Defaults.Name != "" {
+        b = b.Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.defaultsToProjects))
     }
-    return err
+    return b.WithOptions(controller.Options{MaxConcurrentReconciles: 1}).Complete(instrument("Project", mgr.GetClient(), r))
 }
 
-func (r *ProjectReconciler) ensureResourceQuota(ctx context.Context, ns string) error {
-    var rq corev1.ResourceQuota
-    err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: "kubeop-quota"}, &rq)
-    if apierrors.IsNotFound(err) {
-        rq = corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-quota", Namespace: ns}, Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{
-            corev1.ResourcePods:           resourceMust("10"),
-            corev1.ResourceRequestsCPU:    resourceMust("1"),
-            corev1.ResourceRequestsMemory: resourceMust("1Gi"),
-        }}}
-        return r.Create(ctx, &rq)
-    }
+// baselineFailed reports a project namespace that could not be configured.
+func (r *ProjectReconciler) baselineFailed(ctx context.Context, p *v1beta1.Project, err error) error {
+    recordEvent(r.Recorder, p, corev1.EventTypeWarning, "BaselineFailed", err.Error())
+    setCondition(&p.Status.Conditions, "Ready", "False", "BaselineFailed", err.Error())
+    p.Status.Ready = false
+    _ = r.Status().Update(ctx, p)
     return err
 }
 
-func (r *ProjectReconciler) ensureEgressPolicy(ctx context.Context, ns string) error {
-    var np networkingv1.NetworkPolicy
-    err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: "kubeop-egress"}, &np)
-    if apierrors.IsNotFound(err) {
-        np = networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-egress", Namespace: ns}, Spec: networkingv1.NetworkPolicySpec{
-            PodSelector: metav1.LabelSelector{},
-            PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
-            Egress: []networkingv1.NetworkPolicyEgressRule{{}},
-        }}
-        return r.Create(ctx, &np)
+// projectQuota is the built-in kubeop-quota hard limit of a project.
+func projectQuota() corev1.ResourceList {
+    return corev1.ResourceList{
+        corev1.ResourcePods:           resourceMust("10"),
+        corev1.ResourceRequestsCPU:    resourceMust("1"),
+        corev1.ResourceRequestsMemory: resourceMust("1Gi"),
     }
-    return err
-}
-
-// ensureIngressIsolation creates a NetworkPolicy that allows ingress only from pods
-// within the same namespace, effectively blocking cross-namespace traffic.
-func (r *ProjectReconciler) ensureIngressIsolation(ctx context.Context, ns string) error {
-    var np networkingv1.NetworkPolicy
-    err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: "kubeop-ingress"}, &np)
-    if apierrors.IsNotFound(err) {
-        allowSameNS := networkingv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{}}
-        np = networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-ingress", Namespace: ns}, Spec: networkingv1.NetworkPolicySpec{
-            PodSelector: metav1.LabelSelector{},
-            PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
-            Ingress: []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{allowSameNS}}},
-        }}
-        return r.Create(ctx, &np)
-    }
-    return err
 }
 
 func resourceMust(s string) resource.Quantity { q := resource.MustParse(s); return q }
 
-// App reconciler: set a revision and ready.
-type AppReconciler struct{ client.Client }
+// App reconciler: deploy Image, Git, Helm and Raw sources, set a revision and ready.
+type AppReconciler struct{
+    client.Client
+    // ChartsDir is the directory local Helm chart paths are resolved in.
+    ChartsDir string
+    // Expose configures the routes created for Apps with a host.
+    Expose ExposeConfig
+    // PrometheusURL is queried for the metric checks of rollout strategies.
+    PrometheusURL string
+    Recorder      record.EventRecorder
+}
 
 func (r *AppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
     lg := log.FromContext(ctx)
-    var a v1alpha1.App
+    var a v1beta1.App
     if err := r.Get(ctx, req.NamespacedName, &a); err != nil {
+        if apierrors.IsNotFound(err) { readiness.forget("App", req.NamespacedName) }
         return ctrl.Result{}, client.IgnoreNotFound(err)
     }
+    healthy := everHealthy(&a)
+    defer func() { observeApp(ctx, r.Client, &a, healthy) }()
+    if !a.DeletionTimestamp.IsZero() {
+        return ctrl.Result{}, r.finalize(ctx, &a)
+    }
+    if a.Spec.RollbackTo != nil {
+        return r.rollback(ctx, &a)
+    }
+    a.Status.ObservedGeneration = a.Generation
+    if a.Spec.Type == "Helm" && controllerutil.AddFinalizer(&a, helmFinalizer) {
+        if err := r.Update(ctx, &a); err != nil { return ctrl.Result{}, err }
+    }
+    if retainsVolumes(&a) && controllerutil.AddFinalizer(&a, volumesFinalizer) {
+        if err := r.Update(ctx, &a); err != nil { return ctrl.Result{}, err }
+    }
     // Optional CPU spin for load testing (e2e): burn CPU for configured milliseconds per reconcile
     if msStr := os.Getenv("KUBEOP_RECONCILE_SPIN_MS"); msStr != "" {
         if ms, err := strconv.Atoi(msStr); err == nil && ms > 0 {
@@ -196,141 +307,270 @@ func (r *AppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
         }
     }
     // ensure deployment for Image type
+    held := false
+    var rolloutRequeue time.Duration
     if a.Spec.Type == "Image" && a.Spec.Image != "" {
         depName := "app-" + a.Name
         var dep appsv1.Deployment
         err := r.Get(ctx, types.NamespacedName{Namespace: req.Namespace, Name: depName}, &dep)
-        replicas := int32(1)
+        if err != nil && !apierrors.IsNotFound(err) { return ctrl.Result{}, err }
+        rev := imageRevision(&a)
+        // pre hooks must succeed before a new revision reaches the Deployment
+        newRev := err != nil || dep.Spec.Template.Annotations["kubeop.io/revision"] != rev
+        if newRev && a.Spec.Hooks != nil && len(a.Spec.Hooks.Pre) > 0 {
+            res, herr := r.runHooks(ctx, &a, a.Spec.Hooks.Pre, rev, "pre")
+            if herr != nil { return ctrl.Result{}, herr }
+            if res != hookSucceeded {
+                reason, msg := "PreHooksRunning", "Waiting for pre hooks of revision "+rev
+                if res == hookFailed { reason, msg = "PreHookFailed", "Pre hook failed, revision "+rev+" is blocked" }
+                if res == hookFailed && conditionChanged(a.Status.Conditions, "Ready", "False", reason) { recordEvent(r.Recorder, &a, corev1.EventTypeWarning, reason, msg) }
+                setCondition(&a.Status.Conditions, "Ready", "False", reason, msg)
+                a.Status.Ready = false
+                if err := r.Status().Update(ctx, &a); err != nil { return ctrl.Result{}, err }
+                // hook Jobs are owned, so their completion triggers the next reconcile
+                return ctrl.Result{}, nil
+            }
+        }
+        // a Canary or BlueGreen candidate must be promoted before the
+        // stable Deployment is updated
+        if err == nil && (progressive(&a) || rolloutActive(&a)) {
+            promote, requeue, rerr := r.reconcileRollout(ctx, &a, &dep, rev)
+            if rerr != nil { return ctrl.Result{}, rerr }
+            held, rolloutRequeue = !promote, requeue
+        }
+        // claims exist before the pods that mount them
+        if err := r.reconcileVolumes(ctx, &a); err != nil { return ctrl.Result{}, err }
+        replicas := imageReplicas(&a)
         labels := map[string]string{"app.kubeop.io/app": a.Name}
         if apierrors.IsNotFound(err) {
             // Create a simple Deployment without strict security context to
             // allow common images (e.g., nginx) to run out-of-the-box in E2E.
-            dep = appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: depName, Namespace: req.Namespace, Labels: labels, Annotations: map[string]string{"kubeop.io/revision": computeImageRev(a.Spec.Image)}}, Spec: appsv1.DeploymentSpec{
+            dep = appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: depName, Namespace: req.Namespace, Labels: labels, Annotations: map[string]string{"kubeop.io/revision": rev}}, Spec: appsv1.DeploymentSpec{
                 Replicas: &replicas,
                 Selector: &metav1.LabelSelector{MatchLabels: labels},
-                Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: labels, Annotations: map[string]string{"kubeop.io/revision": computeImageRev(a.Spec.Image)}}, Spec: corev1.PodSpec{
-                    Containers: []corev1.Container{{
-                        Name:  "app",
-                        Image: a.Spec.Image,
-                        Ports: []corev1.ContainerPort{{ContainerPort: 80}},
-                    }},
+                Strategy: deploymentStrategy(&a),
+                Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: labels, Annotations: map[string]string{"kubeop.io/revision": rev}}, Spec: corev1.PodSpec{
+                    Containers: []corev1.Container{imageContainer(&a)},
+                    Volumes:    podVolumes(&a),
                 }},
             }}
+            // owned so Deployment status changes reach this reconciler
+            if err := controllerutil.SetControllerReference(&a, &dep, r.Scheme()); err != nil { return ctrl.Result{}, err }
             if err := r.Create(ctx, &dep); err != nil { return ctrl.Result{}, err }
-        } else if err == nil {
-            if len(dep.Spec.Template.Spec.Containers) == 0 {
-                dep.Spec.Template.Spec.Containers = []corev1.Container{{ Name: "app", Image: a.Spec.Image }}
-            } else {
-                dep.Spec.Template.Spec.Containers[0].Image = a.Spec.Image
+            recordEvent(r.Recorder, &a, corev1.EventTypeNormal, "RolloutStarted", "Rolling out revision "+rev)
+        } else {
+            // adopt Deployments created before Apps owned them
+            if err := controllerutil.SetControllerReference(&a, &dep, r.Scheme()); err != nil { return ctrl.Result{}, err }
+            // the HPA owns the replica count of autoscaled Apps
+            if !autoscaled(&a) { dep.Spec.Replicas = &replicas }
+            // a held revision leaves the pod template on the stable revision
+            if !held {
+                if len(dep.Spec.Template.Spec.Containers) == 0 {
+                    dep.Spec.Template.Spec.Containers = []corev1.Container{imageContainer(&a)}
+                } else {
+                    dep.Spec.Template.Spec.Containers[0] = imageContainer(&a)
+                }
+                dep.Spec.Template.Spec.Volumes = podVolumes(&a)
+                dep.Spec.Strategy = deploymentStrategy(&a)
+                if dep.Spec.Template.Annotations == nil { dep.Spec.Template.Annotations = map[string]string{} }
+                dep.Spec.Template.Annotations["kubeop.io/revision"] = rev
             }
-            if dep.Spec.Template.Annotations == nil { dep.Spec.Template.Annotations = map[string]string{} }
-            dep.Spec.Template.Annotations["kubeop.io/revision"] = computeImageRev(a.Spec.Image)
             if err := r.Update(ctx, &dep); err != nil { return ctrl.Result{}, err }
-        } else {
+            if newRev && !held { recordEvent(r.Recorder, &a, corev1.EventTypeNormal, "RolloutStarted", "Rolling out revision "+rev) }
+        }
+    }
+    if err := r.ensureHPA(ctx, &a); err != nil { return ctrl.Result{}, fmt.Errorf("hpa: %w", err) }
+    // render and apply manifests for Git, Helm and Raw types
+    if a.Spec.Type == "Git" || a.Spec.Type == "Helm" || a.Spec.Type == "Raw" {
+        var rev string
+        var err error
+        switch a.Spec.Type {
+        case "Git":
+            rev, err = r.syncGit(ctx, &a)
+        case "Helm":
+            rev, err = r.syncHelm(ctx, &a)
+        case "Raw":
+            rev, err = r.syncRaw(ctx, &a)
+        }
+        if err != nil {
+            lg.Error(err, "sync app source", "type", a.Spec.Type)
+            recordEvent(r.Recorder, &a, corev1.EventTypeWarning, "SyncFailed", err.Error())
+            setCondition(&a.Status.Conditions, "Ready", "False", "SyncFailed", err.Error())
+            a.Status.Ready = false
+            _ = r.Status().Update(ctx, &a)
             return ctrl.Result{}, err
         }
+        a.Status.Revision = rev
+    }
+    // expose Apps with a host
+    exposeWait, err := r.reconcileExposure(ctx, &a)
+    if err != nil {
+        lg.Error(err, "expose app")
+        recordEvent(r.Recorder, &a, corev1.EventTypeWarning, "ExposeFailed", err.Error())
+        setCondition(&a.Status.Conditions, "Ready", "False", "ExposeFailed", err.Error())
+        a.Status.Ready = false
+        _ = r.Status().Update(ctx, &a)
+        return ctrl.Result{}, err
     }
     // set revision based on image hash for Image type
     if a.Spec.Type == "Image" && a.Spec.Image != "" {
-        a.Status.Revision = computeImageRev(a.Spec.Image)
+        a.Status.Revision = imageRevision(&a)
+        // the stable revision serves until the candidate is promoted
+        if held { a.Status.Revision = a.Status.Rollout.StableRevision }
     } else if a.Status.Revision == "" {
         a.Status.Revision = time.Now().UTC().Format("20060102-150405")
     }
+    // a held revision is recorded once it is promoted
+    if !held {
+        if err := r.recordRevision(ctx, &a); err != nil { return ctrl.Result{}, err }
+    }
     // reflect deployment readiness
     ready := true
+    reason, waitMsg := "Progressing", ""
     if a.Spec.Type == "Image" && a.Spec.Image != "" {
         var dep appsv1.Deployment
-        if err := r.Get(ctx, types.NamespacedName{Namespace: req.Namespace, Name: "app-" + a.Name}, &dep); err == nil {
-            if dep.Status.AvailableReplicas < 1 { ready = false }
+        err := r.Get(ctx, types.NamespacedName{Namespace: req.Namespace, Name: "app-" + a.Name}, &dep)
+        if err != nil && !apierrors.IsNotFound(err) { return ctrl.Result{}, err }
+        if err == nil {
+            if ready, reason, waitMsg, err = r.rolloutStatus(ctx, &a, &dep); err != nil { return ctrl.Result{}, err }
         }
     }
+    // post hooks run once the new revision is fully rolled out
+    if ready && a.Spec.Type == "Image" && a.Spec.Image != "" && a.Spec.Hooks != nil && len(a.Spec.Hooks.Post) > 0 {
+        if _, err := r.runHooks(ctx, &a, a.Spec.Hooks.Post, a.Status.Revision, "post"); err != nil { return ctrl.Result{}, err }
+    }
+    // a host is only served once its DNS record and certificate are ready
+    if ready && exposeWait != "" {
+        ready = false
+        waitMsg = exposeWait
+    }
     if ready {
+        if conditionChanged(a.Status.Conditions, "Ready", "True", "Converged") { recordEvent(r.Recorder, &a, corev1.EventTypeNormal, "Ready", "Revision "+a.Status.Revision+" is ready") }
         setCondition(&a.Status.Conditions, "Ready", "True", "Converged", "App reconciled")
         a.Status.Ready = true
+        if n := len(a.Status.History); n > 0 && !held { a.Status.History[n-1].Healthy = true }
     } else {
-        setCondition(&a.Status.Conditions, "Ready", "False", "Progressing", "Waiting for rollout")
+        // owned Deployments, pods, Ingresses, DNSRecords and Certificates,
+        // and the Gateway of HTTPRoutes, trigger the next reconcile, so there
+        // is nothing to poll
+        if reason != "Progressing" && conditionChanged(a.Status.Conditions, "Ready", "False", reason) { recordEvent(r.Recorder, &a, corev1.EventTypeWarning, reason, waitMsg) }
+        setCondition(&a.Status.Conditions, "Ready", "False", reason, waitMsg)
         a.Status.Ready = false
-        _ = r.Status().Update(ctx, &a)
-        return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+        if err := r.Status().Update(ctx, &a); err != nil { return ctrl.Result{}, err }
+        return ctrl.Result{RequeueAfter: rolloutRequeue}, nil
     }
     if err := r.Status().Update(ctx, &a); err != nil {
         lg.Error(err, "update app status")
         return ctrl.Result{}, err
     }
-    return ctrl.Result{}, nil
+    if a.Spec.Type == "Git" {
+        // poll the ref so new commits on a branch are picked up
+        return ctrl.Result{RequeueAfter: gitResyncInterval}, nil
+    }
+    return ctrl.Result{RequeueAfter: rolloutRequeue}, nil
 }
 
-func computeImageRev(img string) string {
-    h := sha1.New()
-    h.Write([]byte(img))
-    return hex.EncodeToString(h.Sum(nil))[:12]
-}
-func (r *AppReconciler) SetupWithManager(mgr ctrl.Manager) error {
-    return ctrl.NewControllerManagedBy(mgr).
-        For(&v1alpha1.App{}).
-        WithOptions(controller.Options{MaxConcurrentReconciles: 2}).
-        Complete(r)
+// gitResyncInterval is how often Git Apps re-resolve their ref.
+const gitResyncInterval = 3 * time.Minute
+
+// syncGit checks out the App's Git source and applies the manifests found
+// under its path, returning the deployed commit SHA.
+func (r *AppReconciler) syncGit(ctx context.Context, a *v1beta1.App) (string, error) {
+    if a.Spec.Git == nil || a.Spec.Git.Repo == "" {
+        return "", fmt.Errorf("spec.git.repo is required for type Git")
+    }
+    res, err := source.Git(ctx, a.Spec.Git.Repo, a.Spec.Git.Ref, a.Spec.Git.Path)
+    if err != nil { return "", err }
+    if err := r.applyManifests(ctx, a, res.Objects); err != nil { return "", err }
+    return res.Commit, nil
 }
 
-// DNSRecord reconciler: mock provider success.
-type DNSRecordReconciler struct{
-    client.Client
-    Endpoint string
+// syncRaw applies the App's inline multi-document YAML. The revision is a
+// hash of the manifest text.
+func (r *AppReconciler) syncRaw(ctx context.Context, a *v1beta1.App) (string, error) {
+    objs, err := kube.DecodeManifests(strings.NewReader(a.Spec.RawManifests))
+    if err != nil { return "", fmt.Errorf("parse rawManifests: %w", err) }
+    if len(objs) == 0 { return "", fmt.Errorf("spec.rawManifests is required for type Raw") }
+    if err := r.applyManifests(ctx, a, objs); err != nil { return "", err }
+    return computeImageRev(a.Spec.RawManifests), nil
 }
 
-func (r *DNSRecordReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-    var d v1alpha1.DNSRecord
-    if err := r.Get(ctx, req.NamespacedName, &d); err != nil {
-        return ctrl.Result{}, client.IgnoreNotFound(err)
-    }
-    if r.Endpoint != "" {
-        // fire-and-forget POST
-        _ , _ = http.Post(r.Endpoint+"/v1/dnsrecords", "application/json", http.NoBody)
+// helmFinalizer makes deleting a Helm App uninstall its release first.
+const helmFinalizer = "paas.kubeop.io/helm-release"
+
+// maxHelmHistory bounds AppStatus.Helm.History.
+const maxHelmHistory = 10
+
+// syncHelm renders the App's chart and applies it. A new release revision is
+// recorded whenever the chart or values digest changes.
+func (r *AppReconciler) syncHelm(ctx context.Context, a *v1beta1.App) (string, error) {
+    if a.Spec.Helm == nil || a.Spec.Helm.Chart == "" {
+        return "", fmt.Errorf("spec.helm.chart is required for type Helm")
     }
-    d.Status.Ready = true
-    d.Status.Message = "mocked"
-    if err := r.Status().Update(ctx, &d); err != nil {
-        return ctrl.Result{}, err
+    ch, err := source.LoadHelmChart(r.ChartsDir, a.Spec.Helm.Chart, a.Spec.Helm.Version, a.Spec.Helm.Values)
+    if err != nil { return "", err }
+    st := a.Status.Helm
+    if st == nil { st = &v1beta1.HelmReleaseStatus{} }
+    revision := st.Revision
+    upgrade := revision == 0 || st.Digest != ch.Digest
+    if upgrade { revision++ }
+    objs, err := ch.Render(source.HelmRelease{Name: a.Name, Namespace: a.Namespace, Revision: revision})
+    if err != nil { return "", err }
+    if err := r.applyManifests(ctx, a, objs); err != nil { return "", err }
+    if upgrade {
+        st.Chart, st.Version, st.Digest, st.Revision = ch.Name, ch.Version, ch.Digest, revision
+        st.History = append(st.History, v1beta1.HelmReleaseRevision{Revision: revision, Version: ch.Version, Digest: ch.Digest, Deployed: metav1.Now()})
+        if len(st.History) > maxHelmHistory {
+            st.History = st.History[len(st.History)-maxHelmHistory:]
+        }
     }
-    return ctrl.Result{}, nil
-}
-func (r *DNSRecordReconciler) SetupWithManager(mgr ctrl.Manager) error {
-    return ctrl.NewControllerManagedBy(mgr).
-        For(&v1alpha1.DNSRecord{}).
-        Complete(r)
+    a.Status.Helm = st
+    return ch.Digest, nil
 }
 
-// Certificate reconciler: set ready immediately.
-type CertificateReconciler struct{
-    client.Client
-    Endpoint string
-}
-
-func (r *CertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-    var c v1alpha1.Certificate
-    if err := r.Get(ctx, req.NamespacedName, &c); err != nil {
-        return ctrl.Result{}, client.IgnoreNotFound(err)
+// finalize runs cleanup for a deleted App and releases its finalizers.
+func (r *AppReconciler) finalize(ctx context.Context, a *v1beta1.App) error {
+    done := false
+    if controllerutil.ContainsFinalizer(a, volumesFinalizer) {
+        if err := r.releaseVolumes(ctx, a); err != nil { return err }
+        done = controllerutil.RemoveFinalizer(a, volumesFinalizer)
     }
-    if r.Endpoint != "" {
-        _, _ = http.Post(r.Endpoint+"/v1/certificates", "application/json", http.NoBody)
+    if controllerutil.ContainsFinalizer(a, helmFinalizer) {
+        if err := r.deleteResources(ctx, a, a.Status.Resources); err != nil { return err }
+        done = controllerutil.RemoveFinalizer(a, helmFinalizer)
     }
-    c.Status.Ready = true
-    c.Status.Message = "issued"
-    if err := r.Status().Update(ctx, &c); err != nil {
-        return ctrl.Result{}, err
-    }
-    return ctrl.Result{}, nil
+    if !done { return nil }
+    return r.Update(ctx, a)
 }
-func (r *CertificateReconciler) SetupWithManager(mgr ctrl.Manager) error {
-    return ctrl.NewControllerManagedBy(mgr).
-        For(&v1alpha1.Certificate{}).
+
+func computeImageRev(img string) string {
+    h := sha1.New()
+    h.Write([]byte(img))
+    return hex.EncodeToString(h.Sum(nil))[:12]
+}
+func (r *AppReconciler) SetupWithManager(mgr ctrl.Manager) error {
+    b := ctrl.NewControllerManagedBy(mgr).
+        For(&v1beta1.App{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
         Owns(&appsv1.Deployment{}).
-        Complete(r)
+        // HPA status changes with every metrics sync
+        Owns(&autoscalingv2.HorizontalPodAutoscaler{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+        Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(podToApp)).
+        Owns(&batchv1.Job{}).
+        Owns(&corev1.Service{}).
+        Owns(&corev1.PersistentVolumeClaim{}).
+        Owns(&networkingv1.Ingress{}).
+        Owns(&v1beta1.DNSRecord{}).
+        Owns(&v1beta1.Certificate{})
+    // HTTPRoutes take their address from a Gateway the Apps do not own
+    if r.Expose.Mode == RoutingHTTPRoute && r.Expose.Gateway != "" {
+        b = b.Watches(gateway(), handler.EnqueueRequestsFromMapFunc(r.gatewayToApps))
+    }
+    return b.WithOptions(controller.Options{MaxConcurrentReconciles: 2}).Complete(instrument("App", mgr.GetClient(), r))
 }
 
 // buildHookJob returns a Kubernetes Job to run a single hook container for the given app, revision, and phase.
-func buildHookJob(a *v1alpha1.App, hk v1alpha1.Hook, rev, phase string) *batchv1.Job {
-    name := fmt.Sprintf("hook-%s-%s-%s", phase, a.Name, rev)
+func buildHookJob(a *v1beta1.App, hk v1beta1.Hook, rev, phase string) *batchv1.Job {
+    name := hookJobName(a, rev, phase, 0)
     backoff := int32(0)
     ttl := int32(60)
     job := &batchv1.Job{
@@ -2,7 +2,7 @@ package controllers
 
 import (
     "testing"
-    v1alpha1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1alpha1"
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
     batchv1 "k8s.io/api/batch/v1"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -14,13 +14,13 @@ func Test_computeImageRev(t *testing.T) {
 }
 
 // buildHookJobForTest mirrors runHooks job creation for unit testing
-func buildHookJobForTest(a *v1alpha1.App, hk v1alpha1.Hook, rev, phase string) *batchv1.Job {
+func buildHookJobForTest(a *v1beta1.App, hk v1beta1.Hook, rev, phase string) *batchv1.Job {
     return buildHookJob(a, hk, rev, phase)
 }
 
 func Test_BuildHookJob_Defaults(t *testing.T) {
-    a := &v1alpha1.App{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kubeop-acme-web"}}
-    hk := v1alpha1.Hook{Image: "alpine:3.20", Args: []string{"/bin/true"}}
+    a := &v1beta1.App{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kubeop-acme-web"}}
+    hk := v1beta1.Hook{Image: "alpine:3.20", Args: []string{"/bin/true"}}
     j := buildHookJobForTest(a, hk, "abcd1234", "pre")
     if j == nil { t.Fatalf("nil job") }
     if j.Name != "hook-pre-web-abcd1234" { t.Fatalf("unexpected name: %s", j.Name) }
@@ -28,3 +28,19 @@ func Test_BuildHookJob_Defaults(t *testing.T) {
     if len(j.Spec.Template.Spec.Containers) != 1 { t.Fatalf("unexpected containers: %d", len(j.Spec.Template.Spec.Containers)) }
     if j.Spec.Template.Spec.Containers[0].Image != "alpine:3.20" { t.Fatalf("unexpected image: %s", j.Spec.Template.Spec.Containers[0].Image) }
 }
+
+func Test_staleResources(t *testing.T) {
+    prev := []v1beta1.ResourceRef{
+        {APIVersion: "v1", Kind: "ConfigMap", Name: "cfg"},
+        {APIVersion: "autoscaling/v1", Kind: "HorizontalPodAutoscaler", Name: "web"},
+        {APIVersion: "v1", Kind: "Service", Name: "old"},
+    }
+    cur := []v1beta1.ResourceRef{
+        {APIVersion: "v1", Kind: "ConfigMap", Name: "cfg"},
+        {APIVersion: "autoscaling/v2", Kind: "HorizontalPodAutoscaler", Name: "web"},
+        {APIVersion: "v1", Kind: "Service", Name: "new"},
+    }
+    stale := staleResources(prev, cur)
+    if len(stale) != 1 || stale[0].Name != "old" { t.Fatalf("unexpected stale set: %v", stale) }
+    if len(staleResources(nil, cur)) != 0 { t.Fatalf("expected nothing stale on first sync") }
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// Delivery strategies for DeliveryStrategy.Type.
+const (
+    StrategyRollingUpdate = "RollingUpdate"
+    StrategyCanary        = "Canary"
+    StrategyBlueGreen     = "BlueGreen"
+)
+
+// Phases of RolloutStatus.Phase.
+const (
+    rolloutProgressing = "Progressing"
+    rolloutPaused      = "Paused"
+    rolloutPromoting   = "Promoting"
+    rolloutSucceeded   = "Succeeded"
+    rolloutAborted     = "Aborted"
+)
+
+var defaultCanarySteps = []int32{10, 50}
+
+const defaultStepSeconds = 60
+
+// checkRetryInterval is how often metric checks are retried while Prometheus
+// cannot answer them.
+const checkRetryInterval = 30 * time.Second
+
+// candidateLabel selects the pods of a rollout candidate. They carry no
+// app.kubeop.io/app label, so the stable Service never selects them.
+const candidateLabel = "app.kubeop.io/candidate"
+
+// progressive reports whether Image updates of a go through a candidate.
+func progressive(a *v1beta1.App) bool {
+    s := a.Spec.Strategy
+    return a.Spec.Type == "Image" && s != nil && (s.Type == StrategyCanary || s.Type == StrategyBlueGreen)
+}
+
+// rolloutActive reports whether a candidate of a is deployed.
+func rolloutActive(a *v1beta1.App) bool {
+    st := a.Status.Rollout
+    return st != nil && (st.Phase == rolloutProgressing || st.Phase == rolloutPaused || st.Phase == rolloutPromoting)
+}
+
+// candidateWeight is the share of traffic routed to the candidate of a.
+func candidateWeight(a *v1beta1.App) int32 {
+    if !rolloutActive(a) { return 0 }
+    return a.Status.Rollout.Weight
+}
+
+func candidateName(a *v1beta1.App) string { return "app-" + a.Name + "-canary" }
+
+// reconcileRollout moves a progressive rollout of revision rev forward. It
+// returns whether the stable Deployment may be updated to rev, which is the
+// case once the candidate is promoted or when there is nothing to roll out,
+// and when to check the rollout again.
+func (r *AppReconciler) reconcileRollout(ctx context.Context, a *v1beta1.App, stable *appsv1.Deployment, rev string) (bool, time.Duration, error) {
+    prev := ""
+    if a.Status.Rollout != nil { prev = a.Status.Rollout.Phase }
+    promote, requeue, err := r.stepRollout(ctx, a, stable, rev)
+    if st := a.Status.Rollout; st != nil {
+        if st.Phase != prev {
+            eventtype := corev1.EventTypeNormal
+            if st.Phase == rolloutAborted { eventtype = corev1.EventTypeWarning }
+            recordEvent(r.Recorder, a, eventtype, "Rollout"+st.Phase, st.Message)
+        }
+        status := "False"
+        if st.Phase == rolloutSucceeded { status = "True" }
+        setCondition(&a.Status.Conditions, "Rollout", status, st.Phase, st.Message)
+    }
+    return promote, requeue, err
+}
+
+func (r *AppReconciler) stepRollout(ctx context.Context, a *v1beta1.App, stable *appsv1.Deployment, rev string) (bool, time.Duration, error) {
+    stableRev := stable.Spec.Template.Annotations["kubeop.io/revision"]
+    st := a.Status.Rollout
+    if !progressive(a) {
+        // the strategy was dropped mid-rollout: the update proceeds in place
+        if rolloutActive(a) {
+            st.Phase, st.Weight, st.Message = rolloutAborted, 0, "Strategy removed"
+            return true, 0, r.deleteCandidate(ctx, a)
+        }
+        return true, 0, nil
+    }
+    s := a.Spec.Strategy
+    if st == nil || st.Revision != rev {
+        if stableRev == rev { return true, 0, nil }
+        st = &v1beta1.RolloutStatus{Strategy: s.Type, Revision: rev, StableRevision: stableRev, Phase: rolloutProgressing, StepStarted: metav1.Now()}
+        a.Status.Rollout = st
+    }
+    switch st.Phase {
+    case rolloutAborted:
+        return false, 0, r.deleteCandidate(ctx, a)
+    case rolloutSucceeded:
+        return true, 0, nil
+    case rolloutPromoting:
+        // the candidate keeps all traffic until the stable Deployment runs rev
+        if stableRev != rev || !rolloutComplete(stable) { return true, 0, nil }
+        st.Phase, st.Weight, st.Message = rolloutSucceeded, 0, "Promoted revision "+rev
+        return true, 0, r.deleteCandidate(ctx, a)
+    }
+
+    cand, err := r.ensureCandidate(ctx, a, stable, rev)
+    if err != nil { return false, 0, fmt.Errorf("candidate: %w", err) }
+    if err := r.ensureService(ctx, a, cand.Name, map[string]string{candidateLabel: a.Name}); err != nil { return false, 0, fmt.Errorf("candidate service: %w", err) }
+    healthy, reason, msg, err := r.deploymentHealth(ctx, cand)
+    if err != nil { return false, 0, err }
+    if !healthy {
+        if reason != "Progressing" { return false, 0, r.abortRollout(ctx, a, reason+": "+msg) }
+        // steps are timed from when the candidate is ready; its
+        // Deployment status triggers the next reconcile
+        st.StepStarted, st.Message = metav1.Now(), msg
+        return false, 0, nil
+    }
+    failure, err := r.evaluateChecks(ctx, a, cand.Name)
+    if err != nil {
+        st.Message = err.Error()
+        return false, checkRetryInterval, nil
+    }
+    if failure != "" { return false, 0, r.abortRollout(ctx, a, failure) }
+
+    stepSeconds := s.StepSeconds
+    if stepSeconds <= 0 { stepSeconds = defaultStepSeconds }
+    stepDuration := time.Duration(stepSeconds) * time.Second
+    wait := stepDuration - time.Since(st.StepStarted.Time)
+    // checks run again before the step ends
+    if len(s.Checks) > 0 && wait > checkRetryInterval { wait = checkRetryInterval }
+    switch s.Type {
+    case StrategyCanary:
+        steps := s.Steps
+        if len(steps) == 0 { steps = defaultCanarySteps }
+        if int(st.Step) < len(steps) && time.Since(st.StepStarted.Time) >= stepDuration {
+            st.Step++
+            st.StepStarted = metav1.Now()
+            wait = stepDuration
+        }
+        if int(st.Step) < len(steps) {
+            st.Phase, st.Weight = rolloutProgressing, steps[st.Step]
+            st.Message = fmt.Sprintf("Step %d/%d: %d%% of traffic on revision %s", st.Step+1, len(steps), st.Weight, rev)
+            return false, wait, nil
+        }
+    case StrategyBlueGreen:
+        st.Weight = 0
+        if s.Promote != rev && !(s.AutoPromote && time.Since(st.StepStarted.Time) >= stepDuration) {
+            st.Phase = rolloutPaused
+            st.Message = fmt.Sprintf("Revision %s is ready on Service %s, waiting for promotion", rev, cand.Name)
+            if s.AutoPromote { return false, wait, nil }
+            return false, 0, nil
+        }
+    }
+    st.Phase, st.Weight, st.Message = rolloutPromoting, 100, "Promoting revision "+rev
+    return true, 0, nil
+}
+
+// abortRollout sends all traffic back to the stable Deployment and removes
+// the candidate. The App stays on the stable revision until its spec changes.
+func (r *AppReconciler) abortRollout(ctx context.Context, a *v1beta1.App, msg string) error {
+    st := a.Status.Rollout
+    st.Phase, st.Weight, st.Message = rolloutAborted, 0, "Revision "+st.Revision+" aborted: "+msg
+    return r.deleteCandidate(ctx, a)
+}
+
+func (r *AppReconciler) deleteCandidate(ctx context.Context, a *v1beta1.App) error {
+    if err := r.deleteOwned(ctx, a, &appsv1.Deployment{}, candidateName(a)); err != nil { return err }
+    return r.deleteOwned(ctx, a, &corev1.Service{}, candidateName(a))
+}
+
+// ensureCandidate runs rev next to the stable Deployment, with the same pod
+// template apart from the App container and labels.
+func (r *AppReconciler) ensureCandidate(ctx context.Context, a *v1beta1.App, stable *appsv1.Deployment, rev string) (*appsv1.Deployment, error) {
+    labels := map[string]string{candidateLabel: a.Name}
+    tmpl := *stable.Spec.Template.DeepCopy()
+    tmpl.Labels = labels
+    tmpl.Annotations = map[string]string{"kubeop.io/revision": rev}
+    // the stable template may still mount claims the App no longer lists
+    tmpl.Spec.Volumes = podVolumes(a)
+    if len(tmpl.Spec.Containers) == 0 {
+        tmpl.Spec.Containers = []corev1.Container{imageContainer(a)}
+    } else {
+        tmpl.Spec.Containers[0] = imageContainer(a)
+    }
+    replicas := imageReplicas(a)
+    if autoscaled(a) { replicas = desiredReplicas(stable) }
+
+    var dep appsv1.Deployment
+    err := r.Get(ctx, types.NamespacedName{Namespace: a.Namespace, Name: candidateName(a)}, &dep)
+    if apierrors.IsNotFound(err) {
+        dep = appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: candidateName(a), Namespace: a.Namespace, Labels: labels}, Spec: appsv1.DeploymentSpec{
+            Replicas: &replicas,
+            Selector: &metav1.LabelSelector{MatchLabels: labels},
+            Template: tmpl,
+        }}
+        if err := controllerutil.SetControllerReference(a, &dep, r.Scheme()); err != nil { return nil, err }
+        return &dep, r.Create(ctx, &dep)
+    }
+    if err != nil { return nil, err }
+    if dep.Spec.Template.Annotations["kubeop.io/revision"] == rev && desiredReplicas(&dep) == replicas { return &dep, nil }
+    dep.Spec.Replicas = &replicas
+    dep.Spec.Template = tmpl
+    return &dep, r.Update(ctx, &dep)
+}
+
+// evaluateChecks runs the metric checks of a against the candidate
+// Deployment. It returns a message naming the first check out of bounds, or
+// an error when a check cannot be evaluated.
+func (r *AppReconciler) evaluateChecks(ctx context.Context, a *v1beta1.App, deployment string) (string, error) {
+    checks := a.Spec.Strategy.Checks
+    if len(checks) == 0 { return "", nil }
+    if r.PrometheusURL == "" { return "", fmt.Errorf("metric checks need a Prometheus URL") }
+    vars := strings.NewReplacer("$app", a.Name, "$namespace", a.Namespace, "$deployment", deployment)
+    for _, c := range checks {
+        v, err := queryPrometheus(ctx, r.PrometheusURL, vars.Replace(c.Query))
+        if err != nil { return "", fmt.Errorf("check %s: %w", c.Name, err) }
+        if c.Min != "" {
+            min, err := strconv.ParseFloat(c.Min, 64)
+            if err != nil { return "", fmt.Errorf("check %s: min: %w", c.Name, err) }
+            if v < min { return fmt.Sprintf("check %s: %g is below %s", c.Name, v, c.Min), nil }
+        }
+        if c.Max != "" {
+            max, err := strconv.ParseFloat(c.Max, 64)
+            if err != nil { return "", fmt.Errorf("check %s: max: %w", c.Name, err) }
+            if v > max { return fmt.Sprintf("check %s: %g is above %s", c.Name, v, c.Max), nil }
+        }
+    }
+    return "", nil
+}
+
+var prometheusClient = &http.Client{Timeout: 10 * time.Second}
+
+// queryPrometheus runs an instant query and returns its scalar result or the
+// value of the first sample of a vector result.
+func queryPrometheus(ctx context.Context, base, query string) (float64, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+"/api/v1/query?query="+url.QueryEscape(query), nil)
+    if err != nil { return 0, err }
+    resp, err := prometheusClient.Do(req)
+    if err != nil { return 0, err }
+    defer resp.Body.Close()
+    var body struct {
+        Status string `json:"status"`
+        Error  string `json:"error"`
+        Data   struct {
+            ResultType string          `json:"resultType"`
+            Result     json.RawMessage `json:"result"`
+        } `json:"data"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&body); err != nil { return 0, fmt.Errorf("decode response: %w", err) }
+    if body.Status != "success" { return 0, fmt.Errorf("query failed: %s", body.Error) }
+    var sample []any
+    switch body.Data.ResultType {
+    case "scalar":
+        if err := json.Unmarshal(body.Data.Result, &sample); err != nil { return 0, err }
+    case "vector":
+        var vec []struct{ Value []any `json:"value"` }
+        if err := json.Unmarshal(body.Data.Result, &vec); err != nil { return 0, err }
+        if len(vec) == 0 { return 0, fmt.Errorf("no data") }
+        sample = vec[0].Value
+    default:
+        return 0, fmt.Errorf("unsupported result type %q", body.Data.ResultType)
+    }
+    if len(sample) != 2 { return 0, fmt.Errorf("malformed sample") }
+    v, _ := sample[1].(string)
+    return strconv.ParseFloat(v, 64)
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// deliveryFixture drives an Image App through rollouts on a fake client.
+type deliveryFixture struct {
+    t   *testing.T
+    c   client.Client
+    r   *AppReconciler
+    req reconcile.Request
+}
+
+func newDeliveryFixture(t *testing.T, spec v1beta1.AppSpec, prometheusURL string) *deliveryFixture {
+    app := &v1beta1.App{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kubeop-acme-web", Generation: 1}, Spec: spec}
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(app).
+        WithStatusSubresource(&v1beta1.App{}, &appsv1.Deployment{}, &v1beta1.DNSRecord{}, &v1beta1.Certificate{}).Build()
+    return &deliveryFixture{t: t, c: c, r: &AppReconciler{Client: c, PrometheusURL: prometheusURL}, req: reconcile.Request{NamespacedName: client.ObjectKeyFromObject(app)}}
+}
+
+func (f *deliveryFixture) reconcile() (*v1beta1.App, reconcile.Result) {
+    f.t.Helper()
+    res, err := f.r.Reconcile(context.Background(), f.req)
+    if err != nil { f.t.Fatal(err) }
+    return f.app(), res
+}
+
+func (f *deliveryFixture) app() *v1beta1.App {
+    f.t.Helper()
+    var a v1beta1.App
+    if err := f.c.Get(context.Background(), f.req.NamespacedName, &a); err != nil { f.t.Fatal(err) }
+    return &a
+}
+
+func (f *deliveryFixture) update(mut func(a *v1beta1.App)) {
+    f.t.Helper()
+    a := f.app()
+    mut(a)
+    if err := f.c.Update(context.Background(), a); err != nil { f.t.Fatal(err) }
+}
+
+func (f *deliveryFixture) deployment(name string) (*appsv1.Deployment, error) {
+    var d appsv1.Deployment
+    err := f.c.Get(context.Background(), client.ObjectKey{Namespace: f.req.Namespace, Name: name}, &d)
+    return &d, err
+}
+
+// markReady reports the rollout of the named Deployment as complete.
+func (f *deliveryFixture) markReady(name string) {
+    f.t.Helper()
+    d, err := f.deployment(name)
+    if err != nil { f.t.Fatal(err) }
+    d.Status = appsv1.DeploymentStatus{ObservedGeneration: d.Generation, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+    if err := f.c.Status().Update(context.Background(), d); err != nil { f.t.Fatal(err) }
+}
+
+func (f *deliveryFixture) image(name string) string {
+    f.t.Helper()
+    d, err := f.deployment(name)
+    if err != nil { f.t.Fatal(err) }
+    return d.Spec.Template.Spec.Containers[0].Image
+}
+
+// expireStep backdates the current rollout step.
+func (f *deliveryFixture) expireStep() {
+    f.t.Helper()
+    a := f.app()
+    a.Status.Rollout.StepStarted = metav1.NewTime(time.Now().Add(-time.Hour))
+    if err := f.c.Status().Update(context.Background(), a); err != nil { f.t.Fatal(err) }
+}
+
+func Test_CanaryRollout(t *testing.T) {
+    ctx := context.Background()
+    f := newDeliveryFixture(t, v1beta1.AppSpec{Type: "Image", Image: "nginx:1.25", Host: "web.example.com", Strategy: &v1beta1.DeliveryStrategy{Type: StrategyCanary, Steps: []int32{20}}}, "")
+    // the first revision is deployed directly
+    if a, _ := f.reconcile(); a.Status.Rollout != nil { t.Fatalf("unexpected rollout %+v", a.Status.Rollout) }
+    f.markReady("app-web")
+
+    f.update(func(a *v1beta1.App) { a.Spec.Image = "nginx:1.27" })
+    a, _ := f.reconcile()
+    st := a.Status.Rollout
+    if st == nil || st.Phase != rolloutProgressing || st.Weight != 0 || st.StableRevision != computeImageRev("nginx:1.25") { t.Fatalf("unexpected rollout %+v", st) }
+    if f.image("app-web") != "nginx:1.25" || f.image("app-web-canary") != "nginx:1.27" { t.Fatalf("candidate not deployed next to the stable revision") }
+    if a.Status.Revision != computeImageRev("nginx:1.25") || len(a.Status.History) != 1 { t.Fatalf("unexpected revision %s, history %+v", a.Status.Revision, a.Status.History) }
+    var svc corev1.Service
+    if err := f.c.Get(ctx, client.ObjectKey{Namespace: a.Namespace, Name: "app-web-canary"}, &svc); err != nil || svc.Spec.Selector[candidateLabel] != "web" { t.Fatalf("unexpected candidate service %+v: %v", svc.Spec, err) }
+
+    f.markReady("app-web-canary")
+    a, res := f.reconcile()
+    if st = a.Status.Rollout; st.Weight != 20 || res.RequeueAfter <= 0 { t.Fatalf("unexpected rollout %+v, result %+v", st, res) }
+    var ing networkingv1.Ingress
+    if err := f.c.Get(ctx, client.ObjectKey{Namespace: a.Namespace, Name: "app-web-canary"}, &ing); err != nil { t.Fatal(err) }
+    if ing.Annotations["nginx.ingress.kubernetes.io/canary-weight"] != "20" || ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name != "app-web-canary" { t.Fatalf("unexpected canary ingress %+v", ing) }
+    if cond := findCondition(a.Status.Conditions, "Rollout"); cond == nil || cond.Status != "False" || cond.Reason != rolloutProgressing { t.Fatalf("unexpected condition %+v", cond) }
+
+    // the last step passed: all traffic moves to the candidate while the
+    // stable Deployment is updated
+    f.expireStep()
+    a, _ = f.reconcile()
+    if st = a.Status.Rollout; st.Phase != rolloutPromoting || st.Weight != 100 { t.Fatalf("unexpected rollout %+v", st) }
+    if f.image("app-web") != "nginx:1.27" { t.Fatalf("stable deployment not promoted") }
+
+    f.markReady("app-web")
+    a, _ = f.reconcile()
+    if st = a.Status.Rollout; st.Phase != rolloutSucceeded || st.Weight != 0 { t.Fatalf("unexpected rollout %+v", st) }
+    if cond := findCondition(a.Status.Conditions, "Rollout"); cond == nil || cond.Status != "True" { t.Fatalf("unexpected condition %+v", cond) }
+    if _, err := f.deployment("app-web-canary"); !apierrors.IsNotFound(err) { t.Fatalf("expected candidate removed: %v", err) }
+    if err := f.c.Get(ctx, client.ObjectKey{Namespace: a.Namespace, Name: "app-web-canary"}, &ing); !apierrors.IsNotFound(err) { t.Fatalf("expected canary ingress removed: %v", err) }
+    if a.Status.Revision != computeImageRev("nginx:1.27") || len(a.Status.History) != 2 { t.Fatalf("unexpected revision %s, history %+v", a.Status.Revision, a.Status.History) }
+}
+
+func Test_BlueGreenRollout(t *testing.T) {
+    errorRate := "0.01"
+    prom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if q := r.URL.Query().Get("query"); q != `rate(errors{deployment="app-web-canary"}[1m])` { t.Errorf("unexpected query %q", q) }
+        fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"%s"]}]}}`, errorRate)
+    }))
+    defer prom.Close()
+    f := newDeliveryFixture(t, v1beta1.AppSpec{Type: "Image", Image: "nginx:1.25", Strategy: &v1beta1.DeliveryStrategy{
+        Type:   StrategyBlueGreen,
+        Checks: []v1beta1.MetricCheck{{Name: "errors", Query: `rate(errors{deployment="$deployment"}[1m])`, Max: "0.05"}},
+    }}, prom.URL)
+    f.reconcile()
+    f.markReady("app-web")
+
+    f.update(func(a *v1beta1.App) { a.Spec.Image = "nginx:1.27" })
+    f.reconcile()
+    f.markReady("app-web-canary")
+    a, _ := f.reconcile()
+    if st := a.Status.Rollout; st.Phase != rolloutPaused || st.Weight != 0 { t.Fatalf("unexpected rollout %+v", st) }
+    // without a promotion the candidate waits however long it is healthy
+    f.expireStep()
+    if a, _ = f.reconcile(); a.Status.Rollout.Phase != rolloutPaused || f.image("app-web") != "nginx:1.25" { t.Fatalf("promoted without approval: %+v", a.Status.Rollout) }
+
+    f.update(func(a *v1beta1.App) { a.Spec.Strategy.Promote = a.Status.Rollout.Revision })
+    if a, _ = f.reconcile(); a.Status.Rollout.Phase != rolloutPromoting || f.image("app-web") != "nginx:1.27" { t.Fatalf("not promoted: %+v", a.Status.Rollout) }
+    f.markReady("app-web")
+    if a, _ = f.reconcile(); a.Status.Rollout.Phase != rolloutSucceeded { t.Fatalf("unexpected rollout %+v", a.Status.Rollout) }
+
+    // a failing check aborts the next rollout and keeps the stable revision
+    errorRate = "0.2"
+    f.update(func(a *v1beta1.App) { a.Spec.Image = "nginx:1.28" })
+    f.reconcile()
+    f.markReady("app-web-canary")
+    a, _ = f.reconcile()
+    if st := a.Status.Rollout; st.Phase != rolloutAborted || st.Revision != computeImageRev("nginx:1.28") { t.Fatalf("unexpected rollout %+v", st) }
+    if cond := findCondition(a.Status.Conditions, "Rollout"); cond == nil || cond.Reason != rolloutAborted || cond.Message != "Revision "+computeImageRev("nginx:1.28")+" aborted: check errors: 0.2 is above 0.05" { t.Fatalf("unexpected condition %+v", cond) }
+    if _, err := f.deployment("app-web-canary"); !apierrors.IsNotFound(err) { t.Fatalf("expected candidate removed: %v", err) }
+    if a, _ = f.reconcile(); f.image("app-web") != "nginx:1.27" || a.Status.Revision != computeImageRev("nginx:1.27") || !a.Status.Ready { t.Fatalf("stable revision not kept: %+v", a.Status) }
+}
+
+func Test_CandidateDropsStableClaims(t *testing.T) {
+    f := newDeliveryFixture(t, v1beta1.AppSpec{Type: "Image", Image: "nginx:1.25", Workload: v1beta1.Workload{Volumes: []v1beta1.Volume{{Name: "data", MountPath: "/data", Size: resource.MustParse("1Gi")}}}}, "")
+    f.reconcile()
+    f.markReady("app-web")
+    if d, _ := f.deployment("app-web"); len(d.Spec.Template.Spec.Volumes) != 1 { t.Fatalf("expected the claim mounted into the stable pods, got %+v", d.Spec.Template.Spec.Volumes) }
+
+    // dropping the volumes for canary delivery must not leave the claim on
+    // the candidate, which could not attach it next to the stable pods
+    f.update(func(a *v1beta1.App) {
+        a.Spec.Volumes = nil
+        a.Spec.Image = "nginx:1.27"
+        a.Spec.Strategy = &v1beta1.DeliveryStrategy{Type: StrategyCanary, Steps: []int32{20}}
+    })
+    f.reconcile()
+    d, err := f.deployment("app-web-canary")
+    if err != nil { t.Fatal(err) }
+    if len(d.Spec.Template.Spec.Volumes) != 0 { t.Fatalf("unexpected candidate volumes %+v", d.Spec.Template.Spec.Volumes) }
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/client-go/tools/record"
+
+    ctrl "sigs.k8s.io/controller-runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+    "sigs.k8s.io/controller-runtime/pkg/log"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+    "github.com/vaheed/kubeop/internal/operator/dnsprovider"
+)
+
+// dnsFinalizer keeps a DNSRecord around until its record is removed from the
+// provider.
+const dnsFinalizer = "paas.kubeop.io/dns-record"
+
+// hostConflictInterval is how often a DNSRecord that yields its host to
+// another one checks whether the host has become free.
+const hostConflictInterval = 30 * time.Second
+
+// DNSRecord reconciler: publish records through a DNS provider.
+type DNSRecordReconciler struct{
+    client.Client
+    Provider dnsprovider.Provider
+    Recorder record.EventRecorder
+}
+
+func (r *DNSRecordReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+    lg := log.FromContext(ctx)
+    var d v1beta1.DNSRecord
+    if err := r.Get(ctx, req.NamespacedName, &d); err != nil {
+        return ctrl.Result{}, client.IgnoreNotFound(err)
+    }
+    if !d.DeletionTimestamp.IsZero() {
+        if !controllerutil.ContainsFinalizer(&d, dnsFinalizer) { return ctrl.Result{}, nil }
+        if d.Status.Host != "" {
+            if err := r.deleteRecord(ctx, &d); err != nil {
+                return ctrl.Result{}, r.providerFailed(ctx, &d, "DeleteFailed", err)
+            }
+        }
+        controllerutil.RemoveFinalizer(&d, dnsFinalizer)
+        return ctrl.Result{}, r.Update(ctx, &d)
+    }
+    if controllerutil.AddFinalizer(&d, dnsFinalizer) {
+        if err := r.Update(ctx, &d); err != nil { return ctrl.Result{}, err }
+    }
+    // a renamed host leaves the old record behind unless it is removed first
+    if d.Status.Host != "" && d.Status.Host != d.Spec.Host {
+        if err := r.deleteRecord(ctx, &d); err != nil {
+            return ctrl.Result{}, r.providerFailed(ctx, &d, "DeleteFailed", err)
+        }
+        d.Status.Host, d.Status.Target, d.Status.Type = "", "", ""
+    }
+    // providers replace every record of a host, so only one DNSRecord may
+    // publish it
+    others, err := r.claimants(ctx, &d, d.Spec.Host)
+    if err != nil { return ctrl.Result{}, err }
+    for i := range others {
+        if !strings.EqualFold(others[i].Spec.Host, d.Spec.Host) || !claimsBefore(&others[i], &d) { continue }
+        msg := fmt.Sprintf("host %s is claimed by DNSRecord %s/%s", d.Spec.Host, others[i].Namespace, others[i].Name)
+        if d.Status.Message != msg { recordEvent(r.Recorder, &d, corev1.EventTypeWarning, "HostConflict", msg) }
+        // the record belongs to the other DNSRecord now and is left alone
+        // when this one is deleted
+        d.Status.Host, d.Status.Target, d.Status.Type = "", "", ""
+        d.Status.Ready = false
+        d.Status.Message = msg
+        setCondition(&d.Status.Conditions, "Ready", "False", "HostConflict", msg)
+        if err := r.Status().Update(ctx, &d); err != nil { return ctrl.Result{}, err }
+        return ctrl.Result{RequeueAfter: hostConflictInterval}, nil
+    }
+    if err := r.Provider.Upsert(ctx, d.Spec.Host, d.Spec.Target); err != nil {
+        return ctrl.Result{}, r.providerFailed(ctx, &d, "UpsertFailed", err)
+    }
+    d.Status.Host, d.Status.Target, d.Status.Type = d.Spec.Host, d.Spec.Target, dnsprovider.RecordType(d.Spec.Target)
+    msg := fmt.Sprintf("%s %s -> %s published", d.Status.Type, d.Status.Host, d.Status.Target)
+    if !d.Status.Ready || d.Status.Message != msg { recordEvent(r.Recorder, &d, corev1.EventTypeNormal, "Published", msg) }
+    d.Status.Ready = true
+    d.Status.Message = msg
+    setCondition(&d.Status.Conditions, "Ready", "True", "Published", d.Status.Message)
+    if err := r.Status().Update(ctx, &d); err != nil {
+        lg.Error(err, "update dnsrecord status")
+        return ctrl.Result{}, err
+    }
+    return ctrl.Result{}, nil
+}
+func (r *DNSRecordReconciler) SetupWithManager(mgr ctrl.Manager) error {
+    return ctrl.NewControllerManagedBy(mgr).
+        For(&v1beta1.DNSRecord{}).
+        Complete(instrument("DNSRecord", mgr.GetClient(), r))
+}
+
+// claimants returns the other DNSRecords, not being deleted, that ask for or
+// have published host.
+func (r *DNSRecordReconciler) claimants(ctx context.Context, d *v1beta1.DNSRecord, host string) ([]v1beta1.DNSRecord, error) {
+    var list v1beta1.DNSRecordList
+    if err := r.List(ctx, &list); err != nil { return nil, err }
+    var out []v1beta1.DNSRecord
+    for _, o := range list.Items {
+        if (o.Namespace == d.Namespace && o.Name == d.Name) || !o.DeletionTimestamp.IsZero() { continue }
+        if strings.EqualFold(o.Spec.Host, host) || strings.EqualFold(o.Status.Host, host) { out = append(out, o) }
+    }
+    return out, nil
+}
+
+// claimsBefore orders DNSRecords asking for the same host: the one that has
+// published it wins, then the oldest, then the first by namespace and name.
+func claimsBefore(a, b *v1beta1.DNSRecord) bool {
+    ap, bp := strings.EqualFold(a.Status.Host, a.Spec.Host), strings.EqualFold(b.Status.Host, b.Spec.Host)
+    if ap != bp { return ap }
+    if !a.CreationTimestamp.Equal(&b.CreationTimestamp) { return a.CreationTimestamp.Before(&b.CreationTimestamp) }
+    return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
+}
+
+// deleteRecord removes the record d has published unless another DNSRecord
+// claims the host, whose record it would remove too.
+func (r *DNSRecordReconciler) deleteRecord(ctx context.Context, d *v1beta1.DNSRecord) error {
+    others, err := r.claimants(ctx, d, d.Status.Host)
+    if err != nil { return err }
+    if len(others) > 0 { return nil }
+    return r.Provider.Delete(ctx, d.Status.Host, d.Status.Target)
+}
+
+// providerFailed records a provider error in the status and returns it so the
+// request is retried with backoff.
+func (r *DNSRecordReconciler) providerFailed(ctx context.Context, d *v1beta1.DNSRecord, reason string, err error) error {
+    recordEvent(r.Recorder, d, corev1.EventTypeWarning, reason, err.Error())
+    d.Status.Ready = false
+    d.Status.Message = err.Error()
+    setCondition(&d.Status.Conditions, "Ready", "False", reason, err.Error())
+    if uerr := r.Status().Update(ctx, d); uerr != nil { log.FromContext(ctx).Error(uerr, "update dnsrecord status") }
+    return err
+}
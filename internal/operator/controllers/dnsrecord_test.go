@@ -0,0 +1,111 @@
+package controllers
+
+import (
+    "context"
+    "errors"
+    "testing"
+
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// fakeDNS records published hosts and fails while err is set.
+type fakeDNS struct {
+    records map[string]string
+    err     error
+}
+
+func (f *fakeDNS) Upsert(_ context.Context, host, target string) error {
+    if f.err != nil { return f.err }
+    f.records[host] = target
+    return nil
+}
+
+func (f *fakeDNS) Delete(_ context.Context, host, _ string) error {
+    if f.err != nil { return f.err }
+    delete(f.records, host)
+    return nil
+}
+
+func Test_DNSRecordLifecycle(t *testing.T) {
+    ctx := context.Background()
+    d := &v1beta1.DNSRecord{
+        ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kubeop-acme-web"},
+        Spec:       v1beta1.DNSRecordSpec{Host: "web.example.com", Target: "203.0.113.7"},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(d).WithStatusSubresource(&v1beta1.DNSRecord{}).Build()
+    prov := &fakeDNS{records: map[string]string{}, err: errors.New("REFUSED")}
+    r := &DNSRecordReconciler{Client: c, Provider: prov}
+    req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(d)}
+    get := func() *v1beta1.DNSRecord {
+        var cur v1beta1.DNSRecord
+        if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+        return &cur
+    }
+
+    // provider errors are reported, not hidden
+    if _, err := r.Reconcile(ctx, req); err == nil { t.Fatalf("expected the provider error to be returned") }
+    if cur := get(); cur.Status.Ready || cur.Status.Message != "REFUSED" { t.Fatalf("unexpected status %+v", cur.Status) }
+
+    prov.err = nil
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if cur := get(); !cur.Status.Ready || cur.Status.Type != "A" || prov.records["web.example.com"] != "203.0.113.7" {
+        t.Fatalf("record not published: %+v %v", cur.Status, prov.records)
+    }
+
+    // renaming the host removes the old record
+    cur := get()
+    cur.Spec.Host = "www.example.com"
+    if err := c.Update(ctx, cur); err != nil { t.Fatal(err) }
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if _, ok := prov.records["web.example.com"]; ok || prov.records["www.example.com"] == "" { t.Fatalf("unexpected records %v", prov.records) }
+
+    // deletion goes through the finalizer
+    if err := c.Delete(ctx, get()); err != nil { t.Fatal(err) }
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if len(prov.records) != 0 { t.Fatalf("record left behind: %v", prov.records) }
+    if err := c.Get(ctx, req.NamespacedName, &v1beta1.DNSRecord{}); !apierrors.IsNotFound(err) { t.Fatalf("expected dnsrecord released: %v", err) }
+}
+
+func Test_DNSRecordHostConflict(t *testing.T) {
+    ctx := context.Background()
+    older := &v1beta1.DNSRecord{
+        ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kubeop-acme-web", CreationTimestamp: metav1.Unix(100, 0)},
+        Spec:       v1beta1.DNSRecordSpec{Host: "web.example.com", Target: "203.0.113.7"},
+    }
+    newer := &v1beta1.DNSRecord{
+        ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kubeop-evil-web", CreationTimestamp: metav1.Unix(200, 0)},
+        Spec:       v1beta1.DNSRecordSpec{Host: "WEB.example.com", Target: "198.51.100.9"},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(older, newer).WithStatusSubresource(&v1beta1.DNSRecord{}).Build()
+    prov := &fakeDNS{records: map[string]string{}}
+    r := &DNSRecordReconciler{Client: c, Provider: prov}
+    reconcileAndGet := func(d *v1beta1.DNSRecord) (reconcile.Result, *v1beta1.DNSRecord) {
+        req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(d)}
+        res, err := r.Reconcile(ctx, req)
+        if err != nil { t.Fatal(err) }
+        var cur v1beta1.DNSRecord
+        if err := c.Get(ctx, req.NamespacedName, &cur); err != nil && !apierrors.IsNotFound(err) { t.Fatal(err) }
+        return res, &cur
+    }
+
+    // the newer record yields even when it is reconciled first
+    res, cur := reconcileAndGet(newer)
+    if cur.Status.Ready || cur.Status.Host != "" || res.RequeueAfter == 0 || len(prov.records) != 0 {
+        t.Fatalf("newer record published: %+v %v", cur.Status, prov.records)
+    }
+    if _, cur = reconcileAndGet(older); !cur.Status.Ready || prov.records["web.example.com"] != "203.0.113.7" {
+        t.Fatalf("older record not published: %+v %v", cur.Status, prov.records)
+    }
+    if _, cur = reconcileAndGet(newer); cur.Status.Ready { t.Fatalf("newer record took over a published host") }
+
+    // deleting the yielding record leaves the published one alone
+    if err := c.Delete(ctx, cur); err != nil { t.Fatal(err) }
+    reconcileAndGet(newer)
+    if prov.records["web.example.com"] != "203.0.113.7" { t.Fatalf("record of the owner removed: %v", prov.records) }
+}
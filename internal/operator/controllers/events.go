@@ -0,0 +1,25 @@
+package controllers
+
+import (
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/tools/record"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// recordEvent records an Event on obj, so its outcome shows up in kubectl
+// describe. Reconcilers built without a recorder, as in tests, record none.
+func recordEvent(rec record.EventRecorder, obj runtime.Object, eventtype, reason, msg string) {
+    if rec == nil { return }
+    rec.Event(obj, eventtype, reason, msg)
+}
+
+// conditionChanged reports whether setting condition t to status and reason
+// is a transition. Events are recorded on transitions only, as reconciles
+// repeat the same outcome.
+func conditionChanged(conds []v1beta1.Condition, t, status, reason string) bool {
+    for _, c := range conds {
+        if c.Type == t { return c.Status != status || c.Reason != reason }
+    }
+    return true
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+    "context"
+    "errors"
+    "testing"
+
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/tools/record"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// drainEvents returns the Events recorded since the last call.
+func drainEvents(rec *record.FakeRecorder) []string {
+    var out []string
+    for {
+        select {
+        case e := <-rec.Events:
+            out = append(out, e)
+        default:
+            return out
+        }
+    }
+}
+
+func Test_ReconcilerEvents(t *testing.T) {
+    ctx := context.Background()
+    p := &v1beta1.Project{
+        ObjectMeta: metav1.ObjectMeta{Name: "acme-web"},
+        Spec:       v1beta1.ProjectSpec{TenantRef: "acme", Name: "web"},
+    }
+    d := &v1beta1.DNSRecord{
+        ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kubeop-acme-web"},
+        Spec:       v1beta1.DNSRecordSpec{Host: "web.example.com", Target: "203.0.113.7"},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(p, d).WithStatusSubresource(&v1beta1.Project{}, &v1beta1.DNSRecord{}).Build()
+    rec := record.NewFakeRecorder(20)
+
+    // bootstrapping a project reports the namespace and quota once
+    pr := &ProjectReconciler{Client: c, Recorder: rec}
+    preq := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(p)}
+    if _, err := pr.Reconcile(ctx, preq); err != nil { t.Fatal(err) }
+    if ev := drainEvents(rec); len(ev) != 2 || ev[0] != "Normal NamespaceCreated Created namespace kubeop-acme-web" || ev[1] != "Normal QuotaApplied Applied project quota to namespace kubeop-acme-web" { t.Fatalf("unexpected events %q", ev) }
+    if _, err := pr.Reconcile(ctx, preq); err != nil { t.Fatal(err) }
+    if ev := drainEvents(rec); len(ev) != 0 { t.Fatalf("unexpected events for an unchanged project %q", ev) }
+
+    // provider failures are warnings; a published record is reported once
+    prov := &fakeDNS{records: map[string]string{}, err: errors.New("REFUSED")}
+    dr := &DNSRecordReconciler{Client: c, Provider: prov, Recorder: rec}
+    dreq := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(d)}
+    if _, err := dr.Reconcile(ctx, dreq); err == nil { t.Fatalf("expected the provider error") }
+    if ev := drainEvents(rec); len(ev) != 1 || ev[0] != "Warning UpsertFailed REFUSED" { t.Fatalf("unexpected events %q", ev) }
+    prov.err = nil
+    if _, err := dr.Reconcile(ctx, dreq); err != nil { t.Fatal(err) }
+    if _, err := dr.Reconcile(ctx, dreq); err != nil { t.Fatal(err) }
+    if ev := drainEvents(rec); len(ev) != 1 || ev[0] != "Normal Published A web.example.com -> 203.0.113.7 published" { t.Fatalf("unexpected events %q", ev) }
+}
@@ -0,0 +1,331 @@
+package controllers
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    "k8s.io/apimachinery/pkg/api/equality"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/api/meta"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/apimachinery/pkg/util/intstr"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// Routing modes for ExposeConfig.Mode.
+const (
+    RoutingIngress   = "ingress"
+    RoutingHTTPRoute = "httproute"
+)
+
+// ExposeConfig controls how Apps with a host are exposed.
+type ExposeConfig struct {
+    // Mode is RoutingIngress (the default) or RoutingHTTPRoute.
+    Mode string
+    // IngressClass is set as spec.ingressClassName on Ingresses when non-empty.
+    IngressClass string
+    // Gateway is the "[namespace/]name" of the Gateway HTTPRoutes attach to.
+    Gateway string
+    // Address, when set, is the DNS target for App hosts instead of the
+    // address published in the Ingress or Gateway status.
+    Address string
+}
+
+// appPort is the port of the App Service, and the container port of Apps
+// that set no ports.
+const appPort = 80
+
+// reconcileExposure gives Image Apps with a host a ClusterIP Service, an
+// Ingress or HTTPRoute, a DNSRecord for the route's address and a
+// Certificate, and removes them once the host is cleared. It returns a
+// non-empty message while the DNSRecord or Certificate is not ready yet.
+func (r *AppReconciler) reconcileExposure(ctx context.Context, a *v1beta1.App) (string, error) {
+    name := "app-" + a.Name
+    if a.Spec.Type != "Image" || a.Spec.Host == "" {
+        a.Status.URL = ""
+        for _, obj := range []client.Object{&corev1.Service{}, &networkingv1.Ingress{}, httpRoute(), &v1beta1.DNSRecord{}, &v1beta1.Certificate{}} {
+            if err := r.deleteOwned(ctx, a, obj, name); err != nil { return "", err }
+        }
+        return "", r.deleteOwned(ctx, a, &networkingv1.Ingress{}, candidateName(a))
+    }
+    if err := r.ensureService(ctx, a, name, map[string]string{"app.kubeop.io/app": a.Name}); err != nil { return "", fmt.Errorf("service: %w", err) }
+    cert, err := r.ensureCertificate(ctx, a, name)
+    if err != nil { return "", fmt.Errorf("certificate: %w", err) }
+    // the TLS Secret is only referenced once it holds an issued certificate
+    tlsSecret := ""
+    if cert.Status.Ready { tlsSecret = cert.Status.SecretName }
+
+    var address string
+    switch r.Expose.Mode {
+    case RoutingHTTPRoute:
+        if err := r.ensureHTTPRoute(ctx, a, name); err != nil { return "", fmt.Errorf("httproute: %w", err) }
+        if err := r.deleteOwned(ctx, a, &networkingv1.Ingress{}, name); err != nil { return "", err }
+        if err := r.deleteOwned(ctx, a, &networkingv1.Ingress{}, candidateName(a)); err != nil { return "", err }
+        if address, err = r.gatewayAddress(ctx, a); err != nil { return "", err }
+    case RoutingIngress, "":
+        ing, err := r.ensureIngress(ctx, a, name, tlsSecret)
+        if err != nil { return "", fmt.Errorf("ingress: %w", err) }
+        if err := r.ensureCandidateIngress(ctx, a, tlsSecret); err != nil { return "", fmt.Errorf("candidate ingress: %w", err) }
+        if err := r.deleteOwned(ctx, a, httpRoute(), name); err != nil { return "", err }
+        address = ingressAddress(ing)
+    default:
+        return "", fmt.Errorf("unknown routing mode %q", r.Expose.Mode)
+    }
+    if r.Expose.Address != "" { address = r.Expose.Address }
+    a.Status.URL = "http://" + a.Spec.Host
+    if tlsSecret != "" && r.Expose.Mode != RoutingHTTPRoute { a.Status.URL = "https://" + a.Spec.Host }
+
+    if address == "" { return "Waiting for an address for " + a.Spec.Host, nil }
+    rec, err := r.ensureDNSRecord(ctx, a, name, address)
+    if err != nil { return "", fmt.Errorf("dnsrecord: %w", err) }
+    switch {
+    case !rec.Status.Ready:
+        return "Waiting for DNSRecord " + name, nil
+    case !cert.Status.Ready:
+        return "Waiting for Certificate " + name, nil
+    }
+    return "", nil
+}
+
+func (r *AppReconciler) ensureService(ctx context.Context, a *v1beta1.App, name string, selector map[string]string) error {
+    spec := corev1.ServiceSpec{
+        Type:     corev1.ServiceTypeClusterIP,
+        Selector: selector,
+        Ports:    []corev1.ServicePort{{Name: "http", Port: appPort, TargetPort: intstr.FromInt32(targetPort(a)), Protocol: corev1.ProtocolTCP}},
+    }
+    var svc corev1.Service
+    err := r.Get(ctx, types.NamespacedName{Namespace: a.Namespace, Name: name}, &svc)
+    if apierrors.IsNotFound(err) {
+        svc = corev1.Service{ObjectMeta: appObjectMeta(a, name), Spec: spec}
+        if err := controllerutil.SetControllerReference(a, &svc, r.Scheme()); err != nil { return err }
+        return r.Create(ctx, &svc)
+    }
+    if err != nil { return err }
+    // clusterIP and friends are defaulted by the API server, so only the
+    // fields set here are compared
+    if svc.Spec.Type == spec.Type && equality.Semantic.DeepEqual(svc.Spec.Selector, spec.Selector) && equality.Semantic.DeepEqual(svc.Spec.Ports, spec.Ports) {
+        return nil
+    }
+    svc.Spec.Type, svc.Spec.Selector, svc.Spec.Ports = spec.Type, spec.Selector, spec.Ports
+    return r.Update(ctx, &svc)
+}
+
+func (r *AppReconciler) ensureIngress(ctx context.Context, a *v1beta1.App, name, tlsSecret string) (*networkingv1.Ingress, error) {
+    spec := r.ingressSpec(a, name, tlsSecret)
+    var ing networkingv1.Ingress
+    err := r.Get(ctx, types.NamespacedName{Namespace: a.Namespace, Name: name}, &ing)
+    if apierrors.IsNotFound(err) {
+        ing = networkingv1.Ingress{ObjectMeta: appObjectMeta(a, name), Spec: spec}
+        if err := controllerutil.SetControllerReference(a, &ing, r.Scheme()); err != nil { return nil, err }
+        return &ing, r.Create(ctx, &ing)
+    }
+    if err != nil { return nil, err }
+    if equality.Semantic.DeepEqual(ing.Spec, spec) { return &ing, nil }
+    ing.Spec = spec
+    return &ing, r.Update(ctx, &ing)
+}
+
+// ensureCandidateIngress routes the candidate weight of a rollout to the
+// candidate Service through an ingress-nginx canary Ingress for the same
+// host, and removes it while the candidate gets no traffic.
+func (r *AppReconciler) ensureCandidateIngress(ctx context.Context, a *v1beta1.App, tlsSecret string) error {
+    name := candidateName(a)
+    weight := candidateWeight(a)
+    if weight == 0 { return r.deleteOwned(ctx, a, &networkingv1.Ingress{}, name) }
+    spec := r.ingressSpec(a, name, tlsSecret)
+    annotations := map[string]string{
+        "nginx.ingress.kubernetes.io/canary":        "true",
+        "nginx.ingress.kubernetes.io/canary-weight": fmt.Sprint(weight),
+    }
+    var ing networkingv1.Ingress
+    err := r.Get(ctx, types.NamespacedName{Namespace: a.Namespace, Name: name}, &ing)
+    if apierrors.IsNotFound(err) {
+        ing = networkingv1.Ingress{ObjectMeta: appObjectMeta(a, name), Spec: spec}
+        ing.Annotations = annotations
+        if err := controllerutil.SetControllerReference(a, &ing, r.Scheme()); err != nil { return err }
+        return r.Create(ctx, &ing)
+    }
+    if err != nil { return err }
+    if equality.Semantic.DeepEqual(ing.Spec, spec) && equality.Semantic.DeepEqual(ing.Annotations, annotations) { return nil }
+    ing.Spec, ing.Annotations = spec, annotations
+    return r.Update(ctx, &ing)
+}
+
+// ingressSpec routes all paths of the App host to the backend Service.
+func (r *AppReconciler) ingressSpec(a *v1beta1.App, backend, tlsSecret string) networkingv1.IngressSpec {
+    pathType := networkingv1.PathTypePrefix
+    spec := networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+        Host: a.Spec.Host,
+        IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{{
+            Path:     "/",
+            PathType: &pathType,
+            Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+                Name: backend,
+                Port: networkingv1.ServiceBackendPort{Number: appPort},
+            }},
+        }}}},
+    }}}
+    if r.Expose.IngressClass != "" {
+        class := r.Expose.IngressClass
+        spec.IngressClassName = &class
+    }
+    if tlsSecret != "" {
+        spec.TLS = []networkingv1.IngressTLS{{Hosts: []string{a.Spec.Host}, SecretName: tlsSecret}}
+    }
+    return spec
+}
+
+func (r *AppReconciler) ensureCertificate(ctx context.Context, a *v1beta1.App, name string) (*v1beta1.Certificate, error) {
+    spec := v1beta1.CertificateSpec{Host: a.Spec.Host, DNSRecordRef: name, SecretName: name + "-tls"}
+    var cert v1beta1.Certificate
+    err := r.Get(ctx, types.NamespacedName{Namespace: a.Namespace, Name: name}, &cert)
+    if apierrors.IsNotFound(err) {
+        cert = v1beta1.Certificate{ObjectMeta: appObjectMeta(a, name), Spec: spec}
+        if err := controllerutil.SetControllerReference(a, &cert, r.Scheme()); err != nil { return nil, err }
+        return &cert, r.Create(ctx, &cert)
+    }
+    if err != nil { return nil, err }
+    if cert.Spec == spec { return &cert, nil }
+    cert.Spec = spec
+    return &cert, r.Update(ctx, &cert)
+}
+
+func (r *AppReconciler) ensureDNSRecord(ctx context.Context, a *v1beta1.App, name, target string) (*v1beta1.DNSRecord, error) {
+    spec := v1beta1.DNSRecordSpec{Host: a.Spec.Host, Target: target}
+    var rec v1beta1.DNSRecord
+    err := r.Get(ctx, types.NamespacedName{Namespace: a.Namespace, Name: name}, &rec)
+    if apierrors.IsNotFound(err) {
+        rec = v1beta1.DNSRecord{ObjectMeta: appObjectMeta(a, name), Spec: spec}
+        if err := controllerutil.SetControllerReference(a, &rec, r.Scheme()); err != nil { return nil, err }
+        return &rec, r.Create(ctx, &rec)
+    }
+    if err != nil { return nil, err }
+    if rec.Spec == spec { return &rec, nil }
+    rec.Spec = spec
+    return &rec, r.Update(ctx, &rec)
+}
+
+// ingressAddress returns the first address the ingress controller published.
+func ingressAddress(ing *networkingv1.Ingress) string {
+    for _, lb := range ing.Status.LoadBalancer.Ingress {
+        if lb.IP != "" { return lb.IP }
+        if lb.Hostname != "" { return lb.Hostname }
+    }
+    return ""
+}
+
+// gatewayAddress returns the first address in the status of the Gateway
+// HTTPRoutes attach to.
+func (r *AppReconciler) gatewayAddress(ctx context.Context, a *v1beta1.App) (string, error) {
+    ns, name := a.Namespace, r.Expose.Gateway
+    if gns, gw, ok := strings.Cut(r.Expose.Gateway, "/"); ok { ns, name = gns, gw }
+    gw := gateway()
+    if err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, gw); err != nil {
+        if apierrors.IsNotFound(err) { return "", nil }
+        return "", fmt.Errorf("gateway %s/%s: %w", ns, name, err)
+    }
+    addrs, _, _ := unstructured.NestedSlice(gw.Object, "status", "addresses")
+    for _, addr := range addrs {
+        if m, ok := addr.(map[string]any); ok {
+            if v, _ := m["value"].(string); v != "" { return v, nil }
+        }
+    }
+    return "", nil
+}
+
+// ensureHTTPRoute uses an unstructured object so the Gateway API module is
+// not a dependency; the CRDs only need to exist when HTTPRoutes are enabled.
+func (r *AppReconciler) ensureHTTPRoute(ctx context.Context, a *v1beta1.App, name string) error {
+    if r.Expose.Gateway == "" { return fmt.Errorf("a gateway is required for httproute routing") }
+    parent := map[string]any{"name": r.Expose.Gateway}
+    if ns, gw, ok := strings.Cut(r.Expose.Gateway, "/"); ok {
+        parent = map[string]any{"namespace": ns, "name": gw}
+    }
+    route := httpRoute()
+    route.SetName(name)
+    route.SetNamespace(a.Namespace)
+    route.SetLabels(map[string]string{"app.kubeop.io/app": a.Name})
+    backends := []any{map[string]any{"name": name, "port": int64(appPort)}}
+    // a rollout candidate gets its share through weighted backends
+    if w := candidateWeight(a); w > 0 {
+        backends = []any{
+            map[string]any{"name": name, "port": int64(appPort), "weight": int64(100 - w)},
+            map[string]any{"name": candidateName(a), "port": int64(appPort), "weight": int64(w)},
+        }
+    }
+    route.Object["spec"] = map[string]any{
+        "parentRefs": []any{parent},
+        "hostnames":  []any{a.Spec.Host},
+        "rules": []any{map[string]any{
+            "matches":     []any{map[string]any{"path": map[string]any{"type": "PathPrefix", "value": "/"}}},
+            "backendRefs": backends,
+        }},
+    }
+    if err := controllerutil.SetControllerReference(a, route, r.Scheme()); err != nil { return err }
+    return r.createOrUpdate(ctx, route)
+}
+
+// deleteOwned deletes the named object when the App controls it, unless the
+// App's own manifests applied it: Git, Helm and Raw Apps may ship objects
+// named like the ones exposure creates. A missing HTTPRoute CRD counts as
+// nothing to delete.
+func (r *AppReconciler) deleteOwned(ctx context.Context, a *v1beta1.App, obj client.Object, name string) error {
+    err := r.Get(ctx, types.NamespacedName{Namespace: a.Namespace, Name: name}, obj)
+    if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) { return nil }
+    if err != nil { return err }
+    if !metav1.IsControlledBy(obj, a) { return nil }
+    gvk, err := r.GroupVersionKindFor(obj)
+    if err != nil { return err }
+    for _, ref := range a.Status.Resources {
+        gv, _ := schema.ParseGroupVersion(ref.APIVersion)
+        if gv.Group == gvk.Group && ref.Kind == gvk.Kind && ref.Name == name { return nil }
+    }
+    return client.IgnoreNotFound(r.Delete(ctx, obj))
+}
+
+// gatewayToApps enqueues the Apps with a host whose HTTPRoutes attach to obj,
+// so they pick up the Gateway address once it is published. A Gateway named
+// without a namespace is looked up in each App's own namespace.
+func (r *AppReconciler) gatewayToApps(ctx context.Context, obj client.Object) []reconcile.Request {
+    ns, name := "", r.Expose.Gateway
+    if gns, gw, ok := strings.Cut(r.Expose.Gateway, "/"); ok { ns, name = gns, gw }
+    if obj.GetName() != name || (ns != "" && obj.GetNamespace() != ns) { return nil }
+    var opts []client.ListOption
+    if ns == "" { opts = append(opts, client.InNamespace(obj.GetNamespace())) }
+    var apps v1beta1.AppList
+    if err := r.List(ctx, &apps, opts...); err != nil { return nil }
+    var reqs []reconcile.Request
+    for _, a := range apps.Items {
+        if a.Spec.Host == "" { continue }
+        reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: a.Namespace, Name: a.Name}})
+    }
+    return reqs
+}
+
+func gateway() *unstructured.Unstructured {
+    u := &unstructured.Unstructured{}
+    u.SetAPIVersion("gateway.networking.k8s.io/v1")
+    u.SetKind("Gateway")
+    return u
+}
+
+func httpRoute() *unstructured.Unstructured {
+    u := &unstructured.Unstructured{}
+    u.SetAPIVersion("gateway.networking.k8s.io/v1")
+    u.SetKind("HTTPRoute")
+    return u
+}
+
+func appObjectMeta(a *v1beta1.App, name string) metav1.ObjectMeta {
+    return metav1.ObjectMeta{Name: name, Namespace: a.Namespace, Labels: map[string]string{"app.kubeop.io/app": a.Name}}
+}
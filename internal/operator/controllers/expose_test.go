@@ -0,0 +1,126 @@
+package controllers
+
+import (
+    "context"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_reconcileExposure(t *testing.T) {
+    ctx := context.Background()
+    a := &v1beta1.App{
+        ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kubeop-acme-web", UID: "app-uid"},
+        Spec:       v1beta1.AppSpec{Type: "Image", Image: "nginx:1.27", Host: "web.example.com"},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(a).
+        WithStatusSubresource(&v1beta1.DNSRecord{}, &v1beta1.Certificate{}).
+        Build()
+    r := &AppReconciler{Client: c, Expose: ExposeConfig{IngressClass: "nginx"}}
+    wait, err := r.reconcileExposure(ctx, a)
+    if err != nil { t.Fatal(err) }
+    if a.Status.URL != "http://web.example.com" { t.Fatalf("unexpected url %q", a.Status.URL) }
+    if wait == "" { t.Fatalf("expected to wait for the ingress address") }
+
+    key := client.ObjectKey{Namespace: a.Namespace, Name: "app-web"}
+    var svc corev1.Service
+    if err := c.Get(ctx, key, &svc); err != nil { t.Fatal(err) }
+    if svc.Spec.Selector["app.kubeop.io/app"] != "web" || svc.Spec.Ports[0].Port != 80 { t.Fatalf("unexpected service %+v", svc.Spec) }
+    var ing networkingv1.Ingress
+    if err := c.Get(ctx, key, &ing); err != nil { t.Fatal(err) }
+    if *ing.Spec.IngressClassName != "nginx" || ing.Spec.Rules[0].Host != "web.example.com" || ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name != "app-web" {
+        t.Fatalf("unexpected ingress %+v", ing.Spec)
+    }
+    if !metav1.IsControlledBy(&ing, a) { t.Fatalf("ingress is not controlled by the app") }
+
+    // once the ingress has an address the DNSRecord points at it
+    ing.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: "203.0.113.7"}}
+    if err := c.Status().Update(ctx, &ing); err != nil { t.Fatal(err) }
+    if wait, err = r.reconcileExposure(ctx, a); err != nil { t.Fatal(err) }
+    if wait != "Waiting for DNSRecord app-web" { t.Fatalf("unexpected wait message %q", wait) }
+    var rec v1beta1.DNSRecord
+    if err := c.Get(ctx, key, &rec); err != nil { t.Fatal(err) }
+    if rec.Spec.Host != "web.example.com" || rec.Spec.Target != "203.0.113.7" { t.Fatalf("unexpected dnsrecord %+v", rec.Spec) }
+
+    // both ready: the TLS Secret is wired into the ingress
+    rec.Status.Ready = true
+    if err := c.Status().Update(ctx, &rec); err != nil { t.Fatal(err) }
+    var cert v1beta1.Certificate
+    if err := c.Get(ctx, key, &cert); err != nil { t.Fatal(err) }
+    if cert.Spec.Host != "web.example.com" || cert.Spec.DNSRecordRef != "app-web" { t.Fatalf("unexpected certificate %+v", cert.Spec) }
+    cert.Status.Ready = true
+    cert.Status.SecretName = cert.Spec.SecretName
+    if err := c.Status().Update(ctx, &cert); err != nil { t.Fatal(err) }
+    if wait, err = r.reconcileExposure(ctx, a); err != nil { t.Fatal(err) }
+    if wait != "" { t.Fatalf("unexpected wait message %q", wait) }
+    if a.Status.URL != "https://web.example.com" { t.Fatalf("unexpected url %q", a.Status.URL) }
+    if err := c.Get(ctx, key, &ing); err != nil { t.Fatal(err) }
+    if len(ing.Spec.TLS) != 1 || ing.Spec.TLS[0].SecretName != "app-web-tls" { t.Fatalf("tls not wired: %+v", ing.Spec.TLS) }
+
+    // clearing the host removes every object
+    a.Spec.Host = ""
+    if _, err := r.reconcileExposure(ctx, a); err != nil { t.Fatal(err) }
+    if a.Status.URL != "" { t.Fatalf("url should be cleared, got %q", a.Status.URL) }
+    if err := c.Get(ctx, key, &corev1.Service{}); !apierrors.IsNotFound(err) { t.Fatalf("expected service removed: %v", err) }
+    if err := c.Get(ctx, key, &networkingv1.Ingress{}); !apierrors.IsNotFound(err) { t.Fatalf("expected ingress removed: %v", err) }
+    if err := c.Get(ctx, key, &v1beta1.DNSRecord{}); !apierrors.IsNotFound(err) { t.Fatalf("expected dnsrecord removed: %v", err) }
+    if err := c.Get(ctx, key, &v1beta1.Certificate{}); !apierrors.IsNotFound(err) { t.Fatalf("expected certificate removed: %v", err) }
+}
+
+func Test_reconcileExposureKeepsManifests(t *testing.T) {
+    ctx := context.Background()
+    a := &v1beta1.App{
+        ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kubeop-acme-web", UID: "app-uid"},
+        Spec:       v1beta1.AppSpec{Type: "Raw"},
+        Status:     v1beta1.AppStatus{Resources: []v1beta1.ResourceRef{{APIVersion: "v1", Kind: "Service", Name: "app-web"}}},
+    }
+    svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "app-web", Namespace: a.Namespace}}
+    ing := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app-web", Namespace: a.Namespace}}
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(a).Build()
+    r := &AppReconciler{Client: c}
+    for _, obj := range []client.Object{svc, ing} {
+        if err := controllerutil.SetControllerReference(a, obj, c.Scheme()); err != nil { t.Fatal(err) }
+        if err := c.Create(ctx, obj); err != nil { t.Fatal(err) }
+    }
+    // the Service comes from the App's manifests, the Ingress is left over
+    // from when the App was exposed
+    if _, err := r.reconcileExposure(ctx, a); err != nil { t.Fatal(err) }
+    key := client.ObjectKey{Namespace: a.Namespace, Name: "app-web"}
+    if err := c.Get(ctx, key, &corev1.Service{}); err != nil { t.Fatalf("expected the manifest service kept: %v", err) }
+    if err := c.Get(ctx, key, &networkingv1.Ingress{}); !apierrors.IsNotFound(err) { t.Fatalf("expected ingress removed: %v", err) }
+}
+
+func Test_gatewayToApps(t *testing.T) {
+    ctx := context.Background()
+    app := func(ns, name, host string) *v1beta1.App {
+        return &v1beta1.App{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns}, Spec: v1beta1.AppSpec{Type: "Image", Image: "nginx:1.27", Host: host}}
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(
+        app("kubeop-acme-web", "web", "web.example.com"),
+        app("kubeop-acme-web", "worker", ""),
+        app("kubeop-acme-api", "api", "api.example.com"),
+    ).Build()
+    gw := gateway()
+    gw.SetNamespace("gateways")
+    gw.SetName("public")
+
+    // a shared Gateway serves the Apps of every namespace
+    r := &AppReconciler{Client: c, Expose: ExposeConfig{Mode: RoutingHTTPRoute, Gateway: "gateways/public"}}
+    if reqs := r.gatewayToApps(ctx, gw); len(reqs) != 2 { t.Fatalf("unexpected requests %v", reqs) }
+    gw.SetName("internal")
+    if reqs := r.gatewayToApps(ctx, gw); len(reqs) != 0 { t.Fatalf("unexpected requests for another gateway %v", reqs) }
+
+    // a Gateway named without a namespace only serves its own namespace
+    r.Expose.Gateway = "public"
+    gw.SetNamespace("kubeop-acme-web")
+    gw.SetName("public")
+    if reqs := r.gatewayToApps(ctx, gw); len(reqs) != 1 || reqs[0].Name != "web" { t.Fatalf("unexpected requests %v", reqs) }
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+    "context"
+    "crypto/sha1"
+    "encoding/hex"
+    "fmt"
+    "strings"
+
+    appsv1 "k8s.io/api/apps/v1"
+    batchv1 "k8s.io/api/batch/v1"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/util/validation"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// Hook results recorded in AppStatus.Hooks.
+const (
+    hookRunning   = "Running"
+    hookSucceeded = "Succeeded"
+    hookFailed    = "Failed"
+)
+
+// runHooks drives the hooks of one phase for a revision. Hooks run one at a
+// time in spec order, each as its own Job owned by the App. The outcome is
+// recorded in a.Status.Hooks and as a <Phase>HooksSucceeded condition; once a
+// revision has a final outcome it is not re-run, even after the Jobs have been
+// cleaned up by their TTL.
+func (r *AppReconciler) runHooks(ctx context.Context, a *v1beta1.App, hooks []v1beta1.Hook, rev, phase string) (string, error) {
+    if st := hookStatus(a, phase); st != nil && st.Revision == rev && st.Result != hookRunning {
+        return st.Result, nil
+    }
+    result, msg := hookSucceeded, fmt.Sprintf("%d %s hook(s) succeeded", len(hooks), phase)
+    for _, job := range buildHookJobs(a, hooks, rev, phase) {
+        var cur batchv1.Job
+        err := r.Get(ctx, client.ObjectKeyFromObject(job), &cur)
+        if apierrors.IsNotFound(err) {
+            if err := controllerutil.SetControllerReference(a, job, r.Scheme()); err != nil { return "", err }
+            if err := r.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) { return "", err }
+            result, msg = hookRunning, "started job "+job.Name
+            break
+        }
+        if err != nil { return "", err }
+        outcome := jobOutcome(&cur)
+        if outcome == hookSucceeded { continue }
+        result = outcome
+        if outcome == hookFailed {
+            msg = "job " + job.Name + " failed"
+        } else {
+            msg = "waiting for job " + job.Name
+        }
+        break
+    }
+    setHookStatus(a, v1beta1.HookStatus{Phase: phase, Revision: rev, Result: result, Message: msg})
+    status := map[string]string{hookSucceeded: "True", hookFailed: "False", hookRunning: "Unknown"}[result]
+    setCondition(&a.Status.Conditions, hookCondition(phase), status, result, msg)
+    return result, nil
+}
+
+// buildHookJobs builds the Jobs for every hook of a phase. The first Job keeps
+// the buildHookJob name; later ones get an index suffix.
+func buildHookJobs(a *v1beta1.App, hooks []v1beta1.Hook, rev, phase string) []*batchv1.Job {
+    jobs := make([]*batchv1.Job, 0, len(hooks))
+    for i, hk := range hooks {
+        job := buildHookJob(a, hk, rev, phase)
+        if i > 0 {
+            job.Name = hookJobName(a, rev, phase, i)
+            job.Spec.Template.Labels["job-name"] = job.Name
+        }
+        jobs = append(jobs, job)
+    }
+    return jobs
+}
+
+// hookJobName names the Job of the i-th hook of a phase
+// hook-<phase>-<app>-<rev>[-<i>]. Git revisions are full commit SHAs, so the
+// name is shortened to fit the 63 characters of the job-name pod label.
+func hookJobName(a *v1beta1.App, rev, phase string, i int) string {
+    name := fmt.Sprintf("hook-%s-%s-%s", phase, a.Name, rev)
+    if i > 0 { name = fmt.Sprintf("%s-%d", name, i) }
+    return shortName(name, validation.DNS1123LabelMaxLength)
+}
+
+// shortName cuts name down to max characters, replacing the cut off part by
+// a hash of the whole name so distinct names stay distinct.
+func shortName(name string, max int) string {
+    if len(name) <= max { return name }
+    h := sha1.Sum([]byte(name))
+    suffix := hex.EncodeToString(h[:])[:8]
+    return strings.TrimRight(name[:max-len(suffix)-1], "-.") + "-" + suffix
+}
+
+// jobOutcome maps Job conditions to a hook result.
+func jobOutcome(j *batchv1.Job) string {
+    for _, c := range j.Status.Conditions {
+        if c.Status != corev1.ConditionTrue { continue }
+        switch c.Type {
+        case batchv1.JobComplete:
+            return hookSucceeded
+        case batchv1.JobFailed:
+            return hookFailed
+        }
+    }
+    return hookRunning
+}
+
+func hookCondition(phase string) string {
+    if phase == "pre" { return "PreHooksSucceeded" }
+    return "PostHooksSucceeded"
+}
+
+func hookStatus(a *v1beta1.App, phase string) *v1beta1.HookStatus {
+    for i := range a.Status.Hooks {
+        if a.Status.Hooks[i].Phase == phase { return &a.Status.Hooks[i] }
+    }
+    return nil
+}
+
+func setHookStatus(a *v1beta1.App, hs v1beta1.HookStatus) {
+    if cur := hookStatus(a, hs.Phase); cur != nil {
+        *cur = hs
+        return
+    }
+    a.Status.Hooks = append(a.Status.Hooks, hs)
+}
+
+// rolloutComplete reports whether every replica of the current Deployment
+// template is updated and available.
+func rolloutComplete(dep *appsv1.Deployment) bool {
+    want := int32(1)
+    if dep.Spec.Replicas != nil { want = *dep.Spec.Replicas }
+    return dep.Status.ObservedGeneration >= dep.Generation &&
+        dep.Status.UpdatedReplicas >= want &&
+        dep.Status.AvailableReplicas >= want &&
+        dep.Status.Replicas == dep.Status.UpdatedReplicas
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+    "context"
+    "testing"
+
+    appsv1 "k8s.io/api/apps/v1"
+    batchv1 "k8s.io/api/batch/v1"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func testScheme(t *testing.T) *runtime.Scheme {
+    t.Helper()
+    s := runtime.NewScheme()
+    if err := clientgoscheme.AddToScheme(s); err != nil { t.Fatal(err) }
+    if err := v1beta1.AddToScheme(s); err != nil { t.Fatal(err) }
+    return s
+}
+
+func setJobCondition(t *testing.T, c client.Client, name string, ct batchv1.JobConditionType) {
+    t.Helper()
+    var j batchv1.Job
+    if err := c.Get(context.Background(), client.ObjectKey{Namespace: "kubeop-acme-web", Name: name}, &j); err != nil { t.Fatal(err) }
+    j.Status.Conditions = append(j.Status.Conditions, batchv1.JobCondition{Type: ct, Status: corev1.ConditionTrue})
+    if err := c.Status().Update(context.Background(), &j); err != nil { t.Fatal(err) }
+}
+
+func Test_runHooks_SequentialAndSticky(t *testing.T) {
+    ctx := context.Background()
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).Build()
+    r := &AppReconciler{Client: c}
+    a := &v1beta1.App{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kubeop-acme-web", UID: "uid-1"}}
+    hooks := []v1beta1.Hook{{Image: "migrate:1"}, {Image: "seed:1"}}
+
+    res, err := r.runHooks(ctx, a, hooks, "rev1", "pre")
+    if err != nil || res != hookRunning { t.Fatalf("expected first hook to start: %s %v", res, err) }
+    var jobs batchv1.JobList
+    if err := c.List(ctx, &jobs); err != nil { t.Fatal(err) }
+    if len(jobs.Items) != 1 || jobs.Items[0].Name != "hook-pre-web-rev1" { t.Fatalf("expected only the first job, got %d", len(jobs.Items)) }
+    if len(jobs.Items[0].OwnerReferences) != 1 { t.Fatalf("hook job should be owned by the app") }
+
+    setJobCondition(t, c, "hook-pre-web-rev1", batchv1.JobComplete)
+    if res, _ = r.runHooks(ctx, a, hooks, "rev1", "pre"); res != hookRunning { t.Fatalf("expected second hook to start, got %s", res) }
+    setJobCondition(t, c, "hook-pre-web-rev1-1", batchv1.JobFailed)
+    if res, _ = r.runHooks(ctx, a, hooks, "rev1", "pre"); res != hookFailed { t.Fatalf("expected failure, got %s", res) }
+    if cond := a.Status.Conditions[0]; cond.Type != "PreHooksSucceeded" || cond.Status != "False" { t.Fatalf("unexpected condition: %+v", cond) }
+
+    // the recorded outcome sticks after the Jobs are garbage collected
+    for _, j := range []string{"hook-pre-web-rev1", "hook-pre-web-rev1-1"} {
+        if err := c.Delete(ctx, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: a.Namespace, Name: j}}); err != nil { t.Fatal(err) }
+    }
+    if res, _ = r.runHooks(ctx, a, hooks, "rev1", "pre"); res != hookFailed { t.Fatalf("expected failure to stick, got %s", res) }
+    // a new revision runs the hooks again
+    if res, _ = r.runHooks(ctx, a, hooks, "rev2", "pre"); res != hookRunning { t.Fatalf("expected new revision to run hooks, got %s", res) }
+}
+
+func Test_hookJobName(t *testing.T) {
+    a := &v1beta1.App{ObjectMeta: metav1.ObjectMeta{Name: "storefront-backend-api"}}
+    sha := "4f1c9d8e0b7a6c5d4e3f2a1b0c9d8e7f6a5b4c3d"
+    jobs := buildHookJobs(a, []v1beta1.Hook{{Image: "migrate:1"}, {Image: "seed:1"}}, sha, "post")
+    if jobs[0].Name == jobs[1].Name { t.Fatalf("hook jobs share the name %s", jobs[0].Name) }
+    for _, j := range jobs {
+        if len(j.Name) > 63 || j.Spec.Template.Labels["job-name"] != j.Name { t.Fatalf("unexpected job name %q, label %q", j.Name, j.Spec.Template.Labels["job-name"]) }
+    }
+    if jobs[0].Name != hookJobName(a, sha, "post", 0) { t.Fatalf("job names must be stable, got %s", jobs[0].Name) }
+    if got := hookJobName(&v1beta1.App{ObjectMeta: metav1.ObjectMeta{Name: "web"}}, "rev1", "pre", 1); got != "hook-pre-web-rev1-1" { t.Fatalf("short names must be kept, got %s", got) }
+}
+
+func Test_rolloutComplete(t *testing.T) {
+    two := int32(2)
+    dep := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Generation: 2}, Spec: appsv1.DeploymentSpec{Replicas: &two}}
+    dep.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 3}
+    if rolloutComplete(dep) { t.Fatalf("old replicas still present") }
+    dep.Status.Replicas = 2
+    if !rolloutComplete(dep) { t.Fatalf("expected rollout to be complete") }
+    dep.Generation = 3
+    if rolloutComplete(dep) { t.Fatalf("new generation not observed yet") }
+}
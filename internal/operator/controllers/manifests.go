@@ -0,0 +1,131 @@
+package controllers
+
+import (
+    "context"
+    "fmt"
+
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "k8s.io/apimachinery/pkg/types"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// applyManifests creates or updates rendered objects in the App's namespace.
+// Every object is labelled with the App name and controlled by the App so it
+// is garbage collected together with it. Cluster-scoped objects are rejected:
+// tenants may only deploy into their own project namespace, and neither may
+// they replace the project baseline (see deniedManifest). On success the
+// applied objects are recorded in a.Status.Resources and objects recorded by
+// the previous sync that are no longer rendered are pruned.
+func (r *AppReconciler) applyManifests(ctx context.Context, a *v1beta1.App, objs []*unstructured.Unstructured) error {
+    refs := make([]v1beta1.ResourceRef, 0, len(objs))
+    for _, obj := range objs {
+        if deniedManifest(obj.GroupVersionKind().GroupKind()) {
+            return fmt.Errorf("%s %s cannot be deployed by an App", obj.GetKind(), obj.GetName())
+        }
+        namespaced, err := r.IsObjectNamespaced(obj)
+        if err != nil { return fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err) }
+        if !namespaced {
+            return fmt.Errorf("%s %s is cluster-scoped and cannot be deployed by an App", obj.GetKind(), obj.GetName())
+        }
+        obj.SetNamespace(a.Namespace)
+        labels := obj.GetLabels()
+        if labels == nil { labels = map[string]string{} }
+        labels["app.kubeop.io/app"] = a.Name
+        obj.SetLabels(labels)
+        if err := controllerutil.SetControllerReference(a, obj, r.Scheme()); err != nil { return err }
+        if err := r.createOrUpdate(ctx, obj); err != nil {
+            return fmt.Errorf("apply %s %s: %w", obj.GetKind(), obj.GetName(), err)
+        }
+        refs = append(refs, v1beta1.ResourceRef{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(), Name: obj.GetName()})
+    }
+    if err := r.pruneResources(ctx, a, staleResources(a.Status.Resources, refs)); err != nil { return err }
+    a.Status.Resources = refs
+    return nil
+}
+
+// deniedManifest reports whether Apps may not deploy objects of kind gk. RBAC,
+// quotas, limit ranges and network policies are what the project baseline
+// uses to confine a tenant, so a tenant's own manifests may not add to them.
+func deniedManifest(gk schema.GroupKind) bool {
+    switch gk {
+    case schema.GroupKind{Kind: "ResourceQuota"}, schema.GroupKind{Kind: "LimitRange"}, schema.GroupKind{Group: "networking.k8s.io", Kind: "NetworkPolicy"}:
+        return true
+    }
+    return gk.Group == "rbac.authorization.k8s.io"
+}
+
+// staleResources returns the refs in prev that are missing from cur. Objects
+// are matched on API group, kind and name so that moving a manifest to a new
+// API version does not delete it.
+func staleResources(prev, cur []v1beta1.ResourceRef) []v1beta1.ResourceRef {
+    key := func(ref v1beta1.ResourceRef) string {
+        gv, _ := schema.ParseGroupVersion(ref.APIVersion)
+        return gv.Group + "/" + ref.Kind + "/" + ref.Name
+    }
+    keep := map[string]bool{}
+    for _, ref := range cur { keep[key(ref)] = true }
+    var out []v1beta1.ResourceRef
+    for _, ref := range prev {
+        if !keep[key(ref)] { out = append(out, ref) }
+    }
+    return out
+}
+
+// pruneResources deletes stale objects, skipping any that no longer carry the
+// App's label or are not controlled by it so objects recreated by someone else
+// are left alone.
+func (r *AppReconciler) pruneResources(ctx context.Context, a *v1beta1.App, refs []v1beta1.ResourceRef) error {
+    var owned []v1beta1.ResourceRef
+    for _, ref := range refs {
+        obj := &unstructured.Unstructured{}
+        obj.SetAPIVersion(ref.APIVersion)
+        obj.SetKind(ref.Kind)
+        err := r.Get(ctx, types.NamespacedName{Namespace: a.Namespace, Name: ref.Name}, obj)
+        if apierrors.IsNotFound(err) { continue }
+        if err != nil { return fmt.Errorf("prune %s %s: %w", ref.Kind, ref.Name, err) }
+        if obj.GetLabels()["app.kubeop.io/app"] != a.Name || !metav1.IsControlledBy(obj, a) { continue }
+        owned = append(owned, ref)
+    }
+    return r.deleteResources(ctx, a, owned)
+}
+
+// deleteResources deletes the referenced objects from the App's namespace,
+// ignoring ones that are already gone.
+func (r *AppReconciler) deleteResources(ctx context.Context, a *v1beta1.App, refs []v1beta1.ResourceRef) error {
+    for _, ref := range refs {
+        obj := &unstructured.Unstructured{}
+        obj.SetAPIVersion(ref.APIVersion)
+        obj.SetKind(ref.Kind)
+        obj.SetNamespace(a.Namespace)
+        obj.SetName(ref.Name)
+        if err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrors.IsNotFound(err) {
+            return fmt.Errorf("delete %s %s: %w", ref.Kind, ref.Name, err)
+        }
+    }
+    return nil
+}
+
+// createOrUpdate mirrors kube.applyObject: try create, then update on conflict.
+// An existing object is only updated when obj's controller already controls
+// it, so an App never takes over objects it did not create.
+func (r *AppReconciler) createOrUpdate(ctx context.Context, obj *unstructured.Unstructured) error {
+    err := r.Create(ctx, obj)
+    if apierrors.IsAlreadyExists(err) {
+        current := &unstructured.Unstructured{}
+        current.SetGroupVersionKind(obj.GroupVersionKind())
+        if getErr := r.Get(ctx, client.ObjectKeyFromObject(obj), current); getErr != nil { return getErr }
+        want, have := metav1.GetControllerOf(obj), metav1.GetControllerOf(current)
+        if want == nil || have == nil || want.UID != have.UID {
+            return fmt.Errorf("%s %s already exists and is not managed by this App", obj.GetKind(), obj.GetName())
+        }
+        obj.SetResourceVersion(current.GetResourceVersion())
+        err = r.Update(ctx, obj)
+    }
+    return err
+}
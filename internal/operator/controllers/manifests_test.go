@@ -0,0 +1,53 @@
+package controllers
+
+import (
+    "context"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    "k8s.io/apimachinery/pkg/api/meta"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_syncRaw_KeepsForeignObjects(t *testing.T) {
+    ctx := context.Background()
+    ns, controller := "kubeop-acme-web", true
+    quota := &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-quota", Namespace: ns}, Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("2")}}}
+    other := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: ns, OwnerReferences: []metav1.OwnerReference{{APIVersion: "paas.kubeop.io/v1beta1", Kind: "App", Name: "api", UID: "api-uid", Controller: &controller}}}, Data: map[string]string{"owner": "api"}}
+    mapper := meta.NewDefaultRESTMapper(nil)
+    mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithRESTMapper(mapper).WithObjects(quota, other).Build()
+    r := &AppReconciler{Client: c}
+    a := &v1beta1.App{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: ns, UID: "web-uid"}, Spec: v1beta1.AppSpec{Type: "Raw"}}
+
+    // the project quota cannot be replaced
+    a.Spec.RawManifests = "apiVersion: v1\nkind: ResourceQuota\nmetadata:\n  name: kubeop-quota\nspec:\n  hard:\n    requests.cpu: \"100\"\n"
+    if _, err := r.syncRaw(ctx, a); err == nil { t.Fatalf("expected the quota to be refused") }
+    var rq corev1.ResourceQuota
+    if err := c.Get(ctx, client.ObjectKeyFromObject(quota), &rq); err != nil { t.Fatal(err) }
+    if got := rq.Spec.Hard[corev1.ResourceRequestsCPU]; got.Cmp(resource.MustParse("2")) != 0 || len(rq.OwnerReferences) != 0 { t.Fatalf("quota was changed: %+v", rq) }
+
+    // neither can RBAC objects be deployed
+    a.Spec.RawManifests = "apiVersion: rbac.authorization.k8s.io/v1\nkind: RoleBinding\nmetadata:\n  name: admin\nroleRef:\n  apiGroup: rbac.authorization.k8s.io\n  kind: ClusterRole\n  name: admin\n"
+    if _, err := r.syncRaw(ctx, a); err == nil { t.Fatalf("expected the rolebinding to be refused") }
+
+    // another App's object is left alone
+    a.Spec.RawManifests = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: api\ndata:\n  owner: web\n"
+    if _, err := r.syncRaw(ctx, a); err == nil { t.Fatalf("expected the configmap to be refused") }
+    var cm corev1.ConfigMap
+    if err := c.Get(ctx, client.ObjectKeyFromObject(other), &cm); err != nil { t.Fatal(err) }
+    if cm.Data["owner"] != "api" || cm.OwnerReferences[0].UID != "api-uid" { t.Fatalf("configmap was taken over: %+v", cm) }
+
+    // objects the App created itself are updated
+    a.Spec.RawManifests = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  v: \"1\"\n"
+    if _, err := r.syncRaw(ctx, a); err != nil { t.Fatal(err) }
+    a.Spec.RawManifests = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  v: \"2\"\n"
+    if _, err := r.syncRaw(ctx, a); err != nil { t.Fatal(err) }
+    if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: "web"}, &cm); err != nil { t.Fatal(err) }
+    if cm.Data["v"] != "2" || !metav1.IsControlledBy(&cm, a) { t.Fatalf("unexpected configmap %+v", cm) }
+}
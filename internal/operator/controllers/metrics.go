@@ -0,0 +1,205 @@
+package controllers
+
+import (
+    "context"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+var certExpiryDesc = prometheus.NewDesc(
+    "kubeop_certificate_expiry_days",
+    "Days until the certificate stored for a Certificate expires.",
+    []string{"namespace", "name", "host"}, nil,
+)
+
+// expiryCollector reports the days left on every stored certificate. The
+// value is computed at scrape time so it keeps falling between reconciles.
+type expiryCollector struct {
+    mu    sync.Mutex
+    certs map[types.NamespacedName]certValidity
+}
+
+type certValidity struct {
+    host     string
+    notAfter time.Time
+}
+
+var certExpiry = &expiryCollector{certs: map[types.NamespacedName]certValidity{}}
+
+var (
+    reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: "kubeop",
+        Name:      "reconcile_total",
+        Help:      "Reconciles by kind, tenant and outcome (success, error, requeue).",
+    }, []string{"kind", "tenant", "outcome"})
+
+    reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: "kubeop",
+        Name:      "reconcile_duration_seconds",
+        Help:      "Reconcile duration by kind, tenant and outcome.",
+        Buckets:   prometheus.DefBuckets,
+    }, []string{"kind", "tenant", "outcome"})
+
+    appTimeToReady = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: "kubeop",
+        Name:      "app_time_to_ready_seconds",
+        Help:      "Time from the creation of an App until it was first ready.",
+        // 5s to about 40m
+        Buckets: prometheus.ExponentialBuckets(5, 2, 10),
+    }, []string{"tenant"})
+)
+
+func init() {
+    // served on the manager's metrics endpoint
+    ctrlmetrics.Registry.MustRegister(certExpiry, readiness, reconcileTotal, reconcileDuration, appTimeToReady)
+}
+
+// instrument counts and times the reconciles of r by kind, tenant and
+// outcome.
+func instrument(kind string, c client.Reader, r reconcile.Reconciler) reconcile.Reconciler {
+    return reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+        start := time.Now()
+        res, err := r.Reconcile(ctx, req)
+        outcome := "success"
+        if err != nil {
+            outcome = "error"
+        } else if res.RequeueAfter > 0 {
+            outcome = "requeue"
+        }
+        tenant := requestTenant(ctx, c, kind, req)
+        reconcileTotal.WithLabelValues(kind, tenant, outcome).Inc()
+        reconcileDuration.WithLabelValues(kind, tenant, outcome).Observe(time.Since(start).Seconds())
+        return res, err
+    })
+}
+
+// requestTenant is the tenant a reconciled object belongs to; Policies and
+// Registries apply to all tenants and have none.
+func requestTenant(ctx context.Context, c client.Reader, kind string, req reconcile.Request) string {
+    switch kind {
+    case "Tenant":
+        return req.Name
+    case "Project":
+        var p v1beta1.Project
+        if err := c.Get(ctx, req.NamespacedName, &p); err == nil { return p.Spec.TenantRef }
+        return ""
+    }
+    return namespaceTenant(ctx, c, req.Namespace)
+}
+
+// namespaceTenant reads the tenant label of a project namespace.
+func namespaceTenant(ctx context.Context, c client.Reader, ns string) string {
+    if ns == "" { return "" }
+    var n corev1.Namespace
+    if err := c.Get(ctx, types.NamespacedName{Name: ns}, &n); err != nil { return "" }
+    return n.Labels["app.kubeop.io/tenant"]
+}
+
+// observeApp records the readiness of a and, the first time it is ready, the
+// time it took. healthy tells whether a revision of a was healthy before the
+// reconcile; as the history is stored, a restart does not observe it again.
+func observeApp(ctx context.Context, c client.Reader, a *v1beta1.App, healthy bool) {
+    tenant := namespaceTenant(ctx, c, a.Namespace)
+    readiness.set("App", client.ObjectKeyFromObject(a), tenant, a.Status.Ready)
+    if a.Status.Ready && !healthy {
+        appTimeToReady.WithLabelValues(tenant).Observe(time.Since(a.CreationTimestamp.Time).Seconds())
+    }
+}
+
+func everHealthy(a *v1beta1.App) bool {
+    for _, h := range a.Status.History {
+        if h.Healthy { return true }
+    }
+    return false
+}
+
+var readinessDesc = prometheus.NewDesc(
+    "kubeop_resources",
+    "Tenants, Projects and Apps by tenant and readiness.",
+    []string{"kind", "tenant", "ready"}, nil,
+)
+
+// readinessCollector counts the reconciled Tenants, Projects and Apps by
+// readiness at scrape time.
+type readinessCollector struct {
+    mu      sync.Mutex
+    objects map[readinessKey]objectReadiness
+}
+
+type readinessKey struct {
+    kind string
+    key  types.NamespacedName
+}
+
+type objectReadiness struct {
+    tenant string
+    ready  bool
+}
+
+var readiness = &readinessCollector{objects: map[readinessKey]objectReadiness{}}
+
+func (e *readinessCollector) set(kind string, key types.NamespacedName, tenant string, ready bool) {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    e.objects[readinessKey{kind, key}] = objectReadiness{tenant: tenant, ready: ready}
+}
+
+func (e *readinessCollector) forget(kind string, key types.NamespacedName) {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    delete(e.objects, readinessKey{kind, key})
+}
+
+func (e *readinessCollector) Describe(ch chan<- *prometheus.Desc) { ch <- readinessDesc }
+
+// Collect reports both counts of every kind and tenant seen, so a count
+// dropping to zero is reported as such.
+func (e *readinessCollector) Collect(ch chan<- prometheus.Metric) {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    type group struct{ kind, tenant string }
+    counts := map[group]*[2]int{}
+    for k, v := range e.objects {
+        g := group{k.kind, v.tenant}
+        if counts[g] == nil { counts[g] = &[2]int{} }
+        if v.ready { counts[g][1]++ } else { counts[g][0]++ }
+    }
+    for g, n := range counts {
+        for i, ready := range []bool{false, true} {
+            ch <- prometheus.MustNewConstMetric(readinessDesc, prometheus.GaugeValue, float64(n[i]), g.kind, g.tenant, strconv.FormatBool(ready))
+        }
+    }
+}
+
+func (e *expiryCollector) set(key types.NamespacedName, host string, notAfter time.Time) {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    e.certs[key] = certValidity{host: host, notAfter: notAfter}
+}
+
+func (e *expiryCollector) forget(key types.NamespacedName) {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    delete(e.certs, key)
+}
+
+func (e *expiryCollector) Describe(ch chan<- *prometheus.Desc) { ch <- certExpiryDesc }
+
+func (e *expiryCollector) Collect(ch chan<- prometheus.Metric) {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    for key, v := range e.certs {
+        days := time.Until(v.notAfter).Hours() / 24
+        ch <- prometheus.MustNewConstMetric(certExpiryDesc, prometheus.GaugeValue, days, key.Namespace, key.Name, v.host)
+    }
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/testutil"
+    dto "github.com/prometheus/client_model/go"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// readyCounts returns the kubeop_resources values of kind and tenant by
+// their ready label.
+func readyCounts(t *testing.T, kind, tenant string) map[string]float64 {
+    t.Helper()
+    ch := make(chan prometheus.Metric, 100)
+    readiness.Collect(ch)
+    close(ch)
+    out := map[string]float64{}
+    for m := range ch {
+        var pb dto.Metric
+        if err := m.Write(&pb); err != nil { t.Fatal(err) }
+        labels := map[string]string{}
+        for _, l := range pb.Label { labels[l.GetName()] = l.GetValue() }
+        if labels["kind"] == kind && labels["tenant"] == tenant { out[labels["ready"]] = pb.Gauge.GetValue() }
+    }
+    return out
+}
+
+func Test_ReconcileMetrics(t *testing.T) {
+    ctx := context.Background()
+    ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-metrics-web", Labels: map[string]string{"app.kubeop.io/tenant": "metrics"}}}
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(ns).Build()
+    req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: ns.Name, Name: "web"}}
+    outcomes := []struct {
+        res reconcile.Result
+        err error
+    }{{}, {res: reconcile.Result{RequeueAfter: time.Minute}}, {err: errors.New("boom")}}
+    for _, o := range outcomes {
+        r := instrument("App", c, reconcile.Func(func(context.Context, reconcile.Request) (reconcile.Result, error) { return o.res, o.err }))
+        _, _ = r.Reconcile(ctx, req)
+    }
+    for _, outcome := range []string{"success", "requeue", "error"} {
+        if n := testutil.ToFloat64(reconcileTotal.WithLabelValues("App", "metrics", outcome)); n != 1 { t.Fatalf("expected one %s reconcile, got %v", outcome, n) }
+    }
+
+    // readiness is counted per tenant, and the time to ready observed once
+    app := &v1beta1.App{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: ns.Name, CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Minute))}}
+    defer readiness.forget("App", req.NamespacedName)
+    observeApp(ctx, c, app, everHealthy(app))
+    if got := readyCounts(t, "App", "metrics"); got["false"] != 1 || got["true"] != 0 { t.Fatalf("unexpected counts %v", got) }
+    healthy := everHealthy(app)
+    app.Status.Ready = true
+    app.Status.History = []v1beta1.AppRevision{{Number: 1, Healthy: true}}
+    observeApp(ctx, c, app, healthy)
+    observeApp(ctx, c, app, everHealthy(app))
+    if got := readyCounts(t, "App", "metrics"); got["false"] != 0 || got["true"] != 1 { t.Fatalf("unexpected counts %v", got) }
+    var h dto.Metric
+    if err := appTimeToReady.WithLabelValues("metrics").(prometheus.Histogram).Write(&h); err != nil { t.Fatal(err) }
+    if n, sum := h.Histogram.GetSampleCount(), h.Histogram.GetSampleSum(); n != 1 || sum < 60 { t.Fatalf("expected one sample of about a minute, got %d totalling %v", n, sum) }
+}
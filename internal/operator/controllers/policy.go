@@ -0,0 +1,164 @@
+package controllers
+
+import (
+    "context"
+    "fmt"
+    "net"
+    "sort"
+    "strings"
+
+    corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/apimachinery/pkg/util/intstr"
+    "k8s.io/client-go/tools/record"
+    ctrl "sigs.k8s.io/controller-runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller"
+    "sigs.k8s.io/controller-runtime/pkg/handler"
+    "sigs.k8s.io/controller-runtime/pkg/log"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// Policy reconciler: render Policies into the kubeop-egress NetworkPolicy of
+// every project namespace they select.
+type PolicyReconciler struct{
+    client.Client
+    Recorder record.EventRecorder
+}
+
+func (r *PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+    lg := log.FromContext(ctx)
+    // A namespace's rules are the union of all Policies selecting it, so any
+    // change, deletion included, re-syncs every project namespace.
+    var policies v1beta1.PolicyList
+    if err := r.List(ctx, &policies); err != nil { return ctrl.Result{}, err }
+    var nss corev1.NamespaceList
+    if err := r.List(ctx, &nss, client.HasLabels{"app.kubeop.io/tenant"}); err != nil { return ctrl.Result{}, err }
+    for i := range nss.Items {
+        if err := syncEgressPolicy(ctx, r.Client, &nss.Items[i], policies.Items); err != nil {
+            return ctrl.Result{}, fmt.Errorf("namespace %s: %w", nss.Items[i].Name, err)
+        }
+    }
+
+    var p v1beta1.Policy
+    if err := r.Get(ctx, req.NamespacedName, &p); err != nil {
+        return ctrl.Result{}, client.IgnoreNotFound(err)
+    }
+    cidrs, invalid := policyCIDRs(&p)
+    p.Status.Egress = egressRules(cidrs)
+    p.Status.Namespaces = nil
+    sel, err := policySelector(&p)
+    if err == nil {
+        for _, ns := range nss.Items {
+            if sel.Matches(labels.Set(ns.Labels)) { p.Status.Namespaces = append(p.Status.Namespaces, ns.Name) }
+        }
+    }
+    status, reason, msg := "True", "Applied", fmt.Sprintf("applied to %d namespaces", len(p.Status.Namespaces))
+    switch {
+    case err != nil:
+        status, reason, msg = "False", "InvalidSelector", err.Error()
+    case len(invalid) > 0:
+        status, reason, msg = "False", "InvalidCIDR", fmt.Sprintf("ignored invalid CIDRs: %s", strings.Join(invalid, ", "))
+    }
+    if conditionChanged(p.Status.Conditions, "Ready", status, reason) {
+        eventtype := corev1.EventTypeNormal
+        if status == "False" { eventtype = corev1.EventTypeWarning }
+        recordEvent(r.Recorder, &p, eventtype, reason, msg)
+    }
+    setCondition(&p.Status.Conditions, "Ready", status, reason, msg)
+    p.Status.Ready = status == "True"
+    if err := r.Status().Update(ctx, &p); err != nil {
+        lg.Error(err, "update policy status")
+        return ctrl.Result{}, err
+    }
+    return ctrl.Result{}, nil
+}
+func (r *PolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+    return ctrl.NewControllerManagedBy(mgr).
+        For(&v1beta1.Policy{}).
+        Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.namespaceToPolicies)).
+        WithOptions(controller.Options{MaxConcurrentReconciles: 1}).
+        Complete(instrument("Policy", mgr.GetClient(), r))
+}
+
+// namespaceToPolicies enqueues every Policy when a project namespace changes,
+// so their status lists stay current.
+func (r *PolicyReconciler) namespaceToPolicies(ctx context.Context, obj client.Object) []reconcile.Request {
+    if obj.GetLabels()["app.kubeop.io/tenant"] == "" { return nil }
+    var policies v1beta1.PolicyList
+    if err := r.List(ctx, &policies); err != nil { return nil }
+    reqs := make([]reconcile.Request, 0, len(policies.Items))
+    for _, p := range policies.Items {
+        reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Name: p.Name}})
+    }
+    return reqs
+}
+
+// syncEgressPolicy applies the kubeop-egress NetworkPolicy of ns from the
+// policies selecting it.
+func syncEgressPolicy(ctx context.Context, c client.Client, ns *corev1.Namespace, policies []v1beta1.Policy) error {
+    _, err := applyBaseline(ctx, c, egressBaseline(ns, policies), false)
+    return err
+}
+
+// desiredEgress unions the CIDRs of every Policy selecting ns. Namespaces no
+// Policy selects keep unrestricted egress.
+func desiredEgress(ns *corev1.Namespace, policies []v1beta1.Policy) []networkingv1.NetworkPolicyEgressRule {
+    set := map[string]bool{}
+    matched := false
+    for i := range policies {
+        sel, err := policySelector(&policies[i])
+        if err != nil || !sel.Matches(labels.Set(ns.Labels)) { continue }
+        matched = true
+        cidrs, _ := policyCIDRs(&policies[i])
+        for _, c := range cidrs { set[c] = true }
+    }
+    if !matched {
+        return []networkingv1.NetworkPolicyEgressRule{{}}
+    }
+    cidrs := make([]string, 0, len(set))
+    for c := range set { cidrs = append(cidrs, c) }
+    sort.Strings(cidrs)
+    return egressRules(cidrs)
+}
+
+// egressRules always allows DNS, then allows traffic to cidrs.
+func egressRules(cidrs []string) []networkingv1.NetworkPolicyEgressRule {
+    udp, tcp := corev1.ProtocolUDP, corev1.ProtocolTCP
+    dns := intstr.FromInt32(53)
+    rules := []networkingv1.NetworkPolicyEgressRule{{Ports: []networkingv1.NetworkPolicyPort{
+        {Protocol: &udp, Port: &dns},
+        {Protocol: &tcp, Port: &dns},
+    }}}
+    if len(cidrs) == 0 { return rules }
+    to := make([]networkingv1.NetworkPolicyPeer, 0, len(cidrs))
+    for _, c := range cidrs {
+        to = append(to, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: c}})
+    }
+    return append(rules, networkingv1.NetworkPolicyEgressRule{To: to})
+}
+
+// policySelector converts spec.namespaceSelector; an empty selector selects
+// every project namespace.
+func policySelector(p *v1beta1.Policy) (labels.Selector, error) {
+    if p.Spec.NamespaceSelector == nil { return labels.Everything(), nil }
+    return metav1.LabelSelectorAsSelector(p.Spec.NamespaceSelector)
+}
+
+// policyCIDRs returns the normalized valid CIDRs of p and the invalid ones.
+func policyCIDRs(p *v1beta1.Policy) (valid, invalid []string) {
+    for _, c := range p.Spec.EgressAllowCIDRs {
+        _, n, err := net.ParseCIDR(strings.TrimSpace(c))
+        if err != nil {
+            invalid = append(invalid, c)
+            continue
+        }
+        valid = append(valid, n.String())
+    }
+    return valid, invalid
+}
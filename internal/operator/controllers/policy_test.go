@@ -0,0 +1,60 @@
+package controllers
+
+import (
+    "context"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    networkingv1 "k8s.io/api/networking/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_PolicyEgress(t *testing.T) {
+    ctx := context.Background()
+    web := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-acme-web", Labels: map[string]string{"app.kubeop.io/tenant": "acme", "app.kubeop.io/project": "web"}}}
+    api := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-acme-api", Labels: map[string]string{"app.kubeop.io/tenant": "acme", "app.kubeop.io/project": "api"}}}
+    pol := &v1beta1.Policy{
+        ObjectMeta: metav1.ObjectMeta{Name: "web-egress"},
+        Spec: v1beta1.PolicySpec{
+            EgressAllowCIDRs:  []string{"10.1.2.3/16", "192.168.0.0/24"},
+            NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app.kubeop.io/project": "web"}},
+        },
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).
+        WithObjects(web, api, pol).
+        WithStatusSubresource(&v1beta1.Policy{}).
+        Build()
+    r := &PolicyReconciler{Client: c}
+    if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKey{Name: "web-egress"}}); err != nil { t.Fatal(err) }
+
+    var np networkingv1.NetworkPolicy
+    if err := c.Get(ctx, client.ObjectKey{Namespace: "kubeop-acme-web", Name: "kubeop-egress"}, &np); err != nil { t.Fatal(err) }
+    if len(np.Spec.Egress) != 2 || len(np.Spec.Egress[0].Ports) != 2 || np.Spec.Egress[0].Ports[0].Port.IntValue() != 53 {
+        t.Fatalf("expected DNS rule followed by CIDR rule, got %+v", np.Spec.Egress)
+    }
+    if to := np.Spec.Egress[1].To; len(to) != 2 || to[0].IPBlock.CIDR != "10.1.0.0/16" || to[1].IPBlock.CIDR != "192.168.0.0/24" {
+        t.Fatalf("unexpected CIDR peers %+v", to)
+    }
+    if err := c.Get(ctx, client.ObjectKey{Namespace: "kubeop-acme-api", Name: "kubeop-egress"}, &np); err != nil { t.Fatal(err) }
+    if len(np.Spec.Egress) != 1 || len(np.Spec.Egress[0].To) != 0 || len(np.Spec.Egress[0].Ports) != 0 {
+        t.Fatalf("unselected namespace should keep unrestricted egress, got %+v", np.Spec.Egress)
+    }
+    var got v1beta1.Policy
+    if err := c.Get(ctx, client.ObjectKey{Name: "web-egress"}, &got); err != nil { t.Fatal(err) }
+    if !got.Status.Ready || len(got.Status.Namespaces) != 1 || got.Status.Namespaces[0] != "kubeop-acme-web" || len(got.Status.Egress) != 2 {
+        t.Fatalf("unexpected status %+v", got.Status)
+    }
+
+    // deleting the Policy lifts the restriction again
+    if err := c.Delete(ctx, &got); err != nil { t.Fatal(err) }
+    if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKey{Name: "web-egress"}}); err != nil { t.Fatal(err) }
+    if err := c.Get(ctx, client.ObjectKey{Namespace: "kubeop-acme-web", Name: "kubeop-egress"}, &np); err != nil { t.Fatal(err) }
+    if len(np.Spec.Egress) != 1 || len(np.Spec.Egress[0].Ports) != 0 {
+        t.Fatalf("expected unrestricted egress after policy deletion, got %+v", np.Spec.Egress)
+    }
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+    corev1 "k8s.io/api/core/v1"
+    rbacv1 "k8s.io/api/rbac/v1"
+    "k8s.io/apimachinery/pkg/api/equality"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// projectAccessName names the ServiceAccount, Role and RoleBinding of a
+// project namespace. The manager mints kubeconfig tokens for the
+// ServiceAccount.
+const projectAccessName = "kubeop-project"
+
+var allVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete"}
+var readVerbs = []string{"get", "list", "watch"}
+
+// projectRules is what project kubeconfigs may do in their namespace. The
+// baseline objects kubeOP maintains are read-only. The operator writes the
+// Role without the escalate verb, so its ClusterRole must hold every rule
+// listed here.
+func projectRules() []rbacv1.PolicyRule {
+    return []rbacv1.PolicyRule{
+        {APIGroups: []string{""}, Resources: []string{"pods", "services", "configmaps", "secrets", "persistentvolumeclaims"}, Verbs: allVerbs},
+        {APIGroups: []string{""}, Resources: []string{"pods/log", "pods/exec", "pods/portforward"}, Verbs: []string{"get", "create"}},
+        {APIGroups: []string{""}, Resources: []string{"events", "serviceaccounts", "resourcequotas", "limitranges"}, Verbs: readVerbs},
+        {APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets", "replicasets"}, Verbs: allVerbs},
+        {APIGroups: []string{"batch"}, Resources: []string{"jobs", "cronjobs"}, Verbs: allVerbs},
+        {APIGroups: []string{"autoscaling"}, Resources: []string{"horizontalpodautoscalers"}, Verbs: allVerbs},
+        {APIGroups: []string{"networking.k8s.io"}, Resources: []string{"ingresses"}, Verbs: allVerbs},
+        {APIGroups: []string{"networking.k8s.io"}, Resources: []string{"networkpolicies"}, Verbs: readVerbs},
+        {APIGroups: []string{"paas.kubeop.io"}, Resources: []string{"apps", "dnsrecords", "certificates"}, Verbs: allVerbs},
+    }
+}
+
+func serviceAccountBaseline(ns *corev1.Namespace) baseline {
+    automount := false
+    desired := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: projectAccessName, Namespace: ns.Name, OwnerReferences: baselineOwner(ns)}, AutomountServiceAccountToken: &automount}
+    current := &corev1.ServiceAccount{}
+    return baseline{desired: desired, current: current,
+        same:  func() bool { return equality.Semantic.DeepEqual(current.AutomountServiceAccountToken, desired.AutomountServiceAccountToken) },
+        reset: func() { current.AutomountServiceAccountToken = desired.AutomountServiceAccountToken },
+    }
+}
+
+func roleBaseline(ns *corev1.Namespace) baseline {
+    desired := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: projectAccessName, Namespace: ns.Name, OwnerReferences: baselineOwner(ns)}, Rules: projectRules()}
+    current := &rbacv1.Role{}
+    return baseline{desired: desired, current: current,
+        same:  func() bool { return equality.Semantic.DeepEqual(current.Rules, desired.Rules) },
+        reset: func() { current.Rules = desired.Rules },
+    }
+}
+
+// roleBindingBaseline grants the project Role to the project ServiceAccount.
+// The role reference is immutable, so only the subjects can drift.
+func roleBindingBaseline(ns *corev1.Namespace) baseline {
+    desired := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: projectAccessName, Namespace: ns.Name, OwnerReferences: baselineOwner(ns)},
+        RoleRef:  rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: projectAccessName},
+        Subjects: []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: projectAccessName, Namespace: ns.Name}},
+    }
+    current := &rbacv1.RoleBinding{}
+    return baseline{desired: desired, current: current,
+        same:  func() bool { return equality.Semantic.DeepEqual(current.Subjects, desired.Subjects) },
+        reset: func() { current.Subjects = desired.Subjects },
+    }
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+    "context"
+    "os"
+    "slices"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    rbacv1 "k8s.io/api/rbac/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    "github.com/vaheed/kubeop/internal/kube"
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_ProjectAccess(t *testing.T) {
+    ctx := context.Background()
+    p := &v1beta1.Project{
+        ObjectMeta: metav1.ObjectMeta{Name: "acme-web"},
+        Spec:       v1beta1.ProjectSpec{TenantRef: "acme", Name: "web"},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(p).WithStatusSubresource(&v1beta1.Project{}).Build()
+    r := &ProjectReconciler{Client: c}
+    req := reconcile.Request{NamespacedName: client.ObjectKey{Name: "acme-web"}}
+    key := client.ObjectKey{Namespace: "kubeop-acme-web", Name: projectAccessName}
+
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    var sa corev1.ServiceAccount
+    if err := c.Get(ctx, key, &sa); err != nil { t.Fatal(err) }
+    if ref := metav1.GetControllerOf(&sa); ref == nil || ref.Kind != "Project" || *sa.AutomountServiceAccountToken { t.Fatalf("unexpected service account %+v", sa) }
+    var rb rbacv1.RoleBinding
+    if err := c.Get(ctx, key, &rb); err != nil { t.Fatal(err) }
+    if rb.RoleRef.Name != projectAccessName || len(rb.Subjects) != 1 || rb.Subjects[0].Name != projectAccessName || rb.Subjects[0].Namespace != key.Namespace { t.Fatalf("unexpected role binding %+v", rb) }
+
+    // a tenant granting itself more is reverted
+    var role rbacv1.Role
+    if err := c.Get(ctx, key, &role); err != nil { t.Fatal(err) }
+    role.Rules = append(role.Rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"resourcequotas"}, Verbs: []string{"update"}})
+    if err := c.Update(ctx, &role, client.FieldOwner("kubectl")); err != nil { t.Fatal(err) }
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if err := c.Get(ctx, key, &role); err != nil { t.Fatal(err) }
+    if len(role.Rules) != len(projectRules()) { t.Fatalf("role not reverted: %+v", role.Rules) }
+}
+
+// The operator writes project Roles without escalate, which the API server
+// only allows when its own ClusterRole already grants every rule.
+func Test_OperatorCoversProjectRules(t *testing.T) {
+    for _, path := range []string{"../../../deploy/k8s/operator/rbac.yaml", "../../../charts/kubeop-operator/templates/clusterrole.yaml"} {
+        f, err := os.Open(path)
+        if err != nil { t.Fatal(err) }
+        objs, err := kube.DecodeManifests(f)
+        f.Close()
+        if err != nil { t.Fatalf("%s: %v", path, err) }
+        var role rbacv1.ClusterRole
+        for _, obj := range objs {
+            if obj.GetKind() != "ClusterRole" { continue }
+            if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &role); err != nil { t.Fatal(err) }
+        }
+        for _, verb := range []string{"escalate", "bind"} {
+            for _, rule := range role.Rules {
+                if slices.Contains(rule.APIGroups, rbacv1.GroupName) && slices.Contains(rule.Verbs, verb) { t.Fatalf("%s grants %s", path, verb) }
+            }
+        }
+        for _, want := range projectRules() {
+            for _, group := range want.APIGroups {
+                for _, res := range want.Resources {
+                    for _, verb := range want.Verbs {
+                        if !slices.ContainsFunc(role.Rules, func(r rbacv1.PolicyRule) bool {
+                            return slices.Contains(r.APIGroups, group) && slices.Contains(r.Resources, res) && (slices.Contains(r.Verbs, verb) || slices.Contains(r.Verbs, "*"))
+                        }) { t.Fatalf("%s does not grant %s on %s.%s", path, verb, res, group) }
+                    }
+                }
+            }
+        }
+    }
+}
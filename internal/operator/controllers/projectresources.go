@@ -0,0 +1,107 @@
+package controllers
+
+import (
+    "context"
+    "fmt"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/api/resource"
+    "k8s.io/apimachinery/pkg/types"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+    "sigs.k8s.io/yaml"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// projectDefaultsKey is the key of the defaults ConfigMap holding the
+// operator's project defaults, a YAML ProjectResources.
+const projectDefaultsKey = "project-defaults.yaml"
+
+// builtinProjectResources apply to every key neither the operator defaults nor
+// the Project set.
+func builtinProjectResources() v1beta1.ProjectResources {
+    storage, claims := resourceMust("10Gi"), int64(10)
+    return v1beta1.ProjectResources{
+        Quota:          projectQuota(),
+        DefaultRequest: corev1.ResourceList{corev1.ResourceCPU: resourceMust("100m"), corev1.ResourceMemory: resourceMust("64Mi")},
+        DefaultLimit:   corev1.ResourceList{corev1.ResourceCPU: resourceMust("500m"), corev1.ResourceMemory: resourceMust("256Mi")},
+        Storage:        &v1beta1.ProjectStorage{Requests: &storage, PersistentVolumeClaims: &claims},
+    }
+}
+
+// projectResources layers the spec of p over the operator defaults, which are
+// layered over the built-in ones. A missing defaults ConfigMap is not an error.
+func (r *ProjectReconciler) projectResources(ctx context.Context, p *v1beta1.Project) (v1beta1.ProjectResources, error) {
+    res := builtinProjectResources()
+    if r.Defaults.Name != "" {
+        var cm corev1.ConfigMap
+        err := r.Get(ctx, r.Defaults, &cm)
+        if err != nil && !apierrors.IsNotFound(err) { return res, err }
+        if raw := cm.Data[projectDefaultsKey]; err == nil && raw != "" {
+            var defaults v1beta1.ProjectResources
+            if err := yaml.UnmarshalStrict([]byte(raw), &defaults); err != nil {
+                return res, fmt.Errorf("project defaults %s: %w", r.Defaults, err)
+            }
+            res = mergeProjectResources(res, defaults)
+        }
+    }
+    return mergeProjectResources(res, p.Spec.ProjectResources), nil
+}
+
+// mergeProjectResources returns base with every key set in over replaced.
+func mergeProjectResources(base, over v1beta1.ProjectResources) v1beta1.ProjectResources {
+    out := v1beta1.ProjectResources{
+        Quota:          mergeResources(base.Quota, over.Quota),
+        DefaultRequest: mergeResources(base.DefaultRequest, over.DefaultRequest),
+        DefaultLimit:   mergeResources(base.DefaultLimit, over.DefaultLimit),
+    }
+    for _, st := range []*v1beta1.ProjectStorage{base.Storage, over.Storage} {
+        if st == nil { continue }
+        if out.Storage == nil { out.Storage = &v1beta1.ProjectStorage{} }
+        if st.Requests != nil { out.Storage.Requests = st.Requests }
+        if st.PersistentVolumeClaims != nil { out.Storage.PersistentVolumeClaims = st.PersistentVolumeClaims }
+        for class, q := range st.Classes {
+            if out.Storage.Classes == nil { out.Storage.Classes = map[string]resource.Quantity{} }
+            out.Storage.Classes[class] = q
+        }
+    }
+    return out
+}
+
+func mergeResources(base, over corev1.ResourceList) corev1.ResourceList {
+    out := corev1.ResourceList{}
+    for k, v := range base { out[k] = v }
+    for k, v := range over { out[k] = v }
+    return out
+}
+
+// quotaHard returns the kubeop-quota hard limit for res. Storage fields take
+// precedence over the same keys in the quota.
+func quotaHard(res v1beta1.ProjectResources) corev1.ResourceList {
+    hard := mergeResources(nil, res.Quota)
+    st := res.Storage
+    if st == nil { return hard }
+    if st.Requests != nil { hard[corev1.ResourceRequestsStorage] = *st.Requests }
+    if st.PersistentVolumeClaims != nil {
+        hard[corev1.ResourcePersistentVolumeClaims] = *resource.NewQuantity(*st.PersistentVolumeClaims, resource.DecimalSI)
+    }
+    for class, q := range st.Classes {
+        hard[corev1.ResourceName(class+".storageclass.storage.k8s.io/requests.storage")] = q
+    }
+    return hard
+}
+
+// defaultsToProjects enqueues every Project when the operator's project
+// defaults change.
+func (r *ProjectReconciler) defaultsToProjects(ctx context.Context, obj client.Object) []reconcile.Request {
+    if obj.GetNamespace() != r.Defaults.Namespace || obj.GetName() != r.Defaults.Name { return nil }
+    var projects v1beta1.ProjectList
+    if err := r.List(ctx, &projects); err != nil { return nil }
+    reqs := make([]reconcile.Request, 0, len(projects.Items))
+    for _, p := range projects.Items {
+        reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Name: p.Name}})
+    }
+    return reqs
+}
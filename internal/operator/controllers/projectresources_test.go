@@ -0,0 +1,116 @@
+package controllers
+
+import (
+    "context"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_ProjectResources(t *testing.T) {
+    ctx := context.Background()
+    defaults := &corev1.ConfigMap{
+        ObjectMeta: metav1.ObjectMeta{Name: "kubeop-project-defaults", Namespace: "kubeop-system"},
+        Data: map[string]string{projectDefaultsKey: `
+quota:
+  pods: "20"
+  requests.cpu: "2"
+defaultLimit:
+  memory: 512Mi
+storage:
+  requests: 10Gi
+  persistentVolumeClaims: 5
+`},
+    }
+    tenant := &v1beta1.Tenant{
+        ObjectMeta: metav1.ObjectMeta{Name: "acme"},
+        Spec:       v1beta1.TenantSpec{Name: "acme", Limits: corev1.ResourceList{corev1.ResourceRequestsCPU: resourceMust("4")}},
+    }
+    p := &v1beta1.Project{
+        ObjectMeta: metav1.ObjectMeta{Name: "acme-web"},
+        Spec: v1beta1.ProjectSpec{TenantRef: "acme", Name: "web", ProjectResources: v1beta1.ProjectResources{
+            Quota:          corev1.ResourceList{corev1.ResourceRequestsMemory: resourceMust("4Gi")},
+            DefaultRequest: corev1.ResourceList{corev1.ResourceCPU: resourceMust("50m")},
+            Storage:        &v1beta1.ProjectStorage{Classes: map[string]resource.Quantity{"fast": resourceMust("1Gi")}},
+        }},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(defaults, tenant, p).WithStatusSubresource(&v1beta1.Project{}).Build()
+    r := &ProjectReconciler{Client: c, Defaults: client.ObjectKeyFromObject(defaults)}
+    req := reconcile.Request{NamespacedName: client.ObjectKey{Name: "acme-web"}}
+    ns := "kubeop-acme-web"
+    hard := func() corev1.ResourceList {
+        var rq corev1.ResourceQuota
+        if err := c.Get(ctx, types.NamespacedName{Namespace: ns, Name: "kubeop-quota"}, &rq); err != nil { t.Fatal(err) }
+        return rq.Spec.Hard
+    }
+    get := func() *v1beta1.Project {
+        var cur v1beta1.Project
+        if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+        return &cur
+    }
+
+    // the spec overrides the operator defaults, which override the built-in ones
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    want := map[corev1.ResourceName]string{
+        corev1.ResourcePods: "20", corev1.ResourceRequestsCPU: "2", corev1.ResourceRequestsMemory: "4Gi",
+        corev1.ResourceRequestsStorage: "10Gi", corev1.ResourcePersistentVolumeClaims: "5",
+        "fast.storageclass.storage.k8s.io/requests.storage": "1Gi",
+    }
+    got := hard()
+    for k, v := range want {
+        if q, ok := got[k]; !ok || q.String() != v { t.Fatalf("quota %s = %v, want %s (%v)", k, got[k], v, got) }
+    }
+    if len(got) != len(want) { t.Fatalf("unexpected quota keys %v", got) }
+    var lr corev1.LimitRange
+    if err := c.Get(ctx, types.NamespacedName{Namespace: ns, Name: "kubeop-defaults"}, &lr); err != nil { t.Fatal(err) }
+    item := lr.Spec.Limits[0]
+    if item.DefaultRequest.Cpu().String() != "50m" || item.DefaultRequest.Memory().String() != "64Mi" || item.Default.Memory().String() != "512Mi" || item.Default.Cpu().String() != "500m" {
+        t.Fatalf("unexpected limit range defaults %+v", item)
+    }
+    if cur := get(); !cur.Status.Ready || cur.Status.Quota.Pods().String() != "20" { t.Fatalf("unexpected status %+v", cur.Status) }
+
+    // updates reach the existing namespace
+    cur := get()
+    cur.Spec.Quota[corev1.ResourceRequestsCPU] = resourceMust("3")
+    if err := c.Update(ctx, cur); err != nil { t.Fatal(err) }
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if cpu := hard()[corev1.ResourceRequestsCPU]; cpu.String() != "3" { t.Fatalf("quota update not applied: %v", hard()) }
+
+    // a quota past the tenant limits is not applied
+    cur = get()
+    cur.Spec.Quota[corev1.ResourceRequestsCPU] = resourceMust("5")
+    if err := c.Update(ctx, cur); err != nil { t.Fatal(err) }
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if cpu := hard()[corev1.ResourceRequestsCPU]; cpu.String() != "3" { t.Fatalf("quota past the tenant limits applied: %v", hard()) }
+    if cond := findCondition(get().Status.Conditions, "QuotaApplied"); cond == nil || cond.Status != "False" || cond.Reason != "TenantLimitExceeded" {
+        t.Fatalf("expected QuotaApplied=False, got %+v", cond)
+    }
+
+    // nor is it applied to a project that never had a quota recorded
+    cur = get()
+    cur.Status.Quota = nil
+    if err := c.Status().Update(ctx, cur); err != nil { t.Fatal(err) }
+    if err := c.Delete(ctx, &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "kubeop-quota"}}); err != nil { t.Fatal(err) }
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if err := c.Get(ctx, types.NamespacedName{Namespace: ns, Name: "kubeop-quota"}, &corev1.ResourceQuota{}); !apierrors.IsNotFound(err) { t.Fatalf("quota past the tenant limits applied: %v", err) }
+    if cur = get(); len(cur.Status.Quota) != 0 { t.Fatalf("unexpected status quota %v", cur.Status.Quota) }
+    if cond := findCondition(cur.Status.Conditions, "QuotaApplied"); cond == nil || cond.Status != "False" || cond.Reason != "TenantLimitExceeded" {
+        t.Fatalf("expected QuotaApplied=False, got %+v", cond)
+    }
+
+    // invalid operator defaults are reported
+    defaults.Data[projectDefaultsKey] = "quota: [1"
+    if err := c.Update(ctx, defaults); err != nil { t.Fatal(err) }
+    if _, err := r.Reconcile(ctx, req); err == nil { t.Fatalf("expected invalid defaults to fail") }
+    if cond := findCondition(get().Status.Conditions, "Ready"); cond.Reason != "BaselineFailed" { t.Fatalf("unexpected condition %+v", cond) }
+    if reqs := r.defaultsToProjects(ctx, defaults); len(reqs) != 1 || reqs[0].Name != "acme-web" { t.Fatalf("unexpected requests %v", reqs) }
+}
@@ -0,0 +1,252 @@
+package controllers
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/tools/record"
+    ctrl "sigs.k8s.io/controller-runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+    "sigs.k8s.io/controller-runtime/pkg/handler"
+    "sigs.k8s.io/controller-runtime/pkg/log"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+const (
+    // registryFinalizer detaches pull secrets from ServiceAccounts before a
+    // Registry goes away; garbage collection only removes the Secrets.
+    registryFinalizer = "paas.kubeop.io/registry-cleanup"
+    // registryPasswordNamespace is where passwordRef is looked up when it
+    // does not name a namespace.
+    registryPasswordNamespace = "kubeop-system"
+    registryPasswordKey       = "password"
+    // registrySAWaitInterval is how long to wait for the default
+    // ServiceAccount of a fresh namespace to appear.
+    registrySAWaitInterval = 5 * time.Second
+)
+
+// ManagedSecretLabel marks the Secrets the operator writes into project
+// namespaces: Registry pull secrets and Certificate TLS Secrets. Outside its
+// own namespace the operator only caches and watches Secrets with this label.
+const ManagedSecretLabel = "app.kubeop.io/managed-secret"
+
+// Registry reconciler: keep a dockerconfigjson pull secret for each Registry in
+// every project namespace and attach it to the default ServiceAccount.
+type RegistryReconciler struct{
+    client.Client
+    Recorder record.EventRecorder
+}
+
+func (r *RegistryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+    lg := log.FromContext(ctx)
+    var reg v1beta1.Registry
+    if err := r.Get(ctx, req.NamespacedName, &reg); err != nil {
+        return ctrl.Result{}, client.IgnoreNotFound(err)
+    }
+    secretName := registrySecretName(&reg)
+    var nss corev1.NamespaceList
+    if err := r.List(ctx, &nss, client.HasLabels{"app.kubeop.io/tenant"}); err != nil { return ctrl.Result{}, err }
+
+    if !reg.DeletionTimestamp.IsZero() {
+        if err := r.detachAll(ctx, nss.Items, secretName); err != nil { return ctrl.Result{}, err }
+        if controllerutil.RemoveFinalizer(&reg, registryFinalizer) {
+            if err := r.Update(ctx, &reg); err != nil { return ctrl.Result{}, err }
+        }
+        return ctrl.Result{}, nil
+    }
+    if controllerutil.AddFinalizer(&reg, registryFinalizer) {
+        if err := r.Update(ctx, &reg); err != nil { return ctrl.Result{}, err }
+    }
+
+    // Without credentials the registry only widens the image allow-list.
+    if reg.Spec.Username == "" {
+        if err := r.detachAll(ctx, nss.Items, secretName); err != nil { return ctrl.Result{}, err }
+        reg.Status.SecretName = ""
+        reg.Status.Namespaces = nil
+        setCondition(&reg.Status.Conditions, "Ready", "True", "NoCredentials", "Registry allowed without a pull secret")
+        reg.Status.Ready = true
+        return ctrl.Result{}, r.Status().Update(ctx, &reg)
+    }
+    password, err := r.registryPassword(ctx, &reg)
+    if err != nil {
+        if conditionChanged(reg.Status.Conditions, "Ready", "False", "PasswordUnavailable") { recordEvent(r.Recorder, &reg, corev1.EventTypeWarning, "PasswordUnavailable", err.Error()) }
+        setCondition(&reg.Status.Conditions, "Ready", "False", "PasswordUnavailable", err.Error())
+        reg.Status.Ready = false
+        // the password Secret is watched, so no requeue is needed
+        return ctrl.Result{}, r.Status().Update(ctx, &reg)
+    }
+    config, err := dockerConfigJSON(reg.Spec.Host, reg.Spec.Username, password)
+    if err != nil { return ctrl.Result{}, err }
+
+    var namespaces []string
+    waiting := false
+    for _, ns := range nss.Items {
+        if !ns.DeletionTimestamp.IsZero() { continue }
+        if err := r.ensurePullSecret(ctx, &reg, ns.Name, secretName, config); err != nil {
+            return ctrl.Result{}, fmt.Errorf("namespace %s: %w", ns.Name, err)
+        }
+        attached, err := r.attachToDefaultSA(ctx, ns.Name, secretName)
+        if err != nil { return ctrl.Result{}, fmt.Errorf("namespace %s: %w", ns.Name, err) }
+        if !attached { waiting = true; continue }
+        namespaces = append(namespaces, ns.Name)
+    }
+    reg.Status.SecretName = secretName
+    reg.Status.Namespaces = namespaces
+    if waiting {
+        setCondition(&reg.Status.Conditions, "Ready", "False", "WaitingForServiceAccount", "Some namespaces have no default ServiceAccount yet")
+    } else {
+        msg := fmt.Sprintf("Pull secret present in %d namespaces", len(namespaces))
+        if conditionChanged(reg.Status.Conditions, "Ready", "True", "Synced") { recordEvent(r.Recorder, &reg, corev1.EventTypeNormal, "Synced", msg) }
+        setCondition(&reg.Status.Conditions, "Ready", "True", "Synced", msg)
+    }
+    reg.Status.Ready = !waiting
+    if err := r.Status().Update(ctx, &reg); err != nil {
+        lg.Error(err, "update registry status")
+        return ctrl.Result{}, err
+    }
+    if waiting { return ctrl.Result{RequeueAfter: registrySAWaitInterval}, nil }
+    return ctrl.Result{}, nil
+}
+func (r *RegistryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+    return ctrl.NewControllerManagedBy(mgr).
+        For(&v1beta1.Registry{}).
+        Owns(&corev1.Secret{}).
+        Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.passwordToRegistries)).
+        Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.namespaceToRegistries)).
+        WithOptions(controller.Options{MaxConcurrentReconciles: 1}).
+        Complete(instrument("Registry", mgr.GetClient(), r))
+}
+
+// namespaceToRegistries enqueues every Registry when a project namespace
+// appears so it gets the pull secrets too.
+func (r *RegistryReconciler) namespaceToRegistries(ctx context.Context, obj client.Object) []reconcile.Request {
+    if obj.GetLabels()["app.kubeop.io/tenant"] == "" { return nil }
+    return r.registryRequests(ctx, func(*v1beta1.Registry) bool { return true })
+}
+
+// passwordToRegistries enqueues the Registries whose passwordRef names obj.
+func (r *RegistryReconciler) passwordToRegistries(ctx context.Context, obj client.Object) []reconcile.Request {
+    return r.registryRequests(ctx, func(reg *v1beta1.Registry) bool {
+        ns, name := registryPasswordRef(reg.Spec.PasswordRef)
+        return ns == obj.GetNamespace() && name == obj.GetName()
+    })
+}
+
+func (r *RegistryReconciler) registryRequests(ctx context.Context, match func(*v1beta1.Registry) bool) []reconcile.Request {
+    var regs v1beta1.RegistryList
+    if err := r.List(ctx, &regs); err != nil { return nil }
+    var reqs []reconcile.Request
+    for i := range regs.Items {
+        if match(&regs.Items[i]) {
+            reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Name: regs.Items[i].Name}})
+        }
+    }
+    return reqs
+}
+
+// registryPassword reads the password passwordRef points at.
+func (r *RegistryReconciler) registryPassword(ctx context.Context, reg *v1beta1.Registry) (string, error) {
+    if reg.Spec.PasswordRef == "" { return "", fmt.Errorf("spec.passwordRef is required with a username") }
+    ns, name := registryPasswordRef(reg.Spec.PasswordRef)
+    var sec corev1.Secret
+    if err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, &sec); err != nil {
+        return "", fmt.Errorf("password secret %s/%s: %w", ns, name, err)
+    }
+    pw, ok := sec.Data[registryPasswordKey]
+    if !ok || len(pw) == 0 { return "", fmt.Errorf("password secret %s/%s has no %q key", ns, name, registryPasswordKey) }
+    return string(pw), nil
+}
+
+// ensurePullSecret creates or updates the pull secret in ns. The Registry
+// controls it so deleting the Registry garbage collects it.
+func (r *RegistryReconciler) ensurePullSecret(ctx context.Context, reg *v1beta1.Registry, ns, name string, config []byte) error {
+    var sec corev1.Secret
+    err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, &sec)
+    if apierrors.IsNotFound(err) {
+        sec = corev1.Secret{
+            ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns, Labels: map[string]string{"app.kubeop.io/registry": reg.Name, ManagedSecretLabel: "registry"}},
+            Type:       corev1.SecretTypeDockerConfigJson,
+            Data:       map[string][]byte{corev1.DockerConfigJsonKey: config},
+        }
+        if err := controllerutil.SetControllerReference(reg, &sec, r.Scheme()); err != nil { return err }
+        return r.Create(ctx, &sec)
+    }
+    if err != nil { return err }
+    if string(sec.Data[corev1.DockerConfigJsonKey]) == string(config) && sec.Labels[ManagedSecretLabel] != "" { return nil }
+    sec.Data = map[string][]byte{corev1.DockerConfigJsonKey: config}
+    if sec.Labels == nil { sec.Labels = map[string]string{} }
+    sec.Labels[ManagedSecretLabel] = "registry"
+    return r.Update(ctx, &sec)
+}
+
+// attachToDefaultSA adds the pull secret to the default ServiceAccount of ns.
+// It reports false while that ServiceAccount does not exist yet.
+func (r *RegistryReconciler) attachToDefaultSA(ctx context.Context, ns, name string) (bool, error) {
+    var sa corev1.ServiceAccount
+    if err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: "default"}, &sa); err != nil {
+        if apierrors.IsNotFound(err) { return false, nil }
+        return false, err
+    }
+    for _, ref := range sa.ImagePullSecrets {
+        if ref.Name == name { return true, nil }
+    }
+    sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+    return true, r.Update(ctx, &sa)
+}
+
+// detachAll removes the pull secret from every namespace and its default
+// ServiceAccount.
+func (r *RegistryReconciler) detachAll(ctx context.Context, nss []corev1.Namespace, name string) error {
+    for _, ns := range nss {
+        var sa corev1.ServiceAccount
+        err := r.Get(ctx, types.NamespacedName{Namespace: ns.Name, Name: "default"}, &sa)
+        if err != nil && !apierrors.IsNotFound(err) { return err }
+        if err == nil {
+            kept := sa.ImagePullSecrets[:0]
+            for _, ref := range sa.ImagePullSecrets {
+                if ref.Name != name { kept = append(kept, ref) }
+            }
+            if len(kept) != len(sa.ImagePullSecrets) {
+                sa.ImagePullSecrets = kept
+                if err := r.Update(ctx, &sa); err != nil { return err }
+            }
+        }
+        sec := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: ns.Name, Name: name}}
+        if err := r.Delete(ctx, sec); err != nil && !apierrors.IsNotFound(err) { return err }
+    }
+    return nil
+}
+
+func registrySecretName(reg *v1beta1.Registry) string { return "kubeop-registry-" + reg.Name }
+
+// registryPasswordRef splits "[namespace/]name".
+func registryPasswordRef(ref string) (string, string) {
+    if ns, name, ok := strings.Cut(ref, "/"); ok { return ns, name }
+    return registryPasswordNamespace, ref
+}
+
+// dockerConfigJSON renders the .dockerconfigjson payload for one registry.
+func dockerConfigJSON(host, username, password string) ([]byte, error) {
+    type entry struct {
+        Username string `json:"username"`
+        Password string `json:"password"`
+        Auth     string `json:"auth"`
+    }
+    return json.Marshal(map[string]map[string]entry{"auths": {host: {
+        Username: username,
+        Password: password,
+        Auth:     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+    }}})
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+    "context"
+    "encoding/json"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_RegistryPullSecrets(t *testing.T) {
+    ctx := context.Background()
+    ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-acme-web", Labels: map[string]string{"app.kubeop.io/tenant": "acme"}}}
+    sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "kubeop-acme-web"}}
+    pw := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ghcr-password", Namespace: "kubeop-system"}, Data: map[string][]byte{"password": []byte("s3cret")}}
+    reg := &v1beta1.Registry{
+        ObjectMeta: metav1.ObjectMeta{Name: "ghcr"},
+        Spec:       v1beta1.RegistrySpec{Host: "ghcr.io", Username: "bot", PasswordRef: "ghcr-password"},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).
+        WithObjects(ns, sa, pw, reg).
+        WithStatusSubresource(&v1beta1.Registry{}).
+        Build()
+    r := &RegistryReconciler{Client: c}
+    req := reconcile.Request{NamespacedName: client.ObjectKey{Name: "ghcr"}}
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+
+    var sec corev1.Secret
+    if err := c.Get(ctx, client.ObjectKey{Namespace: "kubeop-acme-web", Name: "kubeop-registry-ghcr"}, &sec); err != nil { t.Fatal(err) }
+    if sec.Type != corev1.SecretTypeDockerConfigJson { t.Fatalf("unexpected secret type %s", sec.Type) }
+    var cfg struct{ Auths map[string]struct{ Username, Password string } }
+    if err := json.Unmarshal(sec.Data[corev1.DockerConfigJsonKey], &cfg); err != nil { t.Fatal(err) }
+    if a := cfg.Auths["ghcr.io"]; a.Username != "bot" || a.Password != "s3cret" { t.Fatalf("unexpected auth %+v", cfg) }
+    var gotSA corev1.ServiceAccount
+    if err := c.Get(ctx, client.ObjectKeyFromObject(sa), &gotSA); err != nil { t.Fatal(err) }
+    if len(gotSA.ImagePullSecrets) != 1 || gotSA.ImagePullSecrets[0].Name != "kubeop-registry-ghcr" {
+        t.Fatalf("pull secret not attached: %+v", gotSA.ImagePullSecrets)
+    }
+    var got v1beta1.Registry
+    if err := c.Get(ctx, req.NamespacedName, &got); err != nil { t.Fatal(err) }
+    if !got.Status.Ready || len(got.Status.Namespaces) != 1 { t.Fatalf("unexpected status %+v", got.Status) }
+
+    // deletion detaches the secret before releasing the finalizer
+    if err := c.Delete(ctx, &got); err != nil { t.Fatal(err) }
+    if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    if err := c.Get(ctx, client.ObjectKeyFromObject(sa), &gotSA); err != nil { t.Fatal(err) }
+    if len(gotSA.ImagePullSecrets) != 0 { t.Fatalf("pull secret still attached: %+v", gotSA.ImagePullSecrets) }
+    if err := c.Get(ctx, client.ObjectKeyFromObject(&sec), &corev1.Secret{}); !apierrors.IsNotFound(err) { t.Fatalf("expected pull secret deleted: %v", err) }
+    if err := c.Get(ctx, req.NamespacedName, &got); !apierrors.IsNotFound(err) { t.Fatalf("expected registry released: %v", err) }
+}
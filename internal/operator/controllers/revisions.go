@@ -0,0 +1,119 @@
+package controllers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/types"
+    ctrl "sigs.k8s.io/controller-runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// maxAppHistory bounds AppStatus.History and the ControllerRevisions kept.
+const maxAppHistory = 10
+
+// revisionSpec is the spec recorded for a's current revision: rollbackTo is
+// dropped and a Git ref is pinned to the deployed commit, so restoring it
+// redeploys exactly what ran.
+func revisionSpec(a *v1beta1.App) v1beta1.AppSpec {
+    spec := a.Spec
+    spec.RollbackTo = nil
+    if spec.Type == "Git" && spec.Git != nil && a.Status.Revision != "" {
+        git := *spec.Git
+        git.Ref = a.Status.Revision
+        spec.Git = &git
+    }
+    return spec
+}
+
+// recordRevision stores the applied spec of a as a ControllerRevision and
+// appends it to a.Status.History unless it is already the latest entry.
+// Re-applying an older spec, e.g. by a rollback, moves its ControllerRevision
+// to the new number. Entries past maxAppHistory are pruned with their
+// ControllerRevisions.
+func (r *AppReconciler) recordRevision(ctx context.Context, a *v1beta1.App) error {
+    raw, err := json.Marshal(revisionSpec(a))
+    if err != nil { return err }
+    name := fmt.Sprintf("%s-%s", a.Name, computeImageRev(string(raw)))
+    hist := a.Status.History
+    if n := len(hist); n > 0 && hist[n-1].ControllerRevision == name { return nil }
+    number := int64(1)
+    for _, h := range hist {
+        if h.Number >= number { number = h.Number + 1 }
+    }
+
+    cr := &appsv1.ControllerRevision{
+        ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: a.Namespace, Labels: map[string]string{"app.kubeop.io/app": a.Name}},
+        Data:       runtime.RawExtension{Raw: raw},
+        Revision:   number,
+    }
+    if err := controllerutil.SetControllerReference(a, cr, r.Scheme()); err != nil { return err }
+    err = r.Create(ctx, cr)
+    if apierrors.IsAlreadyExists(err) {
+        if err := r.Get(ctx, client.ObjectKeyFromObject(cr), cr); err != nil { return err }
+        cr.Revision = number
+        err = r.Update(ctx, cr)
+    }
+    if err != nil { return fmt.Errorf("record revision %d: %w", number, err) }
+
+    kept := make([]v1beta1.AppRevision, 0, len(hist)+1)
+    for _, h := range hist {
+        if h.ControllerRevision != name { kept = append(kept, h) }
+    }
+    kept = append(kept, v1beta1.AppRevision{Number: number, Revision: a.Status.Revision, ControllerRevision: name, Applied: metav1.Now()})
+    if len(kept) > maxAppHistory {
+        for _, h := range kept[:len(kept)-maxAppHistory] {
+            old := &appsv1.ControllerRevision{ObjectMeta: metav1.ObjectMeta{Name: h.ControllerRevision, Namespace: a.Namespace}}
+            if err := r.Delete(ctx, old); client.IgnoreNotFound(err) != nil { return err }
+        }
+        kept = kept[len(kept)-maxAppHistory:]
+    }
+    a.Status.History = kept
+    return nil
+}
+
+// rollback replaces the spec of a with the one recorded for
+// spec.rollbackTo.revision. The spec update starts a regular reconcile of the
+// restored revision.
+func (r *AppReconciler) rollback(ctx context.Context, a *v1beta1.App) (ctrl.Result, error) {
+    want := a.Spec.RollbackTo.Revision
+    var entry *v1beta1.AppRevision
+    for i := range a.Status.History {
+        if a.Status.History[i].Number == want { entry = &a.Status.History[i] }
+    }
+    if entry == nil { return r.rollbackFailed(ctx, a, fmt.Sprintf("revision %d is not in the history", want)) }
+    var cr appsv1.ControllerRevision
+    err := r.Get(ctx, types.NamespacedName{Namespace: a.Namespace, Name: entry.ControllerRevision}, &cr)
+    if apierrors.IsNotFound(err) { return r.rollbackFailed(ctx, a, fmt.Sprintf("ControllerRevision %s of revision %d is gone", entry.ControllerRevision, want)) }
+    if err != nil { return ctrl.Result{}, err }
+    var spec v1beta1.AppSpec
+    if err := json.Unmarshal(cr.Data.Raw, &spec); err != nil {
+        return r.rollbackFailed(ctx, a, fmt.Sprintf("decode revision %d: %v", want, err))
+    }
+    spec.RollbackTo = nil
+    a.Spec = spec
+    if err := r.Update(ctx, a); err != nil { return ctrl.Result{}, err }
+    msg := fmt.Sprintf("Restored the spec of revision %d", want)
+    recordEvent(r.Recorder, a, corev1.EventTypeNormal, "RolledBack", msg)
+    setCondition(&a.Status.Conditions, "RolledBack", "True", "RolledBack", msg)
+    return ctrl.Result{}, r.Status().Update(ctx, a)
+}
+
+// rollbackFailed drops spec.rollbackTo, so the current spec keeps being
+// served, and reports why.
+func (r *AppReconciler) rollbackFailed(ctx context.Context, a *v1beta1.App, msg string) (ctrl.Result, error) {
+    a.Spec.RollbackTo = nil
+    if err := r.Update(ctx, a); err != nil { return ctrl.Result{}, err }
+    recordEvent(r.Recorder, a, corev1.EventTypeWarning, "RevisionNotFound", msg)
+    setCondition(&a.Status.Conditions, "RolledBack", "False", "RevisionNotFound", msg)
+    return ctrl.Result{}, r.Status().Update(ctx, a)
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+    "context"
+    "fmt"
+    "testing"
+
+    appsv1 "k8s.io/api/apps/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_AppRevisionHistory(t *testing.T) {
+    ctx := context.Background()
+    ns := "kubeop-acme-web"
+    app := &v1beta1.App{
+        ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: ns, Generation: 1},
+        Spec:       v1beta1.AppSpec{Type: "Image", Image: "nginx:1.25"},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(app).
+        WithStatusSubresource(&v1beta1.App{}, &appsv1.Deployment{}).Build()
+    r := &AppReconciler{Client: c}
+    req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(app)}
+    reconcileApp := func() *v1beta1.App {
+        t.Helper()
+        if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+        var cur v1beta1.App
+        if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+        return &cur
+    }
+    update := func(mut func(a *v1beta1.App)) {
+        t.Helper()
+        var cur v1beta1.App
+        if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+        mut(&cur)
+        if err := c.Update(ctx, &cur); err != nil { t.Fatal(err) }
+    }
+    revisions := func() int {
+        var list appsv1.ControllerRevisionList
+        if err := c.List(ctx, &list, client.InNamespace(ns)); err != nil { t.Fatal(err) }
+        return len(list.Items)
+    }
+
+    cur := reconcileApp()
+    if len(cur.Status.History) != 1 || cur.Status.History[0].Number != 1 || cur.Status.History[0].Healthy { t.Fatalf("unexpected history %+v", cur.Status.History) }
+    var cr appsv1.ControllerRevision
+    if err := c.Get(ctx, types.NamespacedName{Namespace: ns, Name: cur.Status.History[0].ControllerRevision}, &cr); err != nil { t.Fatal(err) }
+    if ref := metav1.GetControllerOf(&cr); ref == nil || ref.Name != "web" { t.Fatalf("revision not owned by the App: %+v", cr.OwnerReferences) }
+
+    var d appsv1.Deployment
+    if err := c.Get(ctx, types.NamespacedName{Namespace: ns, Name: "app-web"}, &d); err != nil { t.Fatal(err) }
+    d.Status = appsv1.DeploymentStatus{ObservedGeneration: d.Generation, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+    if err := c.Status().Update(ctx, &d); err != nil { t.Fatal(err) }
+    if cur = reconcileApp(); len(cur.Status.History) != 1 || !cur.Status.History[0].Healthy { t.Fatalf("expected a healthy revision, got %+v", cur.Status.History) }
+
+    update(func(a *v1beta1.App) { a.Spec.Image = "nginx:1.27" })
+    reconcileApp()
+    if cur = reconcileApp(); len(cur.Status.History) != 2 || cur.Status.History[1].Number != 2 { t.Fatalf("unexpected history %+v", cur.Status.History) }
+
+    update(func(a *v1beta1.App) { a.Spec.RollbackTo = &v1beta1.RollbackConfig{Revision: 1} })
+    cur = reconcileApp()
+    if cur.Spec.Image != "nginx:1.25" || cur.Spec.RollbackTo != nil { t.Fatalf("spec not restored: %+v", cur.Spec) }
+    if cond := findCondition(cur.Status.Conditions, "RolledBack"); cond == nil || cond.Status != "True" { t.Fatalf("unexpected condition %+v", cond) }
+    // the restored spec is applied again as revision 3
+    cur = reconcileApp()
+    if h := cur.Status.History; len(h) != 2 || h[0].Number != 2 || h[1].Number != 3 || h[1].ControllerRevision != cr.Name { t.Fatalf("unexpected history %+v", h) }
+
+    update(func(a *v1beta1.App) { a.Spec.RollbackTo = &v1beta1.RollbackConfig{Revision: 1} })
+    cur = reconcileApp()
+    if cur.Spec.Image != "nginx:1.25" || cur.Spec.RollbackTo != nil { t.Fatalf("unexpected spec %+v", cur.Spec) }
+    if cond := findCondition(cur.Status.Conditions, "RolledBack"); cond == nil || cond.Reason != "RevisionNotFound" { t.Fatalf("unexpected condition %+v", cond) }
+
+    for i := 0; i < maxAppHistory+2; i++ {
+        update(func(a *v1beta1.App) { a.Spec.Image = fmt.Sprintf("nginx:1.%d", 30+i) })
+        reconcileApp()
+    }
+    cur = reconcileApp()
+    if len(cur.Status.History) != maxAppHistory || revisions() != maxAppHistory { t.Fatalf("expected %d revisions, got %d entries and %d objects", maxAppHistory, len(cur.Status.History), revisions()) }
+    if last := cur.Status.History[maxAppHistory-1]; last.Number != 15 { t.Fatalf("unexpected latest revision %+v", last) }
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+    "context"
+    "fmt"
+
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// podFailureReasons are container waiting reasons that keep a rollout from
+// completing without intervention.
+var podFailureReasons = map[string]bool{
+    "ErrImagePull":               true,
+    "ImagePullBackOff":           true,
+    "InvalidImageName":           true,
+    "CrashLoopBackOff":           true,
+    "CreateContainerConfigError": true,
+    "CreateContainerError":       true,
+}
+
+// rolloutStatus records the replica counts of dep in a.Status and reports
+// whether its rollout is complete. Otherwise the returned reason is the
+// rollout failure when one is known, e.g. ProgressDeadlineExceeded or
+// ImagePullBackOff, and Progressing while the rollout is still moving.
+func (r *AppReconciler) rolloutStatus(ctx context.Context, a *v1beta1.App, dep *appsv1.Deployment) (bool, string, string, error) {
+    a.Status.DesiredReplicas = desiredReplicas(dep)
+    a.Status.ReadyReplicas = dep.Status.ReadyReplicas
+    return r.deploymentHealth(ctx, dep)
+}
+
+// deploymentHealth reports whether the rollout of dep is complete, and
+// otherwise why not, as described for rolloutStatus.
+func (r *AppReconciler) deploymentHealth(ctx context.Context, dep *appsv1.Deployment) (bool, string, string, error) {
+    want := desiredReplicas(dep)
+    if rolloutComplete(dep) { return true, "", "", nil }
+    for _, c := range dep.Status.Conditions {
+        if c.Type == appsv1.DeploymentProgressing && c.Status == corev1.ConditionFalse && c.Reason == "ProgressDeadlineExceeded" {
+            return false, c.Reason, c.Message, nil
+        }
+        if c.Type == appsv1.DeploymentReplicaFailure && c.Status == corev1.ConditionTrue {
+            return false, c.Reason, c.Message, nil
+        }
+    }
+    if dep.Spec.Selector != nil {
+        var pods corev1.PodList
+        if err := r.List(ctx, &pods, client.InNamespace(dep.Namespace), client.MatchingLabels(dep.Spec.Selector.MatchLabels)); err != nil {
+            return false, "", "", err
+        }
+        for _, p := range pods.Items {
+            for _, cs := range append(p.Status.InitContainerStatuses, p.Status.ContainerStatuses...) {
+                if w := cs.State.Waiting; w != nil && podFailureReasons[w.Reason] {
+                    return false, w.Reason, fmt.Sprintf("pod %s container %s: %s", p.Name, cs.Name, w.Message), nil
+                }
+            }
+        }
+    }
+    return false, "Progressing", fmt.Sprintf("Waiting for rollout: %d/%d replicas ready", dep.Status.ReadyReplicas, want), nil
+}
+
+func desiredReplicas(dep *appsv1.Deployment) int32 {
+    if dep.Spec.Replicas != nil { return *dep.Spec.Replicas }
+    return 1
+}
+
+// podToApp enqueues the App a pod belongs to, so container failures that do
+// not change the Deployment status are still reported.
+func podToApp(_ context.Context, obj client.Object) []reconcile.Request {
+    name := obj.GetLabels()["app.kubeop.io/app"]
+    if name == "" { return nil }
+    return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+    "context"
+    "testing"
+
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_AppRolloutStatus(t *testing.T) {
+    ctx := context.Background()
+    ns := "kubeop-acme-web"
+    app := &v1beta1.App{
+        ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: ns, Generation: 3},
+        Spec:       v1beta1.AppSpec{Type: "Image", Image: "nginx:1.27"},
+    }
+    // created before Apps owned their Deployments
+    replicas := int32(1)
+    labels := map[string]string{"app.kubeop.io/app": "web"}
+    legacy := &appsv1.Deployment{
+        ObjectMeta: metav1.ObjectMeta{Name: "app-web", Namespace: ns},
+        Spec: appsv1.DeploymentSpec{Replicas: &replicas, Selector: &metav1.LabelSelector{MatchLabels: labels}, Template: corev1.PodTemplateSpec{
+            ObjectMeta: metav1.ObjectMeta{Labels: labels},
+            Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "nginx:1.25"}}},
+        }},
+    }
+    pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app-web-1", Namespace: ns, Labels: labels}}
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(app, legacy, pod).
+        WithStatusSubresource(&v1beta1.App{}, &appsv1.Deployment{}, &corev1.Pod{}).Build()
+    r := &AppReconciler{Client: c}
+    req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(app)}
+    get := func() *v1beta1.App {
+        var cur v1beta1.App
+        if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+        return &cur
+    }
+    dep := func() *appsv1.Deployment {
+        var d appsv1.Deployment
+        if err := c.Get(ctx, client.ObjectKeyFromObject(legacy), &d); err != nil { t.Fatal(err) }
+        return &d
+    }
+    expect := func(reason string) {
+        t.Helper()
+        res, err := r.Reconcile(ctx, req)
+        if err != nil { t.Fatal(err) }
+        if res.RequeueAfter != 0 { t.Fatalf("expected no polling, got %+v", res) }
+        cur := get()
+        cond := findCondition(cur.Status.Conditions, "Ready")
+        if cond == nil || cond.Reason != reason { t.Fatalf("expected reason %s, got %+v", reason, cond) }
+        if cur.Status.ObservedGeneration != 3 || cur.Status.DesiredReplicas != 1 { t.Fatalf("unexpected status %+v", cur.Status) }
+    }
+
+    expect("Progressing")
+    if ref := metav1.GetControllerOf(dep()); ref == nil || ref.Kind != "App" || ref.Name != "web" { t.Fatalf("deployment not adopted: %+v", dep().OwnerReferences) }
+
+    pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}}}}
+    if err := c.Status().Update(ctx, pod); err != nil { t.Fatal(err) }
+    expect("ImagePullBackOff")
+    if msg := findCondition(get().Status.Conditions, "Ready").Message; msg != "pod app-web-1 container app: Back-off pulling image" { t.Fatalf("unexpected message %q", msg) }
+
+    d := dep()
+    d.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded", Message: "ReplicaSet has timed out progressing"}}
+    if err := c.Status().Update(ctx, d); err != nil { t.Fatal(err) }
+    expect("ProgressDeadlineExceeded")
+
+    d = dep()
+    d.Status = appsv1.DeploymentStatus{ObservedGeneration: d.Generation, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+    if err := c.Status().Update(ctx, d); err != nil { t.Fatal(err) }
+    expect("Converged")
+    if cur := get(); !cur.Status.Ready || cur.Status.ReadyReplicas != 1 { t.Fatalf("unexpected status %+v", cur.Status) }
+
+    if reqs := podToApp(ctx, pod); len(reqs) != 1 || reqs[0].NamespacedName != req.NamespacedName { t.Fatalf("unexpected requests %v", reqs) }
+}
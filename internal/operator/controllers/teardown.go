@@ -0,0 +1,74 @@
+package controllers
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/types"
+    ctrl "sigs.k8s.io/controller-runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+    "sigs.k8s.io/controller-runtime/pkg/log"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// projectFinalizer holds a deleted Project until its namespace is gone.
+const projectFinalizer = "paas.kubeop.io/project-teardown"
+
+// teardownPollInterval is how often teardown progress is re-checked.
+const teardownPollInterval = 5 * time.Second
+
+func projectNamespace(p *v1beta1.Project) string {
+    return fmt.Sprintf("kubeop-%s-%s", p.Spec.TenantRef, p.Spec.Name)
+}
+
+// teardown drains a deleted Project: Apps in its namespace are deleted first
+// so their own finalizers (e.g. Helm uninstall) can run, then the namespace is
+// deleted and awaited. Each step is reported as a Deleting condition and the
+// finalizer is only released once the namespace no longer exists.
+func (r *ProjectReconciler) teardown(ctx context.Context, p *v1beta1.Project) (ctrl.Result, error) {
+    if !controllerutil.ContainsFinalizer(p, projectFinalizer) { return ctrl.Result{}, nil }
+    lg := log.FromContext(ctx)
+    nsName := projectNamespace(p)
+
+    var ns corev1.Namespace
+    err := r.Get(ctx, types.NamespacedName{Name: nsName}, &ns)
+    if err != nil && !apierrors.IsNotFound(err) { return ctrl.Result{}, err }
+    // never touch a namespace this Project does not own
+    owned := err == nil && ns.Labels["app.kubeop.io/tenant"] == p.Spec.TenantRef && ns.Labels["app.kubeop.io/project"] == p.Spec.Name
+    if err == nil && !owned {
+        lg.Info("namespace not labelled for project, leaving it in place", "namespace", nsName)
+    }
+    if !owned {
+        controllerutil.RemoveFinalizer(p, projectFinalizer)
+        return ctrl.Result{}, r.Update(ctx, p)
+    }
+
+    if ns.DeletionTimestamp.IsZero() {
+        var apps v1beta1.AppList
+        if err := r.List(ctx, &apps, client.InNamespace(nsName)); err != nil { return ctrl.Result{}, err }
+        if len(apps.Items) > 0 {
+            for i := range apps.Items {
+                if !apps.Items[i].DeletionTimestamp.IsZero() { continue }
+                if err := r.Delete(ctx, &apps.Items[i]); client.IgnoreNotFound(err) != nil { return ctrl.Result{}, err }
+            }
+            return r.teardownProgress(ctx, p, "DrainingApps", fmt.Sprintf("Waiting for %d app(s) in %s to be deleted", len(apps.Items), nsName))
+        }
+        if err := r.Delete(ctx, &ns); client.IgnoreNotFound(err) != nil { return ctrl.Result{}, err }
+        return r.teardownProgress(ctx, p, "DeletingNamespace", "Deleting namespace "+nsName)
+    }
+    return r.teardownProgress(ctx, p, "WaitingForNamespace", "Waiting for namespace "+nsName+" to terminate")
+}
+
+func (r *ProjectReconciler) teardownProgress(ctx context.Context, p *v1beta1.Project, reason, msg string) (ctrl.Result, error) {
+    if conditionChanged(p.Status.Conditions, "Deleting", "True", reason) { recordEvent(r.Recorder, p, corev1.EventTypeNormal, reason, msg) }
+    setCondition(&p.Status.Conditions, "Deleting", "True", reason, msg)
+    setCondition(&p.Status.Conditions, "Ready", "False", "Deleting", msg)
+    p.Status.Ready = false
+    if err := r.Status().Update(ctx, p); err != nil { return ctrl.Result{}, err }
+    return ctrl.Result{RequeueAfter: teardownPollInterval}, nil
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+    "context"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_ProjectTeardown(t *testing.T) {
+    ctx := context.Background()
+    now := metav1.Now()
+    p := &v1beta1.Project{
+        ObjectMeta: metav1.ObjectMeta{Name: "acme-web", DeletionTimestamp: &now, Finalizers: []string{projectFinalizer}},
+        Spec:       v1beta1.ProjectSpec{TenantRef: "acme", Name: "web"},
+    }
+    ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-acme-web", Labels: map[string]string{
+        "app.kubeop.io/tenant": "acme", "app.kubeop.io/project": "web",
+    }}}
+    app := &v1beta1.App{ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "kubeop-acme-web"}}
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).
+        WithObjects(p, ns, app).
+        WithStatusSubresource(&v1beta1.Project{}).
+        Build()
+    r := &ProjectReconciler{Client: c}
+
+    steps := []string{"DrainingApps", "DeletingNamespace"}
+    for _, want := range steps {
+        var cur v1beta1.Project
+        if err := c.Get(ctx, client.ObjectKey{Name: "acme-web"}, &cur); err != nil { t.Fatal(err) }
+        res, err := r.teardown(ctx, &cur)
+        if err != nil { t.Fatalf("%s: %v", want, err) }
+        if res.RequeueAfter == 0 { t.Fatalf("%s: expected requeue", want) }
+        if cond := findCondition(cur.Status.Conditions, "Deleting"); cond == nil || cond.Reason != want {
+            t.Fatalf("expected Deleting condition with reason %s, got %+v", want, cond)
+        }
+    }
+    if err := c.Get(ctx, client.ObjectKeyFromObject(app), &v1beta1.App{}); !apierrors.IsNotFound(err) { t.Fatalf("expected app to be deleted: %v", err) }
+
+    var cur v1beta1.Project
+    if err := c.Get(ctx, client.ObjectKey{Name: "acme-web"}, &cur); err != nil { t.Fatal(err) }
+    if _, err := r.teardown(ctx, &cur); err != nil { t.Fatal(err) }
+    if err := c.Get(ctx, client.ObjectKey{Name: "acme-web"}, &v1beta1.Project{}); !apierrors.IsNotFound(err) {
+        t.Fatalf("expected project to be released once the namespace is gone: %v", err)
+    }
+}
+
+func findCondition(conds []v1beta1.Condition, t string) *v1beta1.Condition {
+    for i := range conds {
+        if conds[i].Type == t { return &conds[i] }
+    }
+    return nil
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/types"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    "github.com/vaheed/kubeop/internal/kube"
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// tenantUsageInterval is how often tenant quota usage is re-aggregated, and
+// how often a project blocked by its tenant's limits retries.
+const tenantUsageInterval = time.Minute
+
+// projectToTenant enqueues the Tenant a Project belongs to.
+func projectToTenant(_ context.Context, obj client.Object) []reconcile.Request {
+    p, ok := obj.(*v1beta1.Project)
+    if !ok || p.Spec.TenantRef == "" { return nil }
+    return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: p.Spec.TenantRef}}}
+}
+
+// tenantAllocated sums the kubeop-quota hard limits of every namespace of the
+// tenant, except the one named exclude.
+func tenantAllocated(ctx context.Context, c client.Client, tenant, exclude string) (corev1.ResourceList, error) {
+    var nss corev1.NamespaceList
+    if err := c.List(ctx, &nss, client.MatchingLabels{"app.kubeop.io/tenant": tenant}); err != nil { return nil, err }
+    total := corev1.ResourceList{}
+    for _, ns := range nss.Items {
+        if ns.Name == exclude { continue }
+        var rq corev1.ResourceQuota
+        if err := c.Get(ctx, types.NamespacedName{Namespace: ns.Name, Name: "kubeop-quota"}, &rq); err != nil {
+            if apierrors.IsNotFound(err) { continue }
+            return nil, err
+        }
+        total = kube.AddResources(total, rq.Spec.Hard)
+    }
+    return total, nil
+}
+
+// checkTenantLimits returns a non-empty message when giving p the project
+// quota hard would push the tenant past spec.limits.
+func (r *ProjectReconciler) checkTenantLimits(ctx context.Context, p *v1beta1.Project, hard corev1.ResourceList) (string, error) {
+    var t v1beta1.Tenant
+    if err := r.Get(ctx, types.NamespacedName{Name: p.Spec.TenantRef}, &t); err != nil {
+        return "", client.IgnoreNotFound(err)
+    }
+    if len(t.Spec.Limits) == 0 { return "", nil }
+    allocated, err := tenantAllocated(ctx, r.Client, t.Name, projectNamespace(p))
+    if err != nil { return "", err }
+    if over := kube.ExceededResources(kube.AddResources(allocated, hard), t.Spec.Limits); len(over) > 0 {
+        return fmt.Sprintf("tenant %s has no room for another project quota: %v would exceed its limits", t.Name, over), nil
+    }
+    return "", nil
+}
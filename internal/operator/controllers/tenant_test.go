@@ -0,0 +1,67 @@
+package controllers
+
+import (
+    "context"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_TenantStatusAndLimits(t *testing.T) {
+    ctx := context.Background()
+    tenant := &v1beta1.Tenant{
+        ObjectMeta: metav1.ObjectMeta{Name: "acme"},
+        Spec:       v1beta1.TenantSpec{Name: "acme", Limits: corev1.ResourceList{corev1.ResourceRequestsCPU: resourceMust("1500m")}},
+    }
+    labels := map[string]string{"app.kubeop.io/tenant": "acme"}
+    web := &v1beta1.Project{
+        ObjectMeta: metav1.ObjectMeta{Name: "acme-web", Labels: labels},
+        Spec:       v1beta1.ProjectSpec{TenantRef: "acme", Name: "web"},
+        Status:     v1beta1.ProjectStatus{Namespace: "kubeop-acme-web", Ready: true},
+    }
+    api := &v1beta1.Project{
+        ObjectMeta: metav1.ObjectMeta{Name: "acme-api", Labels: labels},
+        Spec:       v1beta1.ProjectSpec{TenantRef: "acme", Name: "api"},
+    }
+    ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kubeop-acme-web", Labels: labels}}
+    rq := &corev1.ResourceQuota{
+        ObjectMeta: metav1.ObjectMeta{Name: "kubeop-quota", Namespace: "kubeop-acme-web"},
+        Spec:       corev1.ResourceQuotaSpec{Hard: projectQuota()},
+        Status:     corev1.ResourceQuotaStatus{Used: corev1.ResourceList{corev1.ResourceRequestsCPU: resourceMust("250m")}},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).
+        WithObjects(tenant, web, api, ns, rq).
+        WithStatusSubresource(&v1beta1.Tenant{}, &v1beta1.Project{}).
+        Build()
+
+    tr := &TenantReconciler{Client: c}
+    if _, err := tr.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKey{Name: "acme"}}); err != nil { t.Fatal(err) }
+    var got v1beta1.Tenant
+    if err := c.Get(ctx, client.ObjectKey{Name: "acme"}, &got); err != nil { t.Fatal(err) }
+    if got.Status.Projects != 2 || got.Status.ReadyProjects != 1 || got.Status.NotReadyProjects != 1 {
+        t.Fatalf("unexpected project counts: %+v", got.Status)
+    }
+    if cpu := got.Status.Allocated[corev1.ResourceRequestsCPU]; cpu.String() != "1" { t.Fatalf("allocated cpu = %s", cpu.String()) }
+    if cpu := got.Status.Used[corev1.ResourceRequestsCPU]; cpu.String() != "250m" { t.Fatalf("used cpu = %s", cpu.String()) }
+    if cond := findCondition(got.Status.Conditions, "WithinLimits"); cond == nil || cond.Status != "True" {
+        t.Fatalf("expected WithinLimits=True, got %+v", cond)
+    }
+
+    // a second 1 CPU project quota does not fit in 1500m
+    pr := &ProjectReconciler{Client: c}
+    if _, err := pr.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKey{Name: "acme-api"}}); err != nil { t.Fatal(err) }
+    var p v1beta1.Project
+    if err := c.Get(ctx, client.ObjectKey{Name: "acme-api"}, &p); err != nil { t.Fatal(err) }
+    if cond := findCondition(p.Status.Conditions, "Ready"); cond == nil || cond.Reason != "TenantLimitExceeded" {
+        t.Fatalf("expected TenantLimitExceeded, got %+v", cond)
+    }
+    if err := c.Get(ctx, client.ObjectKey{Name: "kubeop-acme-api"}, &corev1.Namespace{}); err == nil {
+        t.Fatalf("namespace must not be created past the tenant limits")
+    }
+}
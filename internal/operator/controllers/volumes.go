@@ -0,0 +1,154 @@
+package controllers
+
+import (
+    "context"
+    "fmt"
+
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/equality"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// volumesFinalizer makes deleting an App with retained volumes release their
+// claims before the garbage collector removes owned ones.
+const volumesFinalizer = "paas.kubeop.io/volumes"
+
+// retentionLabel records the retention policy of a volume on its claim, so
+// it still applies once the volume is removed from the spec.
+const retentionLabel = "app.kubeop.io/retention"
+
+// Retention policies for Volume.RetentionPolicy.
+const (
+    RetentionDelete = "Delete"
+    RetentionRetain = "Retain"
+)
+
+func claimName(a *v1beta1.App, v v1beta1.Volume) string { return "app-" + a.Name + "-" + v.Name }
+
+func retention(v v1beta1.Volume) string {
+    if v.RetentionPolicy == RetentionRetain { return RetentionRetain }
+    return RetentionDelete
+}
+
+func accessMode(v v1beta1.Volume) corev1.PersistentVolumeAccessMode {
+    if v.AccessMode == "" { return corev1.ReadWriteOnce }
+    return v.AccessMode
+}
+
+// retainsVolumes reports whether a has a volume to keep after deletion.
+func retainsVolumes(a *v1beta1.App) bool {
+    for _, v := range a.Spec.Volumes {
+        if retention(v) == RetentionRetain { return true }
+    }
+    return false
+}
+
+// podVolumes mounts the claims of a into the App pods.
+func podVolumes(a *v1beta1.App) []corev1.Volume {
+    var out []corev1.Volume
+    for _, v := range a.Spec.Volumes {
+        out = append(out, corev1.Volume{Name: v.Name, VolumeSource: corev1.VolumeSource{
+            PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName(a, v)},
+        }})
+    }
+    return out
+}
+
+func volumeMounts(a *v1beta1.App) []corev1.VolumeMount {
+    var out []corev1.VolumeMount
+    for _, v := range a.Spec.Volumes {
+        out = append(out, corev1.VolumeMount{Name: v.Name, MountPath: v.MountPath})
+    }
+    return out
+}
+
+// deploymentStrategy recreates the pods of Apps with single-node volumes, as
+// a surge pod could not attach them while the old pod holds them.
+func deploymentStrategy(a *v1beta1.App) appsv1.DeploymentStrategy {
+    for _, v := range a.Spec.Volumes {
+        if m := accessMode(v); m == corev1.ReadWriteOnce || m == corev1.ReadWriteOncePod {
+            return appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+        }
+    }
+    return appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType}
+}
+
+// reconcileVolumes ensures a claim for every volume of a. Claims of removed
+// volumes are deleted, or released when they are retained.
+func (r *AppReconciler) reconcileVolumes(ctx context.Context, a *v1beta1.App) error {
+    want := map[string]bool{}
+    for _, v := range a.Spec.Volumes {
+        want[claimName(a, v)] = true
+        if err := r.ensureClaim(ctx, a, v); err != nil { return fmt.Errorf("volume %s: %w", v.Name, err) }
+    }
+    var claims corev1.PersistentVolumeClaimList
+    if err := r.List(ctx, &claims, client.InNamespace(a.Namespace), client.MatchingLabels{"app.kubeop.io/app": a.Name}); err != nil { return err }
+    for i := range claims.Items {
+        pvc := &claims.Items[i]
+        if want[pvc.Name] || !metav1.IsControlledBy(pvc, a) { continue }
+        if pvc.Labels[retentionLabel] == RetentionRetain {
+            if err := r.releaseClaim(ctx, a, pvc); err != nil { return err }
+            continue
+        }
+        if err := r.Delete(ctx, pvc); client.IgnoreNotFound(err) != nil { return err }
+    }
+    return nil
+}
+
+// ensureClaim creates the claim of v, adopting a retained one of an earlier
+// App with the same name. Only growing the size is applied to an existing
+// claim; the storage class and access mode are immutable.
+func (r *AppReconciler) ensureClaim(ctx context.Context, a *v1beta1.App, v v1beta1.Volume) error {
+    var pvc corev1.PersistentVolumeClaim
+    err := r.Get(ctx, types.NamespacedName{Namespace: a.Namespace, Name: claimName(a, v)}, &pvc)
+    if apierrors.IsNotFound(err) {
+        pvc = corev1.PersistentVolumeClaim{ObjectMeta: appObjectMeta(a, claimName(a, v)), Spec: corev1.PersistentVolumeClaimSpec{
+            AccessModes:      []corev1.PersistentVolumeAccessMode{accessMode(v)},
+            StorageClassName: v.StorageClassName,
+            Resources:        corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: v.Size}},
+        }}
+        pvc.Labels[retentionLabel] = retention(v)
+        if err := controllerutil.SetControllerReference(a, &pvc, r.Scheme()); err != nil { return err }
+        return r.Create(ctx, &pvc)
+    }
+    if err != nil { return err }
+    current := pvc.DeepCopy()
+    if err := controllerutil.SetControllerReference(a, &pvc, r.Scheme()); err != nil { return err }
+    if pvc.Labels == nil { pvc.Labels = map[string]string{} }
+    pvc.Labels["app.kubeop.io/app"] = a.Name
+    pvc.Labels[retentionLabel] = retention(v)
+    if size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; v.Size.Cmp(size) > 0 {
+        if pvc.Spec.Resources.Requests == nil { pvc.Spec.Resources.Requests = corev1.ResourceList{} }
+        pvc.Spec.Resources.Requests[corev1.ResourceStorage] = v.Size
+    }
+    if equality.Semantic.DeepEqual(current, &pvc) { return nil }
+    return r.Update(ctx, &pvc)
+}
+
+// releaseClaim drops the owner reference to a, so the claim outlives it.
+func (r *AppReconciler) releaseClaim(ctx context.Context, a *v1beta1.App, pvc *corev1.PersistentVolumeClaim) error {
+    var refs []metav1.OwnerReference
+    for _, ref := range pvc.OwnerReferences {
+        if ref.UID != a.UID { refs = append(refs, ref) }
+    }
+    pvc.OwnerReferences = refs
+    return r.Update(ctx, pvc)
+}
+
+// releaseVolumes releases the retained claims of a deleted App.
+func (r *AppReconciler) releaseVolumes(ctx context.Context, a *v1beta1.App) error {
+    var claims corev1.PersistentVolumeClaimList
+    if err := r.List(ctx, &claims, client.InNamespace(a.Namespace), client.MatchingLabels{"app.kubeop.io/app": a.Name, retentionLabel: RetentionRetain}); err != nil { return err }
+    for i := range claims.Items {
+        if !metav1.IsControlledBy(&claims.Items[i], a) { continue }
+        if err := r.releaseClaim(ctx, a, &claims.Items[i]); err != nil { return err }
+    }
+    return nil
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+    "context"
+    "testing"
+
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_AppVolumes(t *testing.T) {
+    ctx := context.Background()
+    ns := "kubeop-acme-web"
+    data := v1beta1.Volume{Name: "data", MountPath: "/data", Size: resource.MustParse("1Gi"), RetentionPolicy: RetentionRetain}
+    cache := v1beta1.Volume{Name: "cache", MountPath: "/cache", Size: resource.MustParse("1Gi"), AccessMode: corev1.ReadWriteMany}
+    app := &v1beta1.App{
+        ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: ns, UID: "web-1", Generation: 1},
+        Spec:       v1beta1.AppSpec{Type: "Image", Image: "nginx:1.27", Workload: v1beta1.Workload{Volumes: []v1beta1.Volume{data, cache}}},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(app).
+        WithStatusSubresource(&v1beta1.App{}, &appsv1.Deployment{}).Build()
+    r := &AppReconciler{Client: c}
+    req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(app)}
+    reconcileApp := func() {
+        t.Helper()
+        if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+    }
+    update := func(mut func(a *v1beta1.App)) {
+        t.Helper()
+        var cur v1beta1.App
+        if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+        mut(&cur)
+        if err := c.Update(ctx, &cur); err != nil { t.Fatal(err) }
+    }
+    claim := func(name string) (*corev1.PersistentVolumeClaim, error) {
+        var pvc corev1.PersistentVolumeClaim
+        err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: name}, &pvc)
+        return &pvc, err
+    }
+
+    reconcileApp()
+    pvc, err := claim("app-web-data")
+    if err != nil { t.Fatal(err) }
+    if !metav1.IsControlledBy(pvc, app) || pvc.Labels[retentionLabel] != RetentionRetain || pvc.Spec.AccessModes[0] != corev1.ReadWriteOnce { t.Fatalf("unexpected claim %+v", pvc) }
+    if pvc, err = claim("app-web-cache"); err != nil || pvc.Spec.AccessModes[0] != corev1.ReadWriteMany { t.Fatalf("unexpected cache claim %+v: %v", pvc, err) }
+    var d appsv1.Deployment
+    if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: "app-web"}, &d); err != nil { t.Fatal(err) }
+    if v := d.Spec.Template.Spec.Volumes; len(v) != 2 || v[0].PersistentVolumeClaim.ClaimName != "app-web-data" { t.Fatalf("unexpected pod volumes %+v", v) }
+    if m := d.Spec.Template.Spec.Containers[0].VolumeMounts; len(m) != 2 || m[0].MountPath != "/data" { t.Fatalf("unexpected mounts %+v", m) }
+    if d.Spec.Strategy.Type != appsv1.RecreateDeploymentStrategyType { t.Fatalf("ReadWriteOnce volumes need Recreate, got %s", d.Spec.Strategy.Type) }
+    var cur v1beta1.App
+    if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+    if !controllerutil.ContainsFinalizer(&cur, volumesFinalizer) { t.Fatalf("expected the volumes finalizer") }
+
+    // claims only grow
+    update(func(a *v1beta1.App) { a.Spec.Volumes[0].Size = resource.MustParse("2Gi"); a.Spec.Volumes[1].Size = resource.MustParse("512Mi") })
+    reconcileApp()
+    if pvc, _ = claim("app-web-data"); pvc.Spec.Resources.Requests.Storage().String() != "2Gi" { t.Fatalf("claim not expanded: %s", pvc.Spec.Resources.Requests.Storage()) }
+    if pvc, _ = claim("app-web-cache"); pvc.Spec.Resources.Requests.Storage().String() != "1Gi" { t.Fatalf("claim shrunk: %s", pvc.Spec.Resources.Requests.Storage()) }
+
+    // removed volumes are deleted unless retained
+    update(func(a *v1beta1.App) { a.Spec.Volumes = nil })
+    reconcileApp()
+    if _, err := claim("app-web-cache"); !apierrors.IsNotFound(err) { t.Fatalf("expected the cache claim to be deleted, got %v", err) }
+    if pvc, err = claim("app-web-data"); err != nil || len(pvc.OwnerReferences) != 0 { t.Fatalf("expected the data claim to be released %+v: %v", pvc, err) }
+    if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: "app-web"}, &d); err != nil { t.Fatal(err) }
+    if len(d.Spec.Template.Spec.Volumes) != 0 || d.Spec.Strategy.Type != appsv1.RollingUpdateDeploymentStrategyType { t.Fatalf("unexpected deployment %+v", d.Spec) }
+
+    // a retained claim is adopted again, and released when the App is deleted
+    update(func(a *v1beta1.App) { a.Spec.Volumes = []v1beta1.Volume{data} })
+    reconcileApp()
+    if pvc, _ = claim("app-web-data"); !metav1.IsControlledBy(pvc, app) { t.Fatalf("expected the data claim to be adopted") }
+    if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+    if err := c.Delete(ctx, &cur); err != nil { t.Fatal(err) }
+    reconcileApp()
+    if pvc, _ = claim("app-web-data"); len(pvc.OwnerReferences) != 0 { t.Fatalf("expected the data claim to outlive the App") }
+    if err := c.Get(ctx, req.NamespacedName, &cur); !apierrors.IsNotFound(err) { t.Fatalf("expected the App to be gone, got %v", err) }
+}
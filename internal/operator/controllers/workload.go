@@ -0,0 +1,58 @@
+package controllers
+
+import (
+    "encoding/json"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/equality"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+// imageContainer is the container an Image App runs.
+func imageContainer(a *v1beta1.App) corev1.Container {
+    w := a.Spec.Workload
+    ports := w.Ports
+    if len(ports) == 0 { ports = []corev1.ContainerPort{{ContainerPort: appPort}} }
+    return corev1.Container{
+        Name:           "app",
+        Image:          a.Spec.Image,
+        Command:        w.Command,
+        Args:           w.Args,
+        Ports:          ports,
+        Env:            w.Env,
+        EnvFrom:        w.EnvFrom,
+        Resources:      w.Resources,
+        LivenessProbe:  w.LivenessProbe,
+        ReadinessProbe: w.ReadinessProbe,
+        VolumeMounts:   volumeMounts(a),
+    }
+}
+
+// imageReplicas is the replica count of a; autoscaled Apps start at their
+// minimum.
+func imageReplicas(a *v1beta1.App) int32 {
+    if autoscaled(a) && a.Spec.Autoscaling.MinReplicas != nil { return *a.Spec.Autoscaling.MinReplicas }
+    if !autoscaled(a) && a.Spec.Replicas != nil { return *a.Spec.Replicas }
+    return 1
+}
+
+// targetPort is the container port the App Service forwards to.
+func targetPort(a *v1beta1.App) int32 {
+    if len(a.Spec.Ports) > 0 { return a.Spec.Ports[0].ContainerPort }
+    return appPort
+}
+
+// imageRevision identifies the pod template of an Image App. Apps that only
+// set an image keep the image hash as their revision; otherwise the workload
+// fields are hashed too, leaving out the replica count.
+func imageRevision(a *v1beta1.App) string {
+    w := a.Spec.Workload
+    w.Replicas = nil
+    if equality.Semantic.DeepEqual(w, v1beta1.Workload{}) { return computeImageRev(a.Spec.Image) }
+    raw, _ := json.Marshal(struct {
+        Image string `json:"image"`
+        v1beta1.Workload
+    }{a.Spec.Image, w})
+    return computeImageRev(string(raw))
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+    "context"
+    "testing"
+
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/util/intstr"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+    v1beta1 "github.com/vaheed/kubeop/internal/operator/apis/paas/v1beta1"
+)
+
+func Test_AppWorkload(t *testing.T) {
+    ctx := context.Background()
+    ns := "kubeop-acme-web"
+    replicas := int32(3)
+    app := &v1beta1.App{
+        ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: ns, Generation: 1},
+        Spec: v1beta1.AppSpec{Type: "Image", Image: "ghcr.io/acme/web:1.0", Host: "web.example.com", Workload: v1beta1.Workload{
+            Replicas: &replicas,
+            Ports:    []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+            Command:  []string{"/web"},
+            Args:     []string{"--listen=:8080"},
+            Env: []corev1.EnvVar{
+                {Name: "MODE", Value: "production"},
+                {Name: "DB_PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}, Key: "password"}}},
+            },
+            EnvFrom:        []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "web-config"}}}},
+            Resources:      corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}, Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")}},
+            ReadinessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromString("http")}}},
+            LivenessProbe:  &corev1.Probe{ProbeHandler: corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(8080)}}, PeriodSeconds: 20},
+        }},
+    }
+    c := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(app).
+        WithStatusSubresource(&v1beta1.App{}, &appsv1.Deployment{}, &v1beta1.DNSRecord{}, &v1beta1.Certificate{}).Build()
+    r := &AppReconciler{Client: c}
+    req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(app)}
+    reconcileApp := func() *appsv1.Deployment {
+        t.Helper()
+        if _, err := r.Reconcile(ctx, req); err != nil { t.Fatal(err) }
+        var d appsv1.Deployment
+        if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: "app-web"}, &d); err != nil { t.Fatal(err) }
+        return &d
+    }
+    update := func(mut func(a *v1beta1.App)) {
+        t.Helper()
+        var cur v1beta1.App
+        if err := c.Get(ctx, req.NamespacedName, &cur); err != nil { t.Fatal(err) }
+        mut(&cur)
+        if err := c.Update(ctx, &cur); err != nil { t.Fatal(err) }
+    }
+
+    d := reconcileApp()
+    ctr := d.Spec.Template.Spec.Containers[0]
+    if *d.Spec.Replicas != 3 || ctr.Command[0] != "/web" || ctr.Args[0] != "--listen=:8080" || ctr.Ports[0].ContainerPort != 8080 { t.Fatalf("unexpected deployment %+v", d.Spec) }
+    if len(ctr.Env) != 2 || ctr.Env[1].ValueFrom.SecretKeyRef.Name != "db" || ctr.EnvFrom[0].ConfigMapRef.Name != "web-config" { t.Fatalf("unexpected env %+v %+v", ctr.Env, ctr.EnvFrom) }
+    if ctr.Resources.Requests.Cpu().String() != "100m" || ctr.ReadinessProbe.HTTPGet.Path != "/healthz" || ctr.LivenessProbe.PeriodSeconds != 20 { t.Fatalf("unexpected container %+v", ctr) }
+    var svc corev1.Service
+    if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: "app-web"}, &svc); err != nil { t.Fatal(err) }
+    if svc.Spec.Ports[0].Port != 80 || svc.Spec.Ports[0].TargetPort.IntValue() != 8080 { t.Fatalf("unexpected service ports %+v", svc.Spec.Ports) }
+    rev := d.Spec.Template.Annotations["kubeop.io/revision"]
+    if rev == computeImageRev(app.Spec.Image) { t.Fatalf("workload fields should be part of the revision") }
+
+    // scaling keeps the revision
+    update(func(a *v1beta1.App) { more := int32(5); a.Spec.Replicas = &more })
+    if d = reconcileApp(); *d.Spec.Replicas != 5 || d.Spec.Template.Annotations["kubeop.io/revision"] != rev { t.Fatalf("unexpected deployment after scaling %+v", d.Spec) }
+
+    // any other change is a new revision applied in full
+    update(func(a *v1beta1.App) {
+        a.Spec.Env[0].Value = "staging"
+        a.Spec.LivenessProbe = nil
+    })
+    d = reconcileApp()
+    ctr = d.Spec.Template.Spec.Containers[0]
+    if ctr.Env[0].Value != "staging" || ctr.LivenessProbe != nil || d.Spec.Template.Annotations["kubeop.io/revision"] == rev { t.Fatalf("unexpected container %+v", ctr) }
+
+    // Apps that only set an image keep their image hash as the revision
+    plain := &v1beta1.App{Spec: v1beta1.AppSpec{Type: "Image", Image: "nginx:1.27", Workload: v1beta1.Workload{Replicas: &replicas}}}
+    if imageRevision(plain) != computeImageRev("nginx:1.27") { t.Fatalf("unexpected revision %s", imageRevision(plain)) }
+}
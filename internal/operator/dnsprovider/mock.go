@@ -0,0 +1,53 @@
+package dnsprovider
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+)
+
+// mockClient gives up on dns-mock calls after requestTimeout, like the
+// clients of the other providers.
+var mockClient = &http.Client{Timeout: requestTimeout}
+
+// Mock posts records to the dns-mock service. Without an Endpoint every call
+// succeeds without doing anything.
+type Mock struct {
+    Endpoint string
+}
+
+func (m *Mock) Upsert(ctx context.Context, host, target string) error {
+    return m.call(ctx, http.MethodPost, host, target)
+}
+
+func (m *Mock) Delete(ctx context.Context, host, target string) error {
+    return m.call(ctx, http.MethodDelete, host, target)
+}
+
+func (m *Mock) SetTXT(ctx context.Context, name, value string) error {
+    return m.send(ctx, http.MethodPost, "/v1/txtrecords", map[string]string{"name": name, "value": value})
+}
+
+func (m *Mock) DeleteTXT(ctx context.Context, name, value string) error {
+    return m.send(ctx, http.MethodDelete, "/v1/txtrecords", map[string]string{"name": name, "value": value})
+}
+
+func (m *Mock) call(ctx context.Context, method, host, target string) error {
+    return m.send(ctx, method, "/v1/dnsrecords", map[string]string{"host": host, "target": target})
+}
+
+func (m *Mock) send(ctx context.Context, method, path string, payload map[string]string) error {
+    if m.Endpoint == "" { return nil }
+    body, err := json.Marshal(payload)
+    if err != nil { return err }
+    req, err := http.NewRequestWithContext(ctx, method, m.Endpoint+path, bytes.NewReader(body))
+    if err != nil { return err }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := mockClient.Do(req)
+    if err != nil { return fmt.Errorf("dns mock: %w", err) }
+    resp.Body.Close()
+    if resp.StatusCode/100 != 2 { return fmt.Errorf("dns mock: %s", resp.Status) }
+    return nil
+}
@@ -0,0 +1,107 @@
+package dnsprovider
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+)
+
+// PowerDNSConfig configures the PowerDNS Authoritative HTTP API.
+type PowerDNSConfig struct {
+    // URL is the API base, e.g. http://pdns:8081.
+    URL    string
+    APIKey string
+    // ServerID defaults to "localhost".
+    ServerID string
+    Zone     string
+    TTL      uint32
+}
+
+// PowerDNS publishes records by patching RRsets of a zone.
+type PowerDNS struct {
+    cfg    PowerDNSConfig
+    client *http.Client
+}
+
+func NewPowerDNS(cfg PowerDNSConfig) (*PowerDNS, error) {
+    if cfg.URL == "" { return nil, fmt.Errorf("powerdns: url is required") }
+    if cfg.Zone == "" { return nil, fmt.Errorf("powerdns: zone is required") }
+    if cfg.ServerID == "" { cfg.ServerID = "localhost" }
+    cfg.URL = strings.TrimRight(cfg.URL, "/")
+    cfg.Zone = fqdn(cfg.Zone)
+    return &PowerDNS{cfg: cfg, client: &http.Client{Timeout: requestTimeout}}, nil
+}
+
+type pdnsRecord struct {
+    Content  string `json:"content"`
+    Disabled bool   `json:"disabled"`
+}
+
+type pdnsRRSet struct {
+    Name       string       `json:"name"`
+    Type       string       `json:"type"`
+    TTL        uint32       `json:"ttl,omitempty"`
+    ChangeType string       `json:"changetype"`
+    Records    []pdnsRecord `json:"records,omitempty"`
+}
+
+func (p *PowerDNS) Upsert(ctx context.Context, host, target string) error {
+    if !inZone(p.cfg.Zone, host) { return fmt.Errorf("host %s is outside zone %s", host, p.cfg.Zone) }
+    t := RecordType(target)
+    content := target
+    if t == "CNAME" { content = fqdn(target) }
+    // replace the record and drop the types it may have had before
+    rrsets := []pdnsRRSet{{Name: fqdn(host), Type: t, TTL: p.cfg.TTL, ChangeType: "REPLACE", Records: []pdnsRecord{{Content: content}}}}
+    for _, other := range recordTypes {
+        if other != t { rrsets = append(rrsets, pdnsRRSet{Name: fqdn(host), Type: other, ChangeType: "DELETE"}) }
+    }
+    return p.patch(ctx, rrsets)
+}
+
+func (p *PowerDNS) Delete(ctx context.Context, host, _ string) error {
+    if !inZone(p.cfg.Zone, host) { return fmt.Errorf("host %s is outside zone %s", host, p.cfg.Zone) }
+    var rrsets []pdnsRRSet
+    for _, t := range recordTypes {
+        rrsets = append(rrsets, pdnsRRSet{Name: fqdn(host), Type: t, ChangeType: "DELETE"})
+    }
+    return p.patch(ctx, rrsets)
+}
+
+// SetTXT replaces the TXT rrset of name: PowerDNS has no way to add a single
+// record, and challenge names only ever carry one value at a time.
+func (p *PowerDNS) SetTXT(ctx context.Context, name, value string) error {
+    if !inZone(p.cfg.Zone, name) { return fmt.Errorf("name %s is outside zone %s", name, p.cfg.Zone) }
+    return p.patch(ctx, []pdnsRRSet{{Name: fqdn(name), Type: "TXT", TTL: p.cfg.TTL, ChangeType: "REPLACE", Records: []pdnsRecord{{Content: strconv.Quote(value)}}}})
+}
+
+func (p *PowerDNS) DeleteTXT(ctx context.Context, name, _ string) error {
+    if !inZone(p.cfg.Zone, name) { return fmt.Errorf("name %s is outside zone %s", name, p.cfg.Zone) }
+    return p.patch(ctx, []pdnsRRSet{{Name: fqdn(name), Type: "TXT", ChangeType: "DELETE"}})
+}
+
+func (p *PowerDNS) patch(ctx context.Context, rrsets []pdnsRRSet) error {
+    body, err := json.Marshal(map[string]any{"rrsets": rrsets})
+    if err != nil { return err }
+    u := fmt.Sprintf("%s/api/v1/servers/%s/zones/%s", p.cfg.URL, url.PathEscape(p.cfg.ServerID), url.PathEscape(p.cfg.Zone))
+    req, err := http.NewRequestWithContext(ctx, http.MethodPatch, u, bytes.NewReader(body))
+    if err != nil { return err }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-API-Key", p.cfg.APIKey)
+    resp, err := p.client.Do(req)
+    if err != nil { return fmt.Errorf("powerdns: %w", err) }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 {
+        // PowerDNS reports failures as {"error": "..."}
+        var perr struct{ Error string `json:"error"` }
+        msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+        if json.Unmarshal(msg, &perr) == nil && perr.Error != "" { msg = []byte(perr.Error) }
+        return fmt.Errorf("powerdns: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+    }
+    return nil
+}
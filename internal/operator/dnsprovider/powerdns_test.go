@@ -0,0 +1,49 @@
+package dnsprovider
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestPowerDNS_Patch(t *testing.T) {
+    var body struct{ RRSets []pdnsRRSet `json:"rrsets"` }
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("X-API-Key") != "key" {
+            w.WriteHeader(http.StatusUnauthorized)
+            _, _ = w.Write([]byte(`{"error": "Unauthorized"}`))
+            return
+        }
+        if r.Method != http.MethodPatch || r.URL.Path != "/api/v1/servers/localhost/zones/example.com." {
+            t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+        }
+        if err := json.NewDecoder(r.Body).Decode(&body); err != nil { t.Error(err) }
+        w.WriteHeader(http.StatusNoContent)
+    }))
+    defer srv.Close()
+
+    p, err := NewPowerDNS(PowerDNSConfig{URL: srv.URL, APIKey: "key", Zone: "example.com", TTL: 60})
+    if err != nil { t.Fatal(err) }
+    ctx := context.Background()
+    if err := p.Upsert(ctx, "web.example.com", "2001:db8::1"); err != nil { t.Fatal(err) }
+    if len(body.RRSets) != 3 { t.Fatalf("expected replace plus two deletes, got %+v", body.RRSets) }
+    rr := body.RRSets[0]
+    if rr.Name != "web.example.com." || rr.Type != "AAAA" || rr.ChangeType != "REPLACE" || rr.Records[0].Content != "2001:db8::1" {
+        t.Fatalf("unexpected rrset %+v", rr)
+    }
+    if err := p.Delete(ctx, "web.example.com", ""); err != nil { t.Fatal(err) }
+    for _, rr := range body.RRSets {
+        if rr.ChangeType != "DELETE" { t.Fatalf("unexpected rrset on delete %+v", rr) }
+    }
+    if err := p.SetTXT(ctx, "_acme-challenge.web.example.com", "token"); err != nil { t.Fatal(err) }
+    if rr := body.RRSets[0]; len(body.RRSets) != 1 || rr.Type != "TXT" || rr.Records[0].Content != `"token"` {
+        t.Fatalf("unexpected TXT rrsets %+v", body.RRSets)
+    }
+
+    p.cfg.APIKey = "wrong"
+    if err := p.Upsert(ctx, "web.example.com", "203.0.113.7"); err == nil || err.Error() != "powerdns: 401 Unauthorized: Unauthorized" {
+        t.Fatalf("expected the API error to be surfaced, got %v", err)
+    }
+}
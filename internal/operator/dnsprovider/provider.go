@@ -0,0 +1,100 @@
+// Package dnsprovider publishes DNSRecord objects to a DNS backend.
+package dnsprovider
+
+import (
+    "context"
+    "fmt"
+    "net"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Provider publishes one record per host. The record type follows the
+// target: A for IPv4 addresses, AAAA for IPv6 addresses and CNAME for names.
+type Provider interface {
+    // Upsert points host at target, replacing whatever the host resolved to.
+    Upsert(ctx context.Context, host, target string) error
+    // Delete removes the record of host. Missing records are not an error.
+    Delete(ctx context.Context, host, target string) error
+}
+
+// TXTProvider is implemented by providers that can publish TXT records, as
+// needed for ACME dns-01 challenges.
+type TXTProvider interface {
+    // SetTXT adds value to the TXT records of name, keeping other values.
+    SetTXT(ctx context.Context, name, value string) error
+    // DeleteTXT removes value from the TXT records of name.
+    DeleteTXT(ctx context.Context, name, value string) error
+}
+
+// defaultTTL is used when KUBEOP_DNS_TTL is unset.
+const defaultTTL = 300
+
+// FromEnv builds the provider selected by KUBEOP_DNS_PROVIDER: "mock" (the
+// default, posting to DNS_MOCK_URL), "rfc2136" or "powerdns".
+func FromEnv() (Provider, error) {
+    ttl := uint32(defaultTTL)
+    if v := os.Getenv("KUBEOP_DNS_TTL"); v != "" {
+        n, err := strconv.ParseUint(v, 10, 32)
+        if err != nil { return nil, fmt.Errorf("KUBEOP_DNS_TTL: %w", err) }
+        ttl = uint32(n)
+    }
+    switch p := os.Getenv("KUBEOP_DNS_PROVIDER"); p {
+    case "", "mock":
+        return &Mock{Endpoint: os.Getenv("DNS_MOCK_URL")}, nil
+    case "rfc2136":
+        return NewRFC2136(RFC2136Config{
+            Server:        os.Getenv("KUBEOP_DNS_RFC2136_SERVER"),
+            Zone:          os.Getenv("KUBEOP_DNS_ZONE"),
+            TSIGKey:       os.Getenv("KUBEOP_DNS_TSIG_KEY"),
+            TSIGSecret:    os.Getenv("KUBEOP_DNS_TSIG_SECRET"),
+            TSIGAlgorithm: os.Getenv("KUBEOP_DNS_TSIG_ALGORITHM"),
+            TTL:           ttl,
+        })
+    case "powerdns":
+        return NewPowerDNS(PowerDNSConfig{
+            URL:      os.Getenv("KUBEOP_DNS_PDNS_URL"),
+            APIKey:   os.Getenv("KUBEOP_DNS_PDNS_API_KEY"),
+            ServerID: os.Getenv("KUBEOP_DNS_PDNS_SERVER"),
+            Zone:     os.Getenv("KUBEOP_DNS_ZONE"),
+            TTL:      ttl,
+        })
+    default:
+        return nil, fmt.Errorf("unknown DNS provider %q", p)
+    }
+}
+
+// RecordType returns the record type used for target.
+func RecordType(target string) string {
+    ip := net.ParseIP(target)
+    switch {
+    case ip == nil:
+        return "CNAME"
+    case ip.To4() != nil:
+        return "A"
+    default:
+        return "AAAA"
+    }
+}
+
+// recordTypes lists every type a host may have been published with, so an
+// upsert that changes the type can clear the old one.
+var recordTypes = []string{"A", "AAAA", "CNAME"}
+
+// fqdn lower-cases name and adds the trailing dot.
+func fqdn(name string) string {
+    name = strings.ToLower(strings.TrimSpace(name))
+    if !strings.HasSuffix(name, ".") { name += "." }
+    return name
+}
+
+// inZone reports whether host is zone or one of its subdomains.
+func inZone(zone, host string) bool {
+    zone, host = fqdn(zone), fqdn(host)
+    return host == zone || strings.HasSuffix(host, "."+zone)
+}
+
+// requestTimeout bounds a single provider call.
+const requestTimeout = 10 * time.Second
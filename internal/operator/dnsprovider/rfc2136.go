@@ -0,0 +1,113 @@
+package dnsprovider
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "github.com/miekg/dns"
+)
+
+// RFC2136Config configures dynamic updates against an authoritative server.
+type RFC2136Config struct {
+    // Server is the host:port updates are sent to.
+    Server string
+    Zone   string
+    // TSIGKey and TSIGSecret (base64) sign updates when set. TSIGAlgorithm
+    // defaults to hmac-sha256.
+    TSIGKey       string
+    TSIGSecret    string
+    TSIGAlgorithm string
+    TTL           uint32
+}
+
+// RFC2136 publishes records with DNS UPDATE messages.
+type RFC2136 struct {
+    cfg    RFC2136Config
+    client *dns.Client
+}
+
+func NewRFC2136(cfg RFC2136Config) (*RFC2136, error) {
+    if cfg.Server == "" { return nil, fmt.Errorf("rfc2136: server is required") }
+    if cfg.Zone == "" { return nil, fmt.Errorf("rfc2136: zone is required") }
+    if (cfg.TSIGKey == "") != (cfg.TSIGSecret == "") {
+        return nil, fmt.Errorf("rfc2136: TSIG key and secret must be set together")
+    }
+    if cfg.TSIGAlgorithm == "" { cfg.TSIGAlgorithm = dns.HmacSHA256 }
+    cfg.Zone = fqdn(cfg.Zone)
+    cfg.TSIGKey = fqdn(cfg.TSIGKey)
+    cfg.TSIGAlgorithm = fqdn(cfg.TSIGAlgorithm)
+    c := &dns.Client{Net: "tcp", Timeout: requestTimeout}
+    if cfg.TSIGSecret != "" {
+        c.TsigSecret = map[string]string{cfg.TSIGKey: cfg.TSIGSecret}
+    }
+    return &RFC2136{cfg: cfg, client: c}, nil
+}
+
+func (p *RFC2136) Upsert(ctx context.Context, host, target string) error {
+    rr, err := p.record(host, target)
+    if err != nil { return err }
+    m := p.update(host)
+    m.Insert([]dns.RR{rr})
+    return p.send(ctx, m)
+}
+
+func (p *RFC2136) Delete(ctx context.Context, host, _ string) error {
+    if !inZone(p.cfg.Zone, host) { return fmt.Errorf("host %s is outside zone %s", host, p.cfg.Zone) }
+    return p.send(ctx, p.update(host))
+}
+
+func (p *RFC2136) SetTXT(ctx context.Context, name, value string) error {
+    rr, err := p.txt(name, value)
+    if err != nil { return err }
+    m := new(dns.Msg)
+    m.SetUpdate(p.cfg.Zone)
+    m.Insert([]dns.RR{rr})
+    return p.send(ctx, m)
+}
+
+func (p *RFC2136) DeleteTXT(ctx context.Context, name, value string) error {
+    rr, err := p.txt(name, value)
+    if err != nil { return err }
+    m := new(dns.Msg)
+    m.SetUpdate(p.cfg.Zone)
+    m.Remove([]dns.RR{rr})
+    return p.send(ctx, m)
+}
+
+func (p *RFC2136) txt(name, value string) (dns.RR, error) {
+    if !inZone(p.cfg.Zone, name) { return nil, fmt.Errorf("name %s is outside zone %s", name, p.cfg.Zone) }
+    return &dns.TXT{Hdr: dns.RR_Header{Name: fqdn(name), Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: p.cfg.TTL}, Txt: []string{value}}, nil
+}
+
+// update starts a message that clears every record type host may carry.
+func (p *RFC2136) update(host string) *dns.Msg {
+    m := new(dns.Msg)
+    m.SetUpdate(p.cfg.Zone)
+    var rrs []dns.RR
+    for _, t := range recordTypes {
+        rrs = append(rrs, &dns.ANY{Hdr: dns.RR_Header{Name: fqdn(host), Rrtype: dns.StringToType[t], Class: dns.ClassANY}})
+    }
+    m.RemoveRRset(rrs)
+    return m
+}
+
+func (p *RFC2136) record(host, target string) (dns.RR, error) {
+    if !inZone(p.cfg.Zone, host) { return nil, fmt.Errorf("host %s is outside zone %s", host, p.cfg.Zone) }
+    t := RecordType(target)
+    value := target
+    if t == "CNAME" { value = fqdn(target) }
+    return dns.NewRR(fmt.Sprintf("%s %d IN %s %s", fqdn(host), p.cfg.TTL, t, value))
+}
+
+func (p *RFC2136) send(ctx context.Context, m *dns.Msg) error {
+    if p.cfg.TSIGSecret != "" {
+        m.SetTsig(p.cfg.TSIGKey, p.cfg.TSIGAlgorithm, 300, time.Now().Unix())
+    }
+    resp, _, err := p.client.ExchangeContext(ctx, m, p.cfg.Server)
+    if err != nil { return fmt.Errorf("rfc2136 update via %s: %w", p.cfg.Server, err) }
+    if resp.Rcode != dns.RcodeSuccess {
+        return fmt.Errorf("rfc2136 update via %s: %s", p.cfg.Server, dns.RcodeToString[resp.Rcode])
+    }
+    return nil
+}
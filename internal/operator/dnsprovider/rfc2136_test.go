@@ -0,0 +1,63 @@
+package dnsprovider
+
+import (
+    "context"
+    "net"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/miekg/dns"
+)
+
+func TestRFC2136_UpsertAndDelete(t *testing.T) {
+    const secret = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0" // base64 "secretsecretsecretsecret"
+    var mu sync.Mutex
+    var got []*dns.Msg
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil { t.Fatal(err) }
+    srv := &dns.Server{
+        Listener:   ln,
+        TsigSecret: map[string]string{"kubeop.": secret},
+        // the default accept func refuses UPDATE messages
+        MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+        Handler: dns.HandlerFunc(func(w dns.ResponseWriter, m *dns.Msg) {
+            resp := new(dns.Msg)
+            resp.SetReply(m)
+            if m.IsTsig() == nil || w.TsigStatus() != nil {
+                resp.Rcode = dns.RcodeNotAuth
+            } else if m.Question[0].Name != "example.com." {
+                resp.Rcode = dns.RcodeNotZone
+            }
+            mu.Lock()
+            got = append(got, m)
+            mu.Unlock()
+            _ = w.WriteMsg(resp)
+        }),
+    }
+    go srv.ActivateAndServe()
+    defer srv.Shutdown()
+
+    p, err := NewRFC2136(RFC2136Config{Server: ln.Addr().String(), Zone: "example.com", TSIGKey: "kubeop", TSIGSecret: secret, TTL: 60})
+    if err != nil { t.Fatal(err) }
+    ctx := context.Background()
+    if err := p.Upsert(ctx, "web.example.com", "203.0.113.7"); err != nil { t.Fatal(err) }
+    if err := p.Upsert(ctx, "api.example.com", "lb.example.net"); err != nil { t.Fatal(err) }
+    if err := p.Delete(ctx, "web.example.com", "203.0.113.7"); err != nil { t.Fatal(err) }
+    if err := p.Upsert(ctx, "web.other.org", "203.0.113.7"); err == nil { t.Fatalf("expected hosts outside the zone to be rejected") }
+
+    mu.Lock()
+    defer mu.Unlock()
+    if len(got) != 3 { t.Fatalf("expected 3 updates, got %d", len(got)) }
+    // each update clears A, AAAA and CNAME, then inserts the new record
+    if n := len(got[0].Ns); n != 4 { t.Fatalf("expected 4 update RRs, got %d", n) }
+    if a, ok := got[0].Ns[3].(*dns.A); !ok || a.A.String() != "203.0.113.7" || a.Hdr.Ttl != 60 { t.Fatalf("unexpected insert %v", got[0].Ns[3]) }
+    if c, ok := got[1].Ns[3].(*dns.CNAME); !ok || c.Target != "lb.example.net." { t.Fatalf("unexpected insert %v", got[1].Ns[3]) }
+    if n := len(got[2].Ns); n != 3 { t.Fatalf("delete should only clear rrsets, got %d RRs", n) }
+
+    bad, err := NewRFC2136(RFC2136Config{Server: ln.Addr().String(), Zone: "example.com", TSIGKey: "kubeop", TSIGSecret: "d3Jvbmc=", TTL: 60})
+    if err != nil { t.Fatal(err) }
+    // the server cannot sign a reply with an unknown key, so this times out
+    bad.client.Timeout = 500 * time.Millisecond
+    if err := bad.Upsert(ctx, "web.example.com", "203.0.113.7"); err == nil { t.Fatalf("expected a TSIG failure to be reported") }
+}
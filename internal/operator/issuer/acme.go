@@ -0,0 +1,189 @@
+package issuer
+
+import (
+    "context"
+    "crypto"
+    "errors"
+    "fmt"
+    "net/http"
+    "sync"
+    "time"
+
+    "golang.org/x/crypto/acme"
+)
+
+// stepTimeout bounds one call to Issue. Validation by the CA is not waited
+// for; the order is polled on later calls instead.
+const stepTimeout = 30 * time.Second
+
+// AccountKeyFunc returns the ACME account key, creating it on first use.
+type AccountKeyFunc func(ctx context.Context) (crypto.Signer, error)
+
+// ACME issues certificates from an RFC 8555 CA.
+type ACME struct {
+    DirectoryURL string
+    // Email is registered as the account contact when set.
+    Email      string
+    AccountKey AccountKeyFunc
+    // HTTPClient talks to the CA; nil means http.DefaultClient.
+    HTTPClient *http.Client
+    // HTTP01 and DNS01 solve the respective challenges. A Request for a
+    // challenge without a solver fails.
+    HTTP01 Solver
+    DNS01  Solver
+
+    mu     sync.Mutex
+    client *acme.Client
+}
+
+// account returns a client for the registered account, registering the key
+// with the CA on first use.
+func (a *ACME) account(ctx context.Context) (*acme.Client, error) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if a.client != nil { return a.client, nil }
+    key, err := a.AccountKey(ctx)
+    if err != nil { return nil, fmt.Errorf("account key: %w", err) }
+    c := &acme.Client{Key: key, DirectoryURL: a.DirectoryURL, HTTPClient: a.HTTPClient, UserAgent: "kubeop"}
+    acct := &acme.Account{}
+    if a.Email != "" { acct.Contact = []string{"mailto:" + a.Email} }
+    if _, err := c.Register(ctx, acct, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+        return nil, fmt.Errorf("register account: %w", err)
+    }
+    a.client = c
+    return c, nil
+}
+
+// reset drops the cached account so the next attempt registers again, e.g.
+// after the CA forgot about it.
+func (a *ACME) reset() {
+    a.mu.Lock()
+    a.client = nil
+    a.mu.Unlock()
+}
+
+func (a *ACME) Issue(ctx context.Context, req Request) (*Result, error) {
+    ctx, cancel := context.WithTimeout(ctx, stepTimeout)
+    defer cancel()
+    res, err := a.issue(ctx, req)
+    if err != nil {
+        var aerr *acme.Error
+        if errors.As(err, &aerr) && aerr.ProblemType == "urn:ietf:params:acme:error:accountDoesNotExist" { a.reset() }
+        return nil, err
+    }
+    return res, nil
+}
+
+func (a *ACME) issue(ctx context.Context, req Request) (*Result, error) {
+    c, err := a.account(ctx)
+    if err != nil { return nil, err }
+    typ := req.Challenge
+    if typ == "" { typ = ChallengeHTTP01 }
+    var order *acme.Order
+    if req.Order == "" {
+        if order, err = c.AuthorizeOrder(ctx, acme.DomainIDs(req.Host)); err != nil { return nil, fmt.Errorf("new order: %w", err) }
+    } else if order, err = c.GetOrder(ctx, req.Order); err != nil {
+        return nil, fmt.Errorf("get order: %w", err)
+    }
+    if order.Status == acme.StatusPending {
+        for _, u := range order.AuthzURLs {
+            if err := a.authorize(ctx, c, u, typ); err != nil {
+                a.cleanUp(ctx, c, order, typ)
+                return nil, err
+            }
+        }
+        if order, err = c.GetOrder(ctx, order.URI); err != nil { return nil, fmt.Errorf("get order: %w", err) }
+    }
+    switch order.Status {
+    case acme.StatusPending:
+        return &Result{Order: order.URI}, nil
+    case acme.StatusReady:
+    default:
+        // an order finalized by an earlier attempt lost its key with it
+        a.cleanUp(ctx, c, order, typ)
+        return nil, fmt.Errorf("order for %s is %s", req.Host, order.Status)
+    }
+    a.cleanUp(ctx, c, order, typ)
+    key, keyPEM, err := newKey()
+    if err != nil { return nil, err }
+    csr, err := newCSR(key, req.Host)
+    if err != nil { return nil, err }
+    chain, _, err := c.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+    if err != nil { return nil, fmt.Errorf("finalize order: %w", err) }
+    return result(chain, keyPEM)
+}
+
+// solver returns the solver for a challenge type and the function computing
+// its response.
+func (a *ACME) solver(c *acme.Client, typ string) (Solver, func(token string) (string, error), error) {
+    var solver Solver
+    var value func(token string) (string, error)
+    switch typ {
+    case ChallengeHTTP01:
+        solver, value = a.HTTP01, c.HTTP01ChallengeResponse
+    case ChallengeDNS01:
+        solver, value = a.DNS01, c.DNS01ChallengeRecord
+    default:
+        return nil, nil, fmt.Errorf("unknown challenge type %q", typ)
+    }
+    if solver == nil { return nil, nil, fmt.Errorf("no %s solver is configured", typ) }
+    return solver, value, nil
+}
+
+// authorize answers the challenge of one pending authorization. A challenge
+// already accepted is left to the CA, and a failed one fails the order.
+func (a *ACME) authorize(ctx context.Context, c *acme.Client, url, typ string) error {
+    z, err := c.GetAuthorization(ctx, url)
+    if err != nil { return fmt.Errorf("get authorization: %w", err) }
+    if z.Status == acme.StatusValid { return nil }
+    solver, value, err := a.solver(c, typ)
+    if err != nil { return err }
+    chal := findChallenge(z, typ)
+    if chal == nil { return fmt.Errorf("CA offers no %s challenge for %s", typ, z.Identifier.Value) }
+    host := z.Identifier.Value
+    switch {
+    case z.Status == acme.StatusInvalid || chal.Status == acme.StatusInvalid:
+        return validationError(typ, host, chal)
+    case chal.Status != acme.StatusPending:
+        return nil
+    }
+    v, err := value(chal.Token)
+    if err != nil { return err }
+    if err := solver.Present(ctx, host, chal.Token, v); err != nil { return fmt.Errorf("present %s challenge: %w", typ, err) }
+    if _, err := c.Accept(ctx, chal); err != nil { return fmt.Errorf("accept %s challenge: %w", typ, err) }
+    // the CA may validate while accepting
+    if z, err = c.GetAuthorization(ctx, url); err != nil { return fmt.Errorf("get authorization: %w", err) }
+    if chal := findChallenge(z, typ); z.Status == acme.StatusInvalid || (chal != nil && chal.Status == acme.StatusInvalid) {
+        return validationError(typ, host, chal)
+    }
+    return nil
+}
+
+func validationError(typ, host string, chal *acme.Challenge) error {
+    if chal != nil && chal.Error != nil { return fmt.Errorf("%s validation of %s: %w", typ, host, chal.Error) }
+    return fmt.Errorf("%s validation of %s failed", typ, host)
+}
+
+// cleanUp removes the challenge responses of order once it no longer needs
+// them. Errors are ignored; stale responses are harmless.
+func (a *ACME) cleanUp(ctx context.Context, c *acme.Client, order *acme.Order, typ string) {
+    ctx = context.WithoutCancel(ctx)
+    solver, value, err := a.solver(c, typ)
+    if err != nil { return }
+    for _, u := range order.AuthzURLs {
+        z, err := c.GetAuthorization(ctx, u)
+        if err != nil { continue }
+        chal := findChallenge(z, typ)
+        if chal == nil { continue }
+        v, err := value(chal.Token)
+        if err != nil { continue }
+        _ = solver.CleanUp(ctx, z.Identifier.Value, chal.Token, v)
+    }
+}
+
+func findChallenge(z *acme.Authorization, typ string) *acme.Challenge {
+    for _, ch := range z.Challenges {
+        if ch.Type == typ { return ch }
+    }
+    return nil
+}
@@ -0,0 +1,106 @@
+package issuer
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/x509"
+    "fmt"
+    "io"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/vaheed/kubeop/internal/acmeserver"
+)
+
+type fakeTXT struct {
+    mu      sync.Mutex
+    records map[string]string
+}
+
+func (f *fakeTXT) SetTXT(_ context.Context, name, value string) error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.records[name] = value
+    return nil
+}
+
+func (f *fakeTXT) DeleteTXT(_ context.Context, name, _ string) error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    delete(f.records, name)
+    return nil
+}
+
+func TestACME_Issue(t *testing.T) {
+    http01 := &HTTP01{}
+    txt := &fakeTXT{records: map[string]string{}}
+    ca := &acmeserver.Server{Lifetime: 24 * time.Hour}
+    // validate the way a CA would: fetch the http-01 token from the solver
+    // and look up the dns-01 TXT record
+    ca.Validate = func(typ, domain, token, keyAuth string) error {
+        switch typ {
+        case acmeserver.HTTP01:
+            rec := httptest.NewRecorder()
+            http01.ServeHTTP(rec, httptest.NewRequest("GET", "http://"+domain+"/.well-known/acme-challenge/"+token, nil))
+            body, _ := io.ReadAll(rec.Body)
+            if string(body) != keyAuth { return fmt.Errorf("http-01 response %q does not match", body) }
+        case acmeserver.DNS01:
+            txt.mu.Lock()
+            defer txt.mu.Unlock()
+            if txt.records["_acme-challenge."+domain] != acmeserver.DNS01Value(keyAuth) { return fmt.Errorf("dns-01 record missing") }
+        }
+        return nil
+    }
+    srv := httptest.NewServer(ca)
+    defer srv.Close()
+    ca.BaseURL = srv.URL
+
+    keys := 0
+    accountKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    a := &ACME{
+        DirectoryURL: srv.URL + "/directory",
+        Email:        "ops@example.com",
+        AccountKey:   func(context.Context) (crypto.Signer, error) { keys++; return accountKey, nil },
+        HTTP01:       http01,
+        DNS01:        &DNS01{Provider: txt},
+    }
+    ctx := context.Background()
+    for _, challenge := range []string{"", ChallengeDNS01} {
+        res, err := a.Issue(ctx, Request{Host: "web.example.com", Challenge: challenge})
+        if err != nil { t.Fatalf("issue with %q: %v", challenge, err) }
+        leaf, err := Parse(res.CertPEM, res.KeyPEM)
+        if err != nil { t.Fatal(err) }
+        if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != "web.example.com" { t.Fatalf("unexpected names %v", leaf.DNSNames) }
+        if !res.NotAfter.Equal(leaf.NotAfter) || res.NotAfter.Sub(res.NotBefore) != 24*time.Hour { t.Fatalf("unexpected validity %v - %v", res.NotBefore, res.NotAfter) }
+        // the chain ends with the CA root
+        roots := x509.NewCertPool()
+        roots.AppendCertsFromPEM(ca.CACertificate())
+        if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "web.example.com", Roots: roots}); err != nil { t.Fatal(err) }
+        if strings.Count(string(res.CertPEM), "BEGIN CERTIFICATE") != 2 { t.Fatalf("expected leaf and root in the chain") }
+    }
+    if keys != 1 { t.Fatalf("expected the account to be registered once, loaded the key %d times", keys) }
+    if len(http01.tokens) != 0 || len(txt.records) != 0 { t.Fatalf("challenge responses were not cleaned up") }
+
+    // a challenge the CA cannot validate fails the issuance
+    ca.Validate = func(string, string, string, string) error { return fmt.Errorf("connection refused") }
+    if _, err := a.Issue(ctx, Request{Host: "api.example.com"}); err == nil || !strings.Contains(err.Error(), "http-01 validation of api.example.com") {
+        t.Fatalf("expected a validation error, got %v", err)
+    }
+    if _, err := (&ACME{DirectoryURL: a.DirectoryURL, AccountKey: a.AccountKey}).Issue(ctx, Request{Host: "web.example.com"}); err == nil || !strings.Contains(err.Error(), "no http-01 solver") {
+        t.Fatalf("expected a missing solver error, got %v", err)
+    }
+}
+
+func TestSelfSigned_Issue(t *testing.T) {
+    res, err := (&SelfSigned{}).Issue(context.Background(), Request{Host: "web.example.com"})
+    if err != nil { t.Fatal(err) }
+    leaf, err := Parse(res.CertPEM, res.KeyPEM)
+    if err != nil { t.Fatal(err) }
+    if leaf.DNSNames[0] != "web.example.com" || res.NotAfter.Sub(res.NotBefore) != 90*24*time.Hour { t.Fatalf("unexpected certificate %v %v", leaf.DNSNames, res.NotAfter) }
+}
@@ -0,0 +1,117 @@
+// Package issuer obtains TLS certificates for Certificate objects.
+package issuer
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "fmt"
+    "net/http"
+    "os"
+    "time"
+)
+
+// Challenge types a Request may ask for.
+const (
+    ChallengeHTTP01 = "http-01"
+    ChallengeDNS01  = "dns-01"
+)
+
+// Request asks for a certificate covering Host.
+type Request struct {
+    Host string
+    // Challenge is ChallengeHTTP01 (the default) or ChallengeDNS01. Issuers
+    // that do not validate domains ignore it.
+    Challenge string
+    // Order is the order URL an earlier call returned in Result.Order, empty
+    // to start a new order.
+    Order string
+}
+
+// Result is an issued certificate. CertPEM holds the leaf followed by any
+// intermediates, KeyPEM the matching private key. While the CA has not
+// validated the request yet, only Order is set.
+type Result struct {
+    Order     string
+    CertPEM   []byte
+    KeyPEM    []byte
+    NotBefore time.Time
+    NotAfter  time.Time
+}
+
+// Issuer issues certificates. Issue does not wait for the CA: it returns the
+// certificate, or a Result with Order set to be passed in the Request of a
+// later call once the CA had time to validate the host.
+type Issuer interface {
+    Issue(ctx context.Context, req Request) (*Result, error)
+}
+
+// FromEnv builds the issuer selected by KUBEOP_CERT_ISSUER: "acme" (the
+// default when KUBEOP_ACME_DIRECTORY is set) or "selfsigned" (the default
+// otherwise). KUBEOP_ACME_EMAIL sets the account contact and
+// KUBEOP_ACME_CA_FILE adds a PEM bundle of roots trusted for the directory.
+func FromEnv(key AccountKeyFunc, http01, dns01 Solver) (Issuer, error) {
+    dir := os.Getenv("KUBEOP_ACME_DIRECTORY")
+    kind := os.Getenv("KUBEOP_CERT_ISSUER")
+    if kind == "" {
+        kind = "selfsigned"
+        if dir != "" { kind = "acme" }
+    }
+    switch kind {
+    case "selfsigned":
+        return &SelfSigned{}, nil
+    case "acme":
+        if dir == "" { return nil, fmt.Errorf("KUBEOP_ACME_DIRECTORY is required for the acme issuer") }
+        a := &ACME{DirectoryURL: dir, Email: os.Getenv("KUBEOP_ACME_EMAIL"), AccountKey: key, HTTP01: http01, DNS01: dns01}
+        if f := os.Getenv("KUBEOP_ACME_CA_FILE"); f != "" {
+            pem, err := os.ReadFile(f)
+            if err != nil { return nil, fmt.Errorf("KUBEOP_ACME_CA_FILE: %w", err) }
+            pool, err := x509.SystemCertPool()
+            if err != nil { pool = x509.NewCertPool() }
+            if !pool.AppendCertsFromPEM(pem) { return nil, fmt.Errorf("KUBEOP_ACME_CA_FILE: no certificates in %s", f) }
+            a.HTTPClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: &tls.Config{RootCAs: pool}}}
+        }
+        return a, nil
+    default:
+        return nil, fmt.Errorf("unknown certificate issuer %q", kind)
+    }
+}
+
+// Parse checks that certPEM and keyPEM form a key pair and returns the leaf.
+func Parse(certPEM, keyPEM []byte) (*x509.Certificate, error) {
+    pair, err := tls.X509KeyPair(certPEM, keyPEM)
+    if err != nil { return nil, err }
+    return x509.ParseCertificate(pair.Certificate[0])
+}
+
+// newKey generates the certificate key and returns it with its PEM encoding.
+func newKey() (*ecdsa.PrivateKey, []byte, error) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil { return nil, nil, err }
+    der, err := x509.MarshalECPrivateKey(key)
+    if err != nil { return nil, nil, err }
+    return key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// newCSR returns a DER encoded request for host signed by key.
+func newCSR(key *ecdsa.PrivateKey, host string) ([]byte, error) {
+    tmpl := &x509.CertificateRequest{Subject: pkix.Name{CommonName: host}, DNSNames: []string{host}}
+    return x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+}
+
+// result encodes a DER chain and reads the validity of its leaf.
+func result(chain [][]byte, keyPEM []byte) (*Result, error) {
+    if len(chain) == 0 { return nil, fmt.Errorf("empty certificate chain") }
+    leaf, err := x509.ParseCertificate(chain[0])
+    if err != nil { return nil, fmt.Errorf("parse certificate: %w", err) }
+    var certPEM []byte
+    for _, der := range chain {
+        certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+    }
+    return &Result{CertPEM: certPEM, KeyPEM: keyPEM, NotBefore: leaf.NotBefore, NotAfter: leaf.NotAfter}, nil
+}
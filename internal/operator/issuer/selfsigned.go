@@ -0,0 +1,39 @@
+package issuer
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "math/big"
+    "time"
+)
+
+// SelfSigned issues certificates signed by their own key. It is meant for
+// clusters without a reachable ACME CA.
+type SelfSigned struct {
+    // Lifetime defaults to 90 days.
+    Lifetime time.Duration
+}
+
+func (s *SelfSigned) Issue(_ context.Context, req Request) (*Result, error) {
+    key, keyPEM, err := newKey()
+    if err != nil { return nil, err }
+    serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+    if err != nil { return nil, err }
+    lifetime := s.Lifetime
+    if lifetime == 0 { lifetime = 90 * 24 * time.Hour }
+    now := time.Now().Truncate(time.Second)
+    tmpl := &x509.Certificate{
+        SerialNumber: serial,
+        Subject:      pkix.Name{CommonName: req.Host},
+        DNSNames:     []string{req.Host},
+        NotBefore:    now,
+        NotAfter:     now.Add(lifetime),
+        KeyUsage:     x509.KeyUsageDigitalSignature,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+    if err != nil { return nil, err }
+    return result([][]byte{der}, keyPEM)
+}
@@ -0,0 +1,97 @@
+package issuer
+
+import (
+    "context"
+    "net/http"
+    "strings"
+    "sync"
+
+    "github.com/vaheed/kubeop/internal/operator/dnsprovider"
+)
+
+// Solver publishes the response to an ACME challenge for host. value is the
+// HTTP body to serve for http-01 and the TXT record value for dns-01.
+type Solver interface {
+    Present(ctx context.Context, host, token, value string) error
+    CleanUp(ctx context.Context, host, token, value string) error
+}
+
+// http01Prefix is the path the CA fetches http-01 responses from.
+const http01Prefix = "/.well-known/acme-challenge/"
+
+// TokenStore keeps http-01 responses by token. Get returns "" for an unknown
+// token.
+type TokenStore interface {
+    Set(ctx context.Context, token, value string) error
+    Delete(ctx context.Context, token string) error
+    Get(ctx context.Context, token string) (string, error)
+}
+
+// HTTP01 answers http-01 challenges. It is an http.Handler that must be
+// reachable as http://<host>/.well-known/acme-challenge/. The CA may reach
+// any operator replica, so with more than one the responses must be kept in
+// a Store they share.
+type HTTP01 struct {
+    // Store keeps the responses; nil keeps them in memory.
+    Store TokenStore
+
+    mu     sync.RWMutex
+    tokens map[string]string
+}
+
+func (h *HTTP01) Present(ctx context.Context, _, token, value string) error {
+    if h.Store != nil { return h.Store.Set(ctx, token, value) }
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    if h.tokens == nil { h.tokens = map[string]string{} }
+    h.tokens[token] = value
+    return nil
+}
+
+func (h *HTTP01) CleanUp(ctx context.Context, _, token, _ string) error {
+    if h.Store != nil { return h.Store.Delete(ctx, token) }
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    delete(h.tokens, token)
+    return nil
+}
+
+func (h *HTTP01) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    token, ok := strings.CutPrefix(r.URL.Path, http01Prefix)
+    if !ok || token == "" {
+        http.NotFound(w, r)
+        return
+    }
+    var value string
+    if h.Store != nil {
+        v, err := h.Store.Get(r.Context(), token)
+        if err != nil {
+            http.Error(w, "challenge lookup failed", http.StatusServiceUnavailable)
+            return
+        }
+        value = v
+    } else {
+        h.mu.RLock()
+        value = h.tokens[token]
+        h.mu.RUnlock()
+    }
+    if value == "" {
+        http.NotFound(w, r)
+        return
+    }
+    w.Header().Set("Content-Type", "text/plain")
+    w.Write([]byte(value))
+}
+
+// DNS01 answers dns-01 challenges with TXT records at _acme-challenge.<host>.
+type DNS01 struct {
+    Provider dnsprovider.TXTProvider
+}
+
+func (d *DNS01) Present(ctx context.Context, host, _, value string) error {
+    return d.Provider.SetTXT(ctx, "_acme-challenge."+host, value)
+}
+
+func (d *DNS01) CleanUp(ctx context.Context, host, _, value string) error {
+    return d.Provider.DeleteTXT(ctx, "_acme-challenge."+host, value)
+}
@@ -0,0 +1,131 @@
+package source
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+
+    "github.com/go-git/go-billy/v5/osfs"
+    git "github.com/go-git/go-git/v5"
+    "github.com/go-git/go-git/v5/plumbing"
+    "github.com/go-git/go-git/v5/plumbing/cache"
+    "github.com/go-git/go-git/v5/plumbing/storer"
+    "github.com/go-git/go-git/v5/plumbing/transport"
+    "github.com/go-git/go-git/v5/plumbing/transport/client"
+    "github.com/go-git/go-git/v5/plumbing/transport/server"
+    "github.com/go-git/go-git/v5/storage/filesystem"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+    "github.com/vaheed/kubeop/internal/kube"
+)
+
+// fileRepos is set by AllowFileRepos. A local repository lets an App read
+// any repository on the operator's filesystem, so they are refused otherwise.
+var (
+    fileRepos     bool
+    fileReposOnce sync.Once
+)
+
+// AllowFileRepos accepts file:// and other local repositories, served
+// in-process. The default file transport execs git-upload-pack, which does
+// not exist in the distroless operator image. It is meant for tests and must
+// be called before Git.
+func AllowFileRepos() {
+    fileReposOnce.Do(func() { client.InstallProtocol("file", server.NewClient(localLoader{})) })
+    fileRepos = true
+}
+
+// GitResult is the outcome of rendering a Git source.
+type GitResult struct {
+    Commit  string
+    Objects []*unstructured.Unstructured
+}
+
+// Git clones repo, checks out ref (branch, tag or commit; empty means the
+// remote HEAD) and decodes every YAML manifest found under path.
+func Git(ctx context.Context, repo, ref, path string) (*GitResult, error) {
+    if repo == "" { return nil, fmt.Errorf("git repo is required") }
+    ep, err := transport.NewEndpoint(repo)
+    if err != nil { return nil, fmt.Errorf("git repo %s: %w", repo, err) }
+    if ep.Protocol == "file" && !fileRepos { return nil, fmt.Errorf("git repo %s: local repositories are not allowed", repo) }
+    dir, err := os.MkdirTemp("", "kubeop-git-*")
+    if err != nil { return nil, err }
+    defer os.RemoveAll(dir)
+
+    r, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{URL: repo, NoCheckout: true})
+    if err != nil { return nil, fmt.Errorf("clone %s: %w", repo, err) }
+    hash, err := resolveRef(r, ref)
+    if err != nil { return nil, err }
+    wt, err := r.Worktree()
+    if err != nil { return nil, err }
+    if err := wt.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+        return nil, fmt.Errorf("checkout %s: %w", hash, err)
+    }
+
+    root, err := subdir(dir, path)
+    if err != nil { return nil, err }
+    objs, err := kube.DecodeDir(root)
+    if err != nil { return nil, err }
+    return &GitResult{Commit: hash.String(), Objects: objs}, nil
+}
+
+// resolveRef maps a user supplied ref to a commit. Branches other than the
+// default one only exist as remote-tracking refs after a clone, so those are
+// tried as a fallback.
+func resolveRef(r *git.Repository, ref string) (*plumbing.Hash, error) {
+    if ref == "" {
+        head, err := r.Head()
+        if err != nil { return nil, fmt.Errorf("resolve HEAD: %w", err) }
+        h := head.Hash()
+        return &h, nil
+    }
+    candidates := []string{ref, "origin/" + ref}
+    for _, c := range candidates {
+        if h, err := r.ResolveRevision(plumbing.Revision(c)); err == nil {
+            return h, nil
+        }
+    }
+    if plumbing.IsHash(ref) {
+        h := plumbing.NewHash(ref)
+        if _, err := r.CommitObject(h); err == nil { return &h, nil }
+    }
+    return nil, fmt.Errorf("ref %q not found", ref)
+}
+
+// subdir joins path onto root. Cleaning path as if it were absolute keeps
+// ".." segments from climbing out of the checkout, and resolving symlinks
+// keeps a symlinked directory from pointing out of it.
+func subdir(root, path string) (string, error) {
+    root, err := filepath.EvalSymlinks(root)
+    if err != nil { return "", err }
+    p, err := filepath.EvalSymlinks(filepath.Join(root, filepath.Clean("/"+path)))
+    if err != nil { return "", fmt.Errorf("path %q: %w", path, err) }
+    rel, err := filepath.Rel(root, p)
+    if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+        return "", fmt.Errorf("path %q leads outside the repository", path)
+    }
+    st, err := os.Stat(p)
+    if err != nil { return "", fmt.Errorf("path %q: %w", path, err) }
+    if !st.IsDir() { return "", fmt.Errorf("path %q is not a directory", path) }
+    return p, nil
+}
+
+// localLoader opens bare repositories and working copies alike, unlike
+// server.DefaultLoader which only understands bare layouts.
+type localLoader struct{}
+
+func (localLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+    fs := osfs.New(ep.Path)
+    if _, err := fs.Stat(git.GitDirName); err == nil {
+        sub, err := fs.Chroot(git.GitDirName)
+        if err != nil { return nil, err }
+        fs = sub
+    }
+    if _, err := fs.Stat("config"); err != nil {
+        return nil, transport.ErrRepositoryNotFound
+    }
+    return filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil
+}
@@ -0,0 +1,109 @@
+package source
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    git "github.com/go-git/go-git/v5"
+    "github.com/go-git/go-git/v5/plumbing"
+    "github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const cmV1 = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  version: "1"
+`
+
+// commitFile writes content to name inside the worktree and commits it.
+func commitFile(t *testing.T, r *git.Repository, dir, name, content string) plumbing.Hash {
+    t.Helper()
+    p := filepath.Join(dir, name)
+    if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(p, []byte(content), 0o644); err != nil { t.Fatal(err) }
+    wt, err := r.Worktree()
+    if err != nil { t.Fatal(err) }
+    if _, err := wt.Add(name); err != nil { t.Fatal(err) }
+    sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+    h, err := wt.Commit("update "+name, &git.CommitOptions{Author: sig})
+    if err != nil { t.Fatal(err) }
+    return h
+}
+
+func TestGit_FileRepoRefs(t *testing.T) {
+    dir := t.TempDir()
+    r, err := git.PlainInit(dir, false)
+    if err != nil { t.Fatal(err) }
+    first := commitFile(t, r, dir, "deploy/cm.yaml", cmV1)
+    if _, err := r.CreateTag("v1", first, nil); err != nil { t.Fatal(err) }
+    commitFile(t, r, dir, "deploy/svc.yaml", "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n---\n# trailing comment\n")
+    head, err := r.Head()
+    if err != nil { t.Fatal(err) }
+    commitFile(t, r, dir, "README.md", "not a manifest\n")
+
+    AllowFileRepos()
+    repo := "file://" + dir
+    ctx := context.Background()
+
+    res, err := Git(ctx, repo, "v1", "deploy")
+    if err != nil { t.Fatalf("tag: %v", err) }
+    if res.Commit != first.String() { t.Fatalf("unexpected commit for tag: %s", res.Commit) }
+    if len(res.Objects) != 1 || res.Objects[0].GetKind() != "ConfigMap" { t.Fatalf("unexpected objects: %v", res.Objects) }
+
+    res, err = Git(ctx, repo, head.Hash().String(), "/deploy/")
+    if err != nil { t.Fatalf("sha: %v", err) }
+    if len(res.Objects) != 2 { t.Fatalf("expected 2 objects at %s, got %d", head.Hash(), len(res.Objects)) }
+
+    res, err = Git(ctx, repo, "", "deploy")
+    if err != nil { t.Fatalf("default ref: %v", err) }
+    if res.Commit == head.Hash().String() || res.Commit == first.String() { t.Fatalf("expected latest commit, got %s", res.Commit) }
+
+    if _, err := Git(ctx, repo, "missing", "deploy"); err == nil { t.Fatalf("expected error for unknown ref") }
+    if _, err := Git(ctx, repo, "v1", "../../etc"); err == nil { t.Fatalf("expected error for path outside checkout") }
+}
+
+// commitSymlink adds a symlink named name pointing at target and commits it.
+func commitSymlink(t *testing.T, r *git.Repository, dir, name, target string) {
+    t.Helper()
+    p := filepath.Join(dir, name)
+    if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil { t.Fatal(err) }
+    if err := os.Symlink(target, p); err != nil { t.Fatal(err) }
+    wt, err := r.Worktree()
+    if err != nil { t.Fatal(err) }
+    if _, err := wt.Add(name); err != nil { t.Fatal(err) }
+    sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+    if _, err := wt.Commit("link "+name, &git.CommitOptions{Author: sig}); err != nil { t.Fatal(err) }
+}
+
+func TestGit_Symlinks(t *testing.T) {
+    dir := t.TempDir()
+    r, err := git.PlainInit(dir, false)
+    if err != nil { t.Fatal(err) }
+    commitFile(t, r, dir, "deploy/cm.yaml", cmV1)
+    commitSymlink(t, r, dir, "escape", "..")
+    commitSymlink(t, r, dir, "inside", "deploy")
+    commitSymlink(t, r, dir, "nested/deploy/linked", "../../deploy")
+
+    AllowFileRepos()
+    repo := "file://" + dir
+    ctx := context.Background()
+    if _, err := Git(ctx, repo, "", "escape"); err == nil || !strings.Contains(err.Error(), "outside") { t.Fatalf("expected a symlink out of the checkout to be rejected, got %v", err) }
+    if _, err := Git(ctx, repo, "", "nested"); err == nil || !strings.Contains(err.Error(), "symlinked") { t.Fatalf("expected a symlinked directory to be rejected, got %v", err) }
+    res, err := Git(ctx, repo, "", "inside")
+    if err != nil { t.Fatalf("symlink within the checkout: %v", err) }
+    if len(res.Objects) != 1 { t.Fatalf("expected 1 object, got %d", len(res.Objects)) }
+}
+
+func TestGit_FileReposDisabled(t *testing.T) {
+    defer func(v bool) { fileRepos = v }(fileRepos)
+    fileRepos = false
+    for _, repo := range []string{"file:///srv/repo", "/srv/repo"} {
+        if _, err := Git(context.Background(), repo, "", ""); err == nil || !strings.Contains(err.Error(), "not allowed") { t.Fatalf("%s: expected local repositories to be refused, got %v", repo, err) }
+    }
+}
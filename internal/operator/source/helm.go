@@ -0,0 +1,120 @@
+package source
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "helm.sh/helm/v3/pkg/chart"
+    "helm.sh/helm/v3/pkg/chart/loader"
+    "helm.sh/helm/v3/pkg/chartutil"
+    "helm.sh/helm/v3/pkg/engine"
+    "helm.sh/helm/v3/pkg/releaseutil"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+    "github.com/vaheed/kubeop/internal/kube"
+)
+
+// HelmRelease identifies what is being rendered.
+type HelmRelease struct {
+    Name      string
+    Namespace string
+    // Revision is exposed to templates as .Release.Revision.
+    Revision int
+}
+
+// HelmChart is a loaded local chart plus the values the user supplied.
+type HelmChart struct {
+    chart  *chart.Chart
+    values string
+    // Name and Version come from Chart.yaml.
+    Name    string
+    Version string
+    // Digest changes whenever the chart contents or the values change, and
+    // is used to decide when a new release revision is due.
+    Digest string
+}
+
+// LoadHelmChart loads a chart directory or packaged .tgz from path, resolved
+// below baseDir when one is configured. Without baseDir, path must stay below
+// the working directory. A non-empty version must match the version declared
+// in Chart.yaml. values is a YAML document merged over the chart's own
+// values.yaml.
+func LoadHelmChart(baseDir, path, version, values string) (*HelmChart, error) {
+    if path == "" { return nil, fmt.Errorf("helm chart is required") }
+    if baseDir != "" {
+        path = filepath.Join(baseDir, filepath.Clean("/"+path))
+    } else if !filepath.IsLocal(path) {
+        return nil, fmt.Errorf("helm chart %s is outside the charts directory", path)
+    }
+    ch, err := loader.Load(path)
+    if err != nil { return nil, fmt.Errorf("load chart %s: %w", path, err) }
+    if version != "" && ch.Metadata.Version != version {
+        return nil, fmt.Errorf("chart %s has version %s, want %s", ch.Name(), ch.Metadata.Version, version)
+    }
+    if _, err := chartutil.ReadValues([]byte(values)); err != nil {
+        return nil, fmt.Errorf("parse values: %w", err)
+    }
+    return &HelmChart{
+        chart:   ch,
+        values:  values,
+        Name:    ch.Name(),
+        Version: ch.Metadata.Version,
+        Digest:  chartDigest(ch, values),
+    }, nil
+}
+
+// Render renders the chart for rel and returns the objects in Helm's install
+// order. Helm hooks and NOTES.txt are dropped: Apps run their own hooks.
+func (h *HelmChart) Render(rel HelmRelease) ([]*unstructured.Unstructured, error) {
+    // ProcessDependencies mutates values, so parse a fresh copy per render.
+    vals, err := chartutil.ReadValues([]byte(h.values))
+    if err != nil { return nil, err }
+    if err := chartutil.ProcessDependenciesWithMerge(h.chart, vals); err != nil { return nil, err }
+    opts := chartutil.ReleaseOptions{Name: rel.Name, Namespace: rel.Namespace, Revision: rel.Revision, IsInstall: rel.Revision <= 1, IsUpgrade: rel.Revision > 1}
+    caps := chartutil.DefaultCapabilities
+    renderVals, err := chartutil.ToRenderValues(h.chart, vals, opts, caps)
+    if err != nil { return nil, err }
+    files, err := engine.Render(h.chart, renderVals)
+    if err != nil { return nil, fmt.Errorf("render chart %s: %w", h.Name, err) }
+    for name := range files {
+        if strings.HasSuffix(name, "NOTES.txt") { delete(files, name) }
+    }
+    _, manifests, err := releaseutil.SortManifests(files, caps.APIVersions, releaseutil.InstallOrder)
+    if err != nil { return nil, err }
+    var out []*unstructured.Unstructured
+    for _, m := range manifests {
+        objs, err := kube.DecodeManifests(strings.NewReader(m.Content))
+        if err != nil { return nil, fmt.Errorf("%s: %w", m.Name, err) }
+        out = append(out, objs...)
+    }
+    return out, nil
+}
+
+// chartDigest hashes chart metadata, templates, default values and the user
+// values, in a stable order, including dependencies.
+func chartDigest(ch *chart.Chart, values string) string {
+    h := sha256.New()
+    var walk func(c *chart.Chart)
+    walk = func(c *chart.Chart) {
+        fmt.Fprintf(h, "%s@%s\n", c.Name(), c.Metadata.Version)
+        files := append([]*chart.File{}, c.Templates...)
+        sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+        for _, f := range files {
+            fmt.Fprintf(h, "%s\n", f.Name)
+            h.Write(f.Data)
+        }
+        for _, f := range c.Raw {
+            if f.Name == chartutil.ValuesfileName { h.Write(f.Data) }
+        }
+        deps := append([]*chart.Chart{}, c.Dependencies()...)
+        sort.Slice(deps, func(i, j int) bool { return deps[i].Name() < deps[j].Name() })
+        for _, d := range deps { walk(d) }
+    }
+    walk(ch)
+    h.Write([]byte(values))
+    return hex.EncodeToString(h.Sum(nil))[:12]
+}
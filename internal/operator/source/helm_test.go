@@ -0,0 +1,73 @@
+package source
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+
+    "helm.sh/helm/v3/pkg/chart/loader"
+    "helm.sh/helm/v3/pkg/chartutil"
+)
+
+func writeChart(t *testing.T, dir string) {
+    t.Helper()
+    files := map[string]string{
+        "Chart.yaml":  "apiVersion: v2\nname: web\nversion: 0.1.0\n",
+        "values.yaml": "replicas: 1\ngreeting: hello\n",
+        "templates/cm.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-cfg
+data:
+  greeting: {{ .Values.greeting | quote }}
+  revision: {{ .Release.Revision | quote }}
+`,
+        "templates/svc.yaml":  "apiVersion: v1\nkind: Service\nmetadata:\n  name: {{ .Release.Name }}\n",
+        "templates/hook.yaml": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: hook\n  annotations:\n    helm.sh/hook: pre-install\n",
+        "templates/NOTES.txt": "installed {{ .Release.Name }}\n",
+    }
+    for name, content := range files {
+        p := filepath.Join(dir, name)
+        if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil { t.Fatal(err) }
+        if err := os.WriteFile(p, []byte(content), 0o644); err != nil { t.Fatal(err) }
+    }
+}
+
+func TestHelm_RenderDirectory(t *testing.T) {
+    root := t.TempDir()
+    base := filepath.Join(root, "charts")
+    writeChart(t, filepath.Join(base, "web"))
+    writeChart(t, filepath.Join(root, "outside"))
+    ch, err := LoadHelmChart(base, "web", "0.1.0", "greeting: hi\n")
+    if err != nil { t.Fatal(err) }
+    objs, err := ch.Render(HelmRelease{Name: "demo", Namespace: "kubeop-acme-web", Revision: 3})
+    if err != nil { t.Fatal(err) }
+    if len(objs) != 2 { t.Fatalf("expected hook and notes to be dropped, got %d objects", len(objs)) }
+    // install order puts ConfigMaps before Services
+    if objs[0].GetKind() != "ConfigMap" || objs[1].GetKind() != "Service" { t.Fatalf("unexpected order: %s, %s", objs[0].GetKind(), objs[1].GetKind()) }
+    data := objs[0].Object["data"].(map[string]any)
+    if data["greeting"] != "hi" || data["revision"] != "3" { t.Fatalf("unexpected data: %v", data) }
+
+    other, err := LoadHelmChart(base, "web", "", "greeting: hello\n")
+    if err != nil { t.Fatal(err) }
+    if other.Digest == ch.Digest { t.Fatalf("expected digest to change with values") }
+    if _, err := LoadHelmChart(base, "web", "9.9.9", ""); err == nil { t.Fatalf("expected version mismatch error") }
+    if _, err := LoadHelmChart(base, "../outside", "", ""); err == nil { t.Fatalf("expected path outside charts dir to fail") }
+}
+
+func TestHelm_RenderPackage(t *testing.T) {
+    dir := t.TempDir()
+    writeChart(t, filepath.Join(dir, "src"))
+    loaded, err := loader.Load(filepath.Join(dir, "src"))
+    if err != nil { t.Fatal(err) }
+    tgz, err := chartutil.Save(loaded, dir)
+    if err != nil { t.Fatal(err) }
+    ch, err := LoadHelmChart(dir, filepath.Base(tgz), "", "")
+    if err != nil { t.Fatal(err) }
+    objs, err := ch.Render(HelmRelease{Name: "demo", Namespace: "ns", Revision: 1})
+    if err != nil { t.Fatal(err) }
+    if len(objs) != 2 || objs[0].GetName() != "demo-cfg" { t.Fatalf("unexpected objects: %v", objs) }
+    // without a charts directory only relative paths below it are loaded
+    if _, err := LoadHelmChart("", tgz, "", ""); err == nil { t.Fatalf("expected absolute path to fail") }
+    if _, err := LoadHelmChart("", "../src", "", ""); err == nil { t.Fatalf("expected path outside working directory to fail") }
+}
@@ -25,7 +25,7 @@ func main() {
     flags := discoverFlags("cmd")
     envs := discoverEnvs()
     endpoints := discoverAPIEndpoints("internal/api/server.go")
-    crdTypes := parseCRDTypes("internal/operator/apis/paas/v1alpha1/types.go")
+    crdTypes := parseCRDTypes("internal/operator/apis/paas/v1beta1/types.go")
     controllers := parseControllers("internal/operator/controllers/controllers.go")
 
     // README
@@ -146,14 +146,14 @@ func renderContrib() string { return `# Contributing
 
 func exampleManifests() string {
     // Use the same shape as e2e test resources
-    return `apiVersion: paas.kubeop.io/v1alpha1
+    return `apiVersion: paas.kubeop.io/v1beta1
 kind: Tenant
 metadata:
   name: acme
 spec:
   name: acme
 ---
-apiVersion: paas.kubeop.io/v1alpha1
+apiVersion: paas.kubeop.io/v1beta1
 kind: Project
 metadata:
   name: web
@@ -161,7 +161,7 @@ spec:
   tenantRef: acme
   name: web
 ---
-apiVersion: paas.kubeop.io/v1alpha1
+apiVersion: paas.kubeop.io/v1beta1
 kind: App
 metadata:
   name: web